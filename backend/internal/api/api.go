@@ -10,6 +10,7 @@ import (
 
 	"github.com/veops/oneterm/internal/acl"
 	"github.com/veops/oneterm/internal/api/router"
+	"github.com/veops/oneterm/internal/guacd"
 	"github.com/veops/oneterm/internal/model"
 	"github.com/veops/oneterm/internal/service"
 	fileservice "github.com/veops/oneterm/internal/service/file"
@@ -34,7 +35,11 @@ func initDB() {
 		model.DefaultGateway, model.DefaultHistory, model.DefaultNode, model.DefaultPublicKey,
 		model.DefaultSession, model.DefaultSessionCmd, model.DefaultShare, model.DefaultQuickCommand,
 		model.DefaultUserPreference, model.DefaultStorageConfig, model.DefaultStorageMetrics,
-		model.DefaultTimeTemplate, model.DefaultMigrationRecord,
+		model.DefaultTimeTemplate, model.DefaultMigrationRecord, model.DefaultFileMetadata,
+		model.DefaultReplayVideo, model.DefaultFileReplica, model.DefaultStorageMigration,
+		model.DefaultAuditExport,
+		model.DefaultSessionClipboard,
+		model.DefaultSessionWebRequest,
 	); err != nil {
 		logger.L().Fatal("Failed to init database", zap.Error(err))
 	}
@@ -43,6 +48,11 @@ func initDB() {
 		logger.L().Fatal("Failed to drop index", zap.Error(err))
 	}
 
+	// Command search falls back to prefix matches without it
+	if err := db.CreateFullTextIndex(model.DefaultSessionCmd, "session_cmd", model.SessionCmdSearchIndex, "cmd", "result"); err != nil {
+		logger.L().Warn("Failed to create command search index", zap.Error(err))
+	}
+
 	gsession.InitSessionCleanup()
 }
 
@@ -50,6 +60,9 @@ func initServices() {
 	service.InitAuthorizationService()
 	fileservice.InitFileService()
 
+	// Initialize guacd endpoint pool and its health checks
+	guacd.InitPool()
+
 	// Initialize predefined dangerous commands and templates
 	if err := service.InitBuiltinCommands(); err != nil {
 		logger.L().Error("Failed to initialize builtin commands", zap.Error(err))
@@ -78,6 +91,20 @@ func initStorage() error {
 	// Initialize storage cleaner service
 	service.InitStorageCleanerService()
 
+	// Index replays written before the replay index existed
+	if _, err := service.StartReplayIndexBackfill(false); err != nil {
+		logger.L().Error("Failed to start replay index backfill", zap.Error(err))
+	}
+
+	// Initialize replay video conversion workers
+	service.InitReplayVideoService()
+
+	// Initialize mirror replication and storage migrations
+	service.InitStorageReplicationService()
+
+	// Initialize audit bundle export worker
+	service.InitAuditExportService()
+
 	return nil
 }
 
@@ -119,6 +146,18 @@ func StopApi() {
 	// Stop storage service background tasks
 	service.StopStorageService()
 
+	// Stop replay video conversion workers
+	service.StopReplayVideoService()
+
+	// Stop mirror replication and storage migrations
+	service.StopStorageReplicationService()
+
+	// Stop audit bundle export worker
+	service.StopAuditExportService()
+
+	// Stop guacd health checks
+	guacd.StopPool()
+
 	// Stop web proxy session cleanup routine
 	webproxy.StopSessionCleanupRoutine()
 }
@@ -33,6 +33,12 @@ var (
 		func(ctx *gin.Context, data *model.Asset) {
 			assetService.PreprocessAssetData(data)
 		},
+		// Validate protocol specific configuration
+		func(ctx *gin.Context, data *model.Asset) {
+			if err := assetService.ValidateAssetData(data); err != nil {
+				ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err.Error()}})
+			}
+		},
 	}
 	assetPostHooks = []postHook[*model.Asset]{
 		// Attach node chain
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/acl"
+	"github.com/veops/oneterm/internal/service"
+	"github.com/veops/oneterm/pkg/errors"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+// CreateAuditExport godoc
+//
+//	@Tags		session
+//	@Param		body	body		service.AuditExportRequest	true	"session id, or user, asset and time range filter"
+//	@Success	200		{object}	HttpResponse{data=model.AuditExport}
+//	@Router		/session/export [post]
+func (c *Controller) CreateAuditExport(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &errors.ApiError{Code: errors.ErrNoPerm, Data: map[string]any{"perm": acl.READ}})
+		return
+	}
+
+	req := &service.AuditExportRequest{}
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	export, err := service.DefaultAuditExportService.CreateAuditExport(ctx, req, currentUser.GetUid())
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(export))
+}
+
+// GetAuditExports godoc
+//
+//	@Tags		session
+//	@Success	200	{object}	HttpResponse{data=[]model.AuditExport}
+//	@Router		/session/export [get]
+func (c *Controller) GetAuditExports(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &errors.ApiError{Code: errors.ErrNoPerm, Data: map[string]any{"perm": acl.READ}})
+		return
+	}
+
+	exports, err := service.DefaultAuditExportService.GetAuditExports(ctx)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, &errors.ApiError{Code: errors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(exports))
+}
+
+// GetAuditExport godoc
+//
+//	@Tags		session
+//	@Param		id	path		int	true	"export id"
+//	@Success	200	{object}	HttpResponse{data=model.AuditExport}
+//	@Router		/session/export/:id [get]
+func (c *Controller) GetAuditExport(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &errors.ApiError{Code: errors.ErrNoPerm, Data: map[string]any{"perm": acl.READ}})
+		return
+	}
+
+	export, err := service.DefaultAuditExportService.GetAuditExport(ctx, cast.ToInt(ctx.Param("id")))
+	if err != nil {
+		ctx.AbortWithError(http.StatusNotFound, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(export))
+}
+
+// DownloadAuditExport godoc
+//
+//	@Tags		session
+//	@Param		id	path		int	true	"export id"
+//	@Success	200	{object}	string
+//	@Router		/session/export/:id/download [get]
+func (c *Controller) DownloadAuditExport(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &errors.ApiError{Code: errors.ErrNoPerm, Data: map[string]any{"perm": acl.READ}})
+		return
+	}
+
+	reader, export, err := service.DefaultAuditExportService.OpenAuditExport(ctx, cast.ToInt(ctx.Param("id")))
+	if err != nil {
+		ctx.AbortWithError(http.StatusNotFound, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+	defer reader.Close()
+
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=audit_export_%d.zip", export.Id))
+	ctx.Header("Content-Type", "application/zip")
+	if export.FileSize > 0 {
+		ctx.Header("Content-Length", cast.ToString(export.FileSize))
+	}
+
+	if _, err = io.Copy(ctx.Writer, reader); err != nil {
+		logger.L().Error("Failed to stream audit export", zap.Int("id", export.Id), zap.Error(err))
+	}
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+
+	"github.com/veops/oneterm/internal/docker"
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/service"
+	gsession "github.com/veops/oneterm/internal/session"
+	myErrors "github.com/veops/oneterm/pkg/errors"
+)
+
+var dockerService = service.NewDockerService()
+
+// hasDockerConnect checks connect permission, narrowed to container when given
+func hasDockerConnect(ctx *gin.Context, assetId, accountId int, container string) (bool, error) {
+	sess := &gsession.Session{
+		Session: &model.Session{
+			AssetId:   assetId,
+			AccountId: accountId,
+			Protocol:  "docker",
+		},
+	}
+	if container != "" {
+		sess.Workload = &model.WorkloadTarget{Container: container}
+	}
+	result, err := service.DefaultAuthService.HasAuthorizationV2(ctx, sess, model.ActionConnect)
+	if err != nil {
+		return false, err
+	}
+	return result.IsAllowed(model.ActionConnect), nil
+}
+
+// GetDockerContainers godoc
+//
+//	@Tags		docker
+//	@Param		asset_id	path		int	true	"asset_id"
+//	@Param		account_id	path		int	true	"account_id"
+//	@Success	200			{object}	HttpResponse{data=ListData{list=[]docker.Container}}
+//	@Router		/docker/:asset_id/:account_id/containers [get]
+func (c *Controller) GetDockerContainers(ctx *gin.Context) {
+	assetId, accountId := cast.ToInt(ctx.Param("asset_id")), cast.ToInt(ctx.Param("account_id"))
+
+	if ok, err := hasDockerConnect(ctx, assetId, accountId, ""); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	} else if !ok {
+		ctx.AbortWithError(http.StatusForbidden, &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": "connect"}})
+		return
+	}
+
+	containers, err := dockerService.ListContainers(ctx, assetId, accountId)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &myErrors.ApiError{Code: myErrors.ErrConnectServer, Data: map[string]any{"err": err}})
+		return
+	}
+
+	// Hide containers excluded by the container selector of authorization rules
+	containers = lo.Filter(containers, func(ct *docker.Container, _ int) bool {
+		ok, _ := hasDockerConnect(ctx, assetId, accountId, ct.Name)
+		return ok
+	})
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(&ListData{
+		Count: int64(len(containers)),
+		List:  lo.ToAnySlice(containers),
+	}))
+}
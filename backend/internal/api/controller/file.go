@@ -47,6 +47,7 @@ const (
 //	@Param		asset_id	query		int		false	"asset id"
 //	@Param		account_id	query		int		false	"account id"
 //	@Param		client_ip	query		string	false	"client_ip"
+//	@Param		session_id	query		string	false	"session id"
 //	@Success	200			{object}	HttpResponse{data=ListData{list=[]model.Session}}
 //	@Router		/file/history [get]
 func (c *Controller) GetFileHistory(ctx *gin.Context) {
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+
+	"github.com/veops/oneterm/internal/kubernetes"
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/service"
+	gsession "github.com/veops/oneterm/internal/session"
+	myErrors "github.com/veops/oneterm/pkg/errors"
+)
+
+var kubernetesService = service.NewKubernetesService()
+
+// hasKubernetesConnect checks connect permission, narrowed to namespace when given
+func hasKubernetesConnect(ctx *gin.Context, assetId, accountId int, namespace string) (bool, error) {
+	sess := &gsession.Session{
+		Session: &model.Session{
+			AssetId:   assetId,
+			AccountId: accountId,
+			Protocol:  "kubernetes",
+		},
+	}
+	if namespace != "" {
+		sess.Workload = &model.WorkloadTarget{Namespace: namespace}
+	}
+	result, err := service.DefaultAuthService.HasAuthorizationV2(ctx, sess, model.ActionConnect)
+	if err != nil {
+		return false, err
+	}
+	return result.IsAllowed(model.ActionConnect), nil
+}
+
+// GetKubernetesNamespaces godoc
+//
+//	@Tags		kubernetes
+//	@Param		asset_id	path		int	true	"asset_id"
+//	@Param		account_id	path		int	true	"account_id"
+//	@Success	200			{object}	HttpResponse{data=ListData{list=[]kubernetes.Namespace}}
+//	@Router		/kubernetes/:asset_id/:account_id/namespaces [get]
+func (c *Controller) GetKubernetesNamespaces(ctx *gin.Context) {
+	assetId, accountId := cast.ToInt(ctx.Param("asset_id")), cast.ToInt(ctx.Param("account_id"))
+
+	if ok, err := hasKubernetesConnect(ctx, assetId, accountId, ""); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	} else if !ok {
+		ctx.AbortWithError(http.StatusForbidden, &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": "connect"}})
+		return
+	}
+
+	namespaces, err := kubernetesService.ListNamespaces(ctx, assetId, accountId)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &myErrors.ApiError{Code: myErrors.ErrConnectServer, Data: map[string]any{"err": err}})
+		return
+	}
+
+	// Hide namespaces excluded by the namespace selector of authorization rules
+	namespaces = lo.Filter(namespaces, func(ns *kubernetes.Namespace, _ int) bool {
+		ok, _ := hasKubernetesConnect(ctx, assetId, accountId, ns.Name)
+		return ok
+	})
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(&ListData{
+		Count: int64(len(namespaces)),
+		List:  lo.ToAnySlice(namespaces),
+	}))
+}
+
+// GetKubernetesPods godoc
+//
+//	@Tags		kubernetes
+//	@Param		asset_id	path		int		true	"asset_id"
+//	@Param		account_id	path		int		true	"account_id"
+//	@Param		namespace	query		string	true	"namespace"
+//	@Success	200			{object}	HttpResponse{data=ListData{list=[]kubernetes.Pod}}
+//	@Router		/kubernetes/:asset_id/:account_id/pods [get]
+func (c *Controller) GetKubernetesPods(ctx *gin.Context) {
+	assetId, accountId := cast.ToInt(ctx.Param("asset_id")), cast.ToInt(ctx.Param("account_id"))
+	namespace := ctx.Query("namespace")
+	if namespace == "" {
+		ctx.AbortWithError(http.StatusBadRequest, &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": "namespace is required"}})
+		return
+	}
+
+	if ok, err := hasKubernetesConnect(ctx, assetId, accountId, namespace); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	} else if !ok {
+		ctx.AbortWithError(http.StatusForbidden, &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": "connect"}})
+		return
+	}
+
+	pods, err := kubernetesService.ListPods(ctx, assetId, accountId, namespace)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &myErrors.ApiError{Code: myErrors.ErrConnectServer, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(&ListData{
+		Count: int64(len(pods)),
+		List:  lo.ToAnySlice(pods),
+	}))
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/acl"
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/service"
+	"github.com/veops/oneterm/pkg/errors"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+// CreateReplayVideo godoc
+//
+//	@Tags		session
+//	@Param		session_id	path		string	true	"session id"
+//	@Param		format		query		string	false	"mp4 or webm, default mp4"
+//	@Success	200			{object}	HttpResponse{data=model.ReplayVideo}
+//	@Router		/session/replay/:session_id/video [post]
+func (c *Controller) CreateReplayVideo(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+
+	format := ctx.DefaultQuery("format", model.VideoFormatMp4)
+	video, err := service.DefaultReplayVideoService.CreateReplayVideo(ctx, ctx.Param("session_id"), format, currentUser.GetUid())
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(video))
+}
+
+// GetReplayVideos godoc
+//
+//	@Tags		session
+//	@Param		session_id	path		string	true	"session id"
+//	@Success	200			{object}	HttpResponse{data=[]model.ReplayVideo}
+//	@Router		/session/replay/:session_id/video [get]
+func (c *Controller) GetReplayVideos(ctx *gin.Context) {
+	videos, err := service.DefaultReplayVideoService.GetReplayVideos(ctx, ctx.Param("session_id"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, &errors.ApiError{Code: errors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(videos))
+}
+
+// GetReplayVideo godoc
+//
+//	@Tags		session
+//	@Param		session_id	path		string	true	"session id"
+//	@Param		id			path		int		true	"video id"
+//	@Success	200			{object}	HttpResponse{data=model.ReplayVideo}
+//	@Router		/session/replay/:session_id/video/:id [get]
+func (c *Controller) GetReplayVideo(ctx *gin.Context) {
+	video, err := service.DefaultReplayVideoService.GetReplayVideo(ctx, ctx.Param("session_id"), cast.ToInt(ctx.Param("id")))
+	if err != nil {
+		ctx.AbortWithError(http.StatusNotFound, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(video))
+}
+
+// DownloadReplayVideo godoc
+//
+//	@Tags		session
+//	@Param		session_id	path		string	true	"session id"
+//	@Param		id			path		int		true	"video id"
+//	@Success	200			{object}	string
+//	@Router		/session/replay/:session_id/video/:id/download [get]
+func (c *Controller) DownloadReplayVideo(ctx *gin.Context) {
+	reader, video, err := service.DefaultReplayVideoService.OpenReplayVideo(ctx, ctx.Param("session_id"), cast.ToInt(ctx.Param("id")))
+	if err != nil {
+		ctx.AbortWithError(http.StatusNotFound, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+	defer reader.Close()
+
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", video.SessionId, video.Format))
+	ctx.Header("Content-Type", model.VideoMimeType(video.Format))
+	if video.FileSize > 0 {
+		ctx.Header("Content-Length", cast.ToString(video.FileSize))
+	}
+
+	if _, err = io.Copy(ctx.Writer, reader); err != nil {
+		logger.L().Error("Failed to stream replay video", zap.Int("id", video.Id), zap.Error(err))
+	}
+}
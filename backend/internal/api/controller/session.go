@@ -1,17 +1,24 @@
 package controller
 
 import (
+	stderrors "errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 
+	"github.com/veops/oneterm/internal/acl"
 	"github.com/veops/oneterm/internal/model"
 	"github.com/veops/oneterm/internal/service"
 	"github.com/veops/oneterm/pkg/errors"
 	"github.com/veops/oneterm/pkg/logger"
+	"github.com/veops/oneterm/pkg/storage"
 )
 
 var (
@@ -87,6 +94,69 @@ func (c *Controller) GetSessionCmds(ctx *gin.Context) {
 	doGet[*model.SessionCmd](ctx, false, db, "")
 }
 
+// GetSessionClipboards godoc
+//
+//	@Tags		session
+//	@Param		page_index	query		int		true	"page_index"
+//	@Param		page_size	query		int		true	"page_size"
+//	@Param		session_id	path		string	true	"session id"
+//	@Param		direction	query		string	false	"copy or paste"
+//	@Param		search		query		string	false	"search in captured content"
+//	@Success	200			{object}	HttpResponse{data=ListData{list=[]model.SessionClipboard}}
+//	@Router		/session/:session_id/clipboard [get]
+func (c *Controller) GetSessionClipboards(ctx *gin.Context) {
+	db := sessionService.BuildClipboardQuery(ctx, ctx.Param("session_id"))
+	doGet[*model.SessionClipboard](ctx, false, db, "")
+}
+
+// maxCmdSearchPageSize caps the page of command search, every hit joins its session
+const maxCmdSearchPageSize = 100
+
+// SearchSessionCmds godoc
+//
+//	@Tags		session
+//	@Param		page_index	query		int		false	"page_index"
+//	@Param		page_size	query		int		false	"page_size, at most 100"
+//	@Param		search		query		string	false	"search in command and result"
+//	@Param		start		query		string	false	"start, RFC3339"
+//	@Param		end			query		string	false	"end, RFC3339"
+//	@Param		uid			query		int		false	"uid"
+//	@Param		asset_id	query		int		false	"asset id"
+//	@Param		account_id	query		int		false	"account id"
+//	@Param		session_id	query		string	false	"session id"
+//	@Param		protocol	query		string	false	"protocol, e.g. ssh"
+//	@Param		level		query		int		false	"minimum risk level"
+//	@Success	200			{object}	HttpResponse{data=ListData{list=[]model.SessionCmdHit}}
+//	@Router		/session/cmd/search [get]
+func (c *Controller) SearchSessionCmds(ctx *gin.Context) {
+	pageIndex := max(cast.ToInt(ctx.DefaultQuery("page_index", "1")), 1)
+	pageSize := lo.Clamp(cast.ToInt(ctx.DefaultQuery("page_size", "20")), 1, maxCmdSearchPageSize)
+
+	db, err := sessionService.BuildCmdSearchQuery(ctx)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	var count int64
+	if err := db.Session(&gorm.Session{}).Count(&count).Error; err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, &errors.ApiError{Code: errors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+
+	hits := make([]*model.SessionCmdHit, 0)
+	if err := db.Offset((pageIndex - 1) * pageSize).Limit(pageSize).Order("session_cmd.id DESC").Find(&hits).Error; err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, &errors.ApiError{Code: errors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+	sessionService.AttachReplayOffsets(hits)
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(&ListData{
+		Count: count,
+		List:  lo.ToAnySlice(hits),
+	}))
+}
+
 // GetSessionOptionAsset godoc
 //
 //	@Tags		session
@@ -139,6 +209,115 @@ func (c *Controller) CreateSessionReplay(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, defaultHttpResponse)
 }
 
+// SetSessionLegalHold godoc
+//
+//	@Tags		session
+//	@Param		session_id	path		string			true	"session id"
+//	@Param		body		body		map[string]bool	true	"legal_hold"
+//	@Success	200			{object}	HttpResponse{data=model.Session}
+//	@Router		/session/:session_id/legal_hold [put]
+func (c *Controller) SetSessionLegalHold(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &errors.ApiError{Code: errors.ErrNoPerm, Data: map[string]any{"perm": acl.WRITE}})
+		return
+	}
+
+	req := &struct {
+		LegalHold bool `json:"legal_hold"`
+	}{}
+	if err := ctx.BindJSON(req); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	session, err := sessionService.SetLegalHold(ctx, ctx.Param("session_id"), req.LegalHold, currentUser.GetUid())
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			ctx.AbortWithError(http.StatusNotFound, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+			return
+		}
+		ctx.AbortWithError(http.StatusInternalServerError, &errors.ApiError{Code: errors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(session))
+}
+
+// GetSessionWebRequests godoc
+//
+//	@Tags		session
+//	@Param		page_index	query		int		true	"page_index"
+//	@Param		page_size	query		int		true	"page_size"
+//	@Param		session_id	path		string	true	"session id"
+//	@Param		method		query		string	false	"http method"
+//	@Param		status		query		int		false	"response status"
+//	@Param		search		query		string	false	"search in path"
+//	@Success	200			{object}	HttpResponse{data=ListData{list=[]model.SessionWebRequest}}
+//	@Router		/session/:session_id/web_request [get]
+func (c *Controller) GetSessionWebRequests(ctx *gin.Context) {
+	db := sessionService.BuildWebRequestQuery(ctx, ctx.Param("session_id"))
+	doGet[*model.SessionWebRequest](ctx, false, db, "")
+}
+
+// GetSessionWebRequestTimeline godoc
+//
+//	@Tags		session
+//	@Param		session_id	path		string	true	"session id"
+//	@Success	200			{object}	HttpResponse{data=model.WebRequestTimeline}
+//	@Router		/session/:session_id/web_request/timeline [get]
+func (c *Controller) GetSessionWebRequestTimeline(ctx *gin.Context) {
+	timeline, err := sessionService.GetWebRequestTimeline(ctx, ctx.Param("session_id"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusNotFound, &errors.ApiError{Code: errors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(timeline))
+}
+
+// GetSessionReplayTimeline godoc
+//
+//	@Tags		session
+//	@Param		session_id	path		string	true	"session id"
+//	@Success	200			{object}	HttpResponse{data=model.ReplayTimeline}
+//	@Router		/session/replay/:session_id/timeline [get]
+func (c *Controller) GetSessionReplayTimeline(ctx *gin.Context) {
+	timeline, err := sessionService.GetReplayTimeline(ctx, ctx.Param("session_id"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusNotFound, &errors.ApiError{Code: errors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(timeline))
+}
+
+// VerifySessionReplay godoc
+//
+//	@Tags		session
+//	@Param		session_id	path		string	true	"session id"
+//	@Success	200			{object}	HttpResponse{data=service.FileVerification}
+//	@Failure	409			{object}	HttpResponse{data=service.FileVerification}	"replay does not match its signed digest"
+//	@Router		/session/replay/:session_id/verify [get]
+func (c *Controller) VerifySessionReplay(ctx *gin.Context) {
+	result, err := sessionService.VerifySessionReplay(ctx, ctx.Param("session_id"))
+	if err != nil {
+		if stderrors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.AbortWithError(http.StatusNotFound, &errors.ApiError{Code: errors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+			return
+		}
+		ctx.AbortWithError(http.StatusInternalServerError, &errors.ApiError{Code: errors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+
+	// A tampered replay is a verification result, not a failure to verify
+	if !result.Valid {
+		ctx.JSON(http.StatusConflict, &HttpResponse{Code: http.StatusConflict, Message: "replay does not match its signed digest", Data: result})
+		return
+	}
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(result))
+}
+
 // GetSessionReplay godoc
 //
 //	@Tags		session
@@ -149,21 +328,51 @@ func (c *Controller) GetSessionReplay(ctx *gin.Context) {
 	sessionId := ctx.Param("session_id")
 
 	// Try to get replay from storage service or local file system
-	replayReader, err := sessionService.GetSessionReplay(ctx, sessionId)
+	replayReader, metadata, err := sessionService.GetSessionReplay(ctx, sessionId)
 	if err != nil {
 		ctx.AbortWithError(http.StatusNotFound, &errors.ApiError{Code: errors.ErrInternal, Data: map[string]any{"err": err}})
 		return
 	}
 	defer replayReader.Close()
 
-	// Stream the file content
-	filename := fmt.Sprintf("%s.cast", sessionId)
-	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-	ctx.Header("Content-Type", "application/octet-stream")
+	// Compressed recordings are passed through as stored to clients accepting their encoding, decompressed otherwise
+	var reader io.Reader = replayReader
+	if metadata.Encoding != "" {
+		ctx.Header("Vary", "Accept-Encoding")
+		if acceptsEncoding(ctx.GetHeader("Accept-Encoding"), metadata.Encoding) {
+			ctx.Header("Content-Encoding", metadata.Encoding)
+		} else {
+			decompressed, err := storage.Decompress(metadata.Encoding, io.NopCloser(replayReader))
+			if err != nil {
+				ctx.AbortWithError(http.StatusInternalServerError, &errors.ApiError{Code: errors.ErrInternal, Data: map[string]any{"err": err}})
+				return
+			}
+			defer decompressed.Close()
+			reader = decompressed
+		}
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", storage.TrimCompressedExtension(metadata.FileName)))
+	ctx.Header("Content-Type", lo.Ternary(metadata.MimeType != "", metadata.MimeType, "application/octet-stream"))
 
-	_, err = io.Copy(ctx.Writer, replayReader)
+	_, err = io.Copy(ctx.Writer, reader)
 	if err != nil {
 		logger.L().Error("Failed to stream replay file", zap.String("session_id", sessionId), zap.Error(err))
 		return
 	}
 }
+
+// acceptsEncoding tells whether an Accept-Encoding header allows encoding
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(name, encoding) && name != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			return cast.ToFloat64(q) > 0
+		}
+		return true
+	}
+	return false
+}
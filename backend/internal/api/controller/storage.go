@@ -403,3 +403,275 @@ func validateStorageConfig(config *model.StorageConfig) error {
 	}
 	return nil
 }
+
+// GetReplayIndexBackfill godoc
+//
+//	@Tags		storage
+//	@Summary	Get the state of the replay index backfill
+//	@Success	200	{object}	HttpResponse{data=model.MigrationRecord}
+//	@Router		/storage/replay-index/backfill [get]
+func (c *Controller) GetReplayIndexBackfill(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": acl.READ}})
+		return
+	}
+
+	record, err := service.GetReplayIndexBackfill(ctx)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, &myErrors.ApiError{Code: myErrors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(record))
+}
+
+// StartReplayIndexBackfill godoc
+//
+//	@Tags		storage
+//	@Summary	Scan storage providers again for replays missing from the replay index
+//	@Success	200	{object}	HttpResponse{data=map[string]bool}
+//	@Router		/storage/replay-index/backfill [post]
+func (c *Controller) StartReplayIndexBackfill(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": acl.WRITE}})
+		return
+	}
+
+	started, err := service.StartReplayIndexBackfill(true)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, &myErrors.ApiError{Code: myErrors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(map[string]bool{"started": started}))
+}
+
+// GetRetentionReport godoc
+//
+//	@Tags		storage
+//	@Param		id	path		int	true	"Storage ID"
+//	@Success	200	{object}	HttpResponse{data=service.RetentionReport}
+//	@Router		/storage/configs/:id/retention/report [get]
+func (c *Controller) GetRetentionReport(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": acl.READ}})
+		return
+	}
+
+	id, err := cast.ToIntE(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	config := &model.StorageConfig{}
+	if err := service.NewBaseService().GetById(ctx, id, config); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.AbortWithError(http.StatusNotFound, &myErrors.ApiError{Code: myErrors.ErrInternal, Data: map[string]any{"err": "storage config not found"}})
+			return
+		}
+		ctx.AbortWithError(http.StatusInternalServerError, &myErrors.ApiError{Code: myErrors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+
+	report, err := service.NewStorageCleanerService(service.DefaultStorageService).GetRetentionReport(ctx, config)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, &myErrors.ApiError{Code: myErrors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(report))
+}
+
+// GetEncryptionRotation godoc
+//
+//	@Tags		storage
+//	@Param		id	path		int	true	"Storage ID"
+//	@Success	200	{object}	HttpResponse{data=model.MigrationRecord}
+//	@Router		/storage/configs/:id/encryption/rotation [get]
+func (c *Controller) GetEncryptionRotation(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": acl.READ}})
+		return
+	}
+
+	config, ok := storageConfigFromParam(ctx)
+	if !ok {
+		return
+	}
+
+	record, err := service.GetEncryptionRotation(ctx, config.Name)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, &myErrors.ApiError{Code: myErrors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(record))
+}
+
+// StartEncryptionRotation godoc
+//
+//	@Tags		storage
+//	@Summary	Encrypt again the objects of a storage that are not under the current master key
+//	@Param		id	path		int	true	"Storage ID"
+//	@Success	200	{object}	HttpResponse{data=map[string]bool}
+//	@Router		/storage/configs/:id/encryption/rotation [post]
+func (c *Controller) StartEncryptionRotation(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": acl.WRITE}})
+		return
+	}
+
+	config, ok := storageConfigFromParam(ctx)
+	if !ok {
+		return
+	}
+
+	started, err := service.StartEncryptionRotation(config.Name)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(map[string]bool{"started": started}))
+}
+
+// storageConfigFromParam loads the storage config of the id path param, aborting the request when it fails
+func storageConfigFromParam(ctx *gin.Context) (*model.StorageConfig, bool) {
+	id, err := cast.ToIntE(ctx.Param("id"))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return nil, false
+	}
+
+	config := &model.StorageConfig{}
+	if err := service.NewBaseService().GetById(ctx, id, config); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.AbortWithError(http.StatusNotFound, &myErrors.ApiError{Code: myErrors.ErrInternal, Data: map[string]any{"err": "storage config not found"}})
+			return nil, false
+		}
+		ctx.AbortWithError(http.StatusInternalServerError, &myErrors.ApiError{Code: myErrors.ErrInternal, Data: map[string]any{"err": err}})
+		return nil, false
+	}
+
+	return config, true
+}
+
+// CreateStorageMigration godoc
+//
+//	@Tags		storage
+//	@Param		body	body		object{source_storage=string,target_storage=string,category=string,delete_source=bool}	true	"migration, empty category for every category"
+//	@Success	200		{object}	HttpResponse{data=model.StorageMigration}
+//	@Router		/storage/migrations [post]
+func (c *Controller) CreateStorageMigration(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": acl.WRITE}})
+		return
+	}
+	if service.DefaultStorageReplicationService == nil {
+		ctx.AbortWithError(http.StatusServiceUnavailable, &myErrors.ApiError{Code: myErrors.ErrInternal, Data: map[string]any{"err": "storage replication not initialized"}})
+		return
+	}
+
+	req := &struct {
+		SourceStorage string `json:"source_storage" binding:"required"`
+		TargetStorage string `json:"target_storage" binding:"required"`
+		Category      string `json:"category"`
+		DeleteSource  bool   `json:"delete_source"`
+	}{}
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	migration, err := service.DefaultStorageReplicationService.StartMigration(ctx, req.SourceStorage, req.TargetStorage, req.Category, req.DeleteSource, currentUser.GetUid())
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(migration))
+}
+
+// ListStorageMigrations godoc
+//
+//	@Tags		storage
+//	@Success	200	{object}	HttpResponse{data=[]model.StorageMigration}
+//	@Router		/storage/migrations [get]
+func (c *Controller) ListStorageMigrations(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": acl.READ}})
+		return
+	}
+	if service.DefaultStorageReplicationService == nil {
+		ctx.AbortWithError(http.StatusServiceUnavailable, &myErrors.ApiError{Code: myErrors.ErrInternal, Data: map[string]any{"err": "storage replication not initialized"}})
+		return
+	}
+
+	migrations, err := service.DefaultStorageReplicationService.GetMigrations(ctx)
+	if err != nil {
+		ctx.AbortWithError(http.StatusInternalServerError, &myErrors.ApiError{Code: myErrors.ErrInternal, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(migrations))
+}
+
+// GetStorageMigration godoc
+//
+//	@Tags		storage
+//	@Param		id	path		int	true	"migration id"
+//	@Success	200	{object}	HttpResponse{data=model.StorageMigration}
+//	@Router		/storage/migrations/:id [get]
+func (c *Controller) GetStorageMigration(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": acl.READ}})
+		return
+	}
+	if service.DefaultStorageReplicationService == nil {
+		ctx.AbortWithError(http.StatusServiceUnavailable, &myErrors.ApiError{Code: myErrors.ErrInternal, Data: map[string]any{"err": "storage replication not initialized"}})
+		return
+	}
+
+	migration, err := service.DefaultStorageReplicationService.GetMigration(ctx, cast.ToInt(ctx.Param("id")))
+	if err != nil {
+		ctx.AbortWithError(http.StatusNotFound, &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(migration))
+}
+
+// ResumeStorageMigration godoc
+//
+//	@Tags		storage
+//	@Param		id	path		int	true	"migration id"
+//	@Success	200	{object}	HttpResponse{data=model.StorageMigration}
+//	@Router		/storage/migrations/:id/resume [post]
+func (c *Controller) ResumeStorageMigration(ctx *gin.Context) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	if !acl.IsAdmin(currentUser) {
+		ctx.AbortWithError(http.StatusForbidden, &myErrors.ApiError{Code: myErrors.ErrNoPerm, Data: map[string]any{"perm": acl.WRITE}})
+		return
+	}
+	if service.DefaultStorageReplicationService == nil {
+		ctx.AbortWithError(http.StatusServiceUnavailable, &myErrors.ApiError{Code: myErrors.ErrInternal, Data: map[string]any{"err": "storage replication not initialized"}})
+		return
+	}
+
+	migration, err := service.DefaultStorageReplicationService.ResumeMigration(ctx, cast.ToInt(ctx.Param("id")))
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": err}})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewHttpResponseWithData(migration))
+}
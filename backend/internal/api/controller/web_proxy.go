@@ -1,9 +1,11 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -87,7 +89,11 @@ func (c *WebProxyController) GetWebAssetConfig(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, asset.WebConfig)
+	if asset.WebConfig == nil {
+		ctx.JSON(http.StatusOK, asset.WebConfig)
+		return
+	}
+	ctx.JSON(http.StatusOK, asset.WebConfig.Masked())
 }
 
 // StartWebSession start a new web session
@@ -147,6 +153,12 @@ func (c *WebProxyController) ProxyWebRequest(ctx *gin.Context) {
 
 	// Validate session and check permissions
 	if err := web_proxy.ValidateSessionAndPermissions(ctx, proxyCtx, c.checkWebAccessControls); err != nil {
+		var denied *web_proxy.AccessDeniedError
+		if errors.As(err, &denied) {
+			ctx.Header("Content-Type", "text/html; charset=utf-8")
+			ctx.String(http.StatusForbidden, web_proxy.RenderAccessDeniedPage(denied.Reason, denied.Details))
+			return
+		}
 		if strings.Contains(err.Error(), "invalid or expired session") || strings.Contains(err.Error(), "session expired") {
 			c.renderSessionExpiredPage(ctx, err.Error())
 		} else {
@@ -155,8 +167,22 @@ func (c *WebProxyController) ProxyWebRequest(ctx *gin.Context) {
 		return
 	}
 
+	// Uploads are checked against the permissions and limits of the asset before anything reaches the target
+	uploads, cleanupUpload, err := web_proxy.InspectUpload(proxyCtx.Session, ctx.Request)
+	if err != nil {
+		var denied *web_proxy.AccessDeniedError
+		if errors.As(err, &denied) {
+			ctx.Header("Content-Type", "text/html; charset=utf-8")
+			ctx.String(http.StatusForbidden, web_proxy.RenderAccessDeniedPage(denied.Reason, denied.Details))
+			return
+		}
+		c.renderErrorPage(ctx, "server_error", "Upload Failed", err.Error(), "The upload could not be inspected.")
+		return
+	}
+	defer cleanupUpload()
+
 	// Setup reverse proxy
-	proxy, err := web_proxy.SetupReverseProxy(ctx, proxyCtx, c.buildTargetURLWithHost, c.processHTMLResponse, c.recordWebActivity, c.isSameDomainOrSubdomain)
+	proxy, err := web_proxy.SetupReverseProxy(ctx, proxyCtx, c.buildTargetURLWithHost, c.processHTMLResponse, c.isSameDomainOrSubdomain)
 	if err != nil {
 		c.renderErrorPage(ctx, "server_error", "Proxy Setup Failed", err.Error(), "Failed to establish connection to the target server.")
 		return
@@ -164,6 +190,12 @@ func (c *WebProxyController) ProxyWebRequest(ctx *gin.Context) {
 
 	ctx.Header("Cache-Control", "no-cache")
 
+	// Record the uploads and the request once the response is written, recovered panics included
+	defer web_proxy.RecordWebUploads(proxyCtx.Session, ctx, uploads)
+	startedAt := time.Now()
+	fields := web_proxy.CaptureRequestFields(proxyCtx.Session, ctx.Request)
+	defer c.recordWebActivity(proxyCtx.Session, ctx, startedAt, fields)
+
 	// Add panic recovery for proxy requests
 	defer func() {
 		if r := recover(); r != nil {
@@ -333,8 +365,8 @@ func (c *WebProxyController) CleanupWebSession(ctx *gin.Context) {
 }
 
 // recordWebActivity records web session activity for audit
-func (c *WebProxyController) recordWebActivity(session *WebProxySession, req *http.Request) {
-	web_proxy.RecordWebActivity(session.SessionId, &gin.Context{Request: req})
+func (c *WebProxyController) recordWebActivity(session *WebProxySession, ctx *gin.Context, startedAt time.Time, fields map[string]string) {
+	web_proxy.RecordWebActivity(session, ctx, startedAt, fields)
 }
 
 // extractAssetIDFromHost extracts asset ID from subdomain host
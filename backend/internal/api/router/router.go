@@ -122,9 +122,24 @@ func SetupRouter(r *gin.Engine) {
 		{
 			session.GET("", c.GetSessions)
 			session.GET("/:session_id/cmd", c.GetSessionCmds)
+			session.GET("/:session_id/clipboard", c.GetSessionClipboards)
+			session.GET("/:session_id/web_request", c.GetSessionWebRequests)
+			session.GET("/:session_id/web_request/timeline", c.GetSessionWebRequestTimeline)
+			session.PUT("/:session_id/legal_hold", c.SetSessionLegalHold)
+			session.GET("/cmd/search", c.SearchSessionCmds)
 			session.GET("/option/asset", c.GetSessionOptionAsset)
 			session.GET("/option/clientip", c.GetSessionOptionClientIp)
 			session.GET("/replay/:session_id", c.GetSessionReplay)
+			session.GET("/replay/:session_id/timeline", c.GetSessionReplayTimeline)
+			session.GET("/replay/:session_id/verify", c.VerifySessionReplay)
+			session.POST("/replay/:session_id/video", c.CreateReplayVideo)
+			session.GET("/replay/:session_id/video", c.GetReplayVideos)
+			session.GET("/replay/:session_id/video/:id", c.GetReplayVideo)
+			session.GET("/replay/:session_id/video/:id/download", c.DownloadReplayVideo)
+			session.POST("/export", c.CreateAuditExport)
+			session.GET("/export", c.GetAuditExports)
+			session.GET("/export/:id", c.GetAuditExport)
+			session.GET("/export/:id/download", c.DownloadAuditExport)
 		}
 
 		connect := v1.Group("connect")
@@ -136,6 +151,17 @@ func SetupRouter(r *gin.Engine) {
 			connect.GET("/webssh", sshsrv.HandleWebSSH)
 		}
 
+		k8s := v1.Group("kubernetes")
+		{
+			k8s.GET("/:asset_id/:account_id/namespaces", c.GetKubernetesNamespaces)
+			k8s.GET("/:asset_id/:account_id/pods", c.GetKubernetesPods)
+		}
+
+		dockerGroup := v1.Group("docker")
+		{
+			dockerGroup.GET("/:asset_id/:account_id/containers", c.GetDockerContainers)
+		}
+
 		file := v1.Group("file")
 		{
 			file.GET("/history", c.GetFileHistory)
@@ -233,10 +259,19 @@ func SetupRouter(r *gin.Engine) {
 			storage.DELETE("/configs/:id", c.DeleteStorageConfig)
 			storage.POST("/test-connection", c.TestStorageConnection)
 			storage.GET("/health", c.GetStorageHealth)
-			// storage.GET("/metrics", c.GetStorageMetrics)
-			// storage.POST("/metrics/refresh", c.RefreshStorageMetrics)
+			storage.GET("/metrics", c.GetStorageMetrics)
+			storage.POST("/metrics/refresh", c.RefreshStorageMetrics)
 			storage.PUT("/configs/:id/set-primary", c.SetPrimaryStorage)
 			storage.PUT("/configs/:id/toggle", c.ToggleStorageProvider)
+			storage.GET("/configs/:id/retention/report", c.GetRetentionReport)
+			storage.GET("/configs/:id/encryption/rotation", c.GetEncryptionRotation)
+			storage.POST("/configs/:id/encryption/rotation", c.StartEncryptionRotation)
+			storage.GET("/replay-index/backfill", c.GetReplayIndexBackfill)
+			storage.POST("/replay-index/backfill", c.StartReplayIndexBackfill)
+			storage.GET("/migrations", c.ListStorageMigrations)
+			storage.POST("/migrations", c.CreateStorageMigration)
+			storage.GET("/migrations/:id", c.GetStorageMigration)
+			storage.POST("/migrations/:id/resume", c.ResumeStorageMigration)
 		}
 
 		// Time template management routes
@@ -201,6 +201,15 @@ func DoConnect(ctx *gin.Context, ws *websocket.Conn) (sess *gsession.Session, er
 			}
 		}
 	}
+	if sess.IsKubernetes() || sess.IsDocker() {
+		if sess.Workload, err = parseWorkloadTarget(ctx, sess, asset); err != nil {
+			return
+		}
+	}
+	// Only browsers can render guacd, ssh clients always get the native terminal
+	if asset.TerminalBackend == model.TerminalBackendGuacd && sess.SessionType == model.SESSIONTYPE_WEB {
+		sess.TerminalBackend = model.TerminalBackendGuacd
+	}
 	if !sess.IsGuacd() {
 		w, h := cast.ToInt(ctx.Query("w")), cast.ToInt(ctx.Query("h"))
 		sess.SshParser = gsession.NewParser(sess.SessionId, w, h)
@@ -219,6 +228,7 @@ func DoConnect(ctx *gin.Context, ws *websocket.Conn) (sess *gsession.Session, er
 		if sess.SshRecoder, err = gsession.NewAsciinema(sess.SessionId, w, h); err != nil {
 			return sess, err
 		}
+		sess.SshParser.SetRecorder(sess.SshRecoder)
 	}
 	switch sess.SessionType {
 	case model.SESSIONTYPE_WEB:
@@ -259,6 +269,21 @@ func DoConnect(ctx *gin.Context, ws *websocket.Conn) (sess *gsession.Session, er
 		return sess, err
 	}
 
+	sess.AuthRuleId = result.GetResult(model.ActionConnect).RuleId
+	watermarkData := service.WatermarkData{
+		User:      sess.UserName,
+		Uid:       sess.Uid,
+		ClientIp:  sess.ClientIp,
+		SessionId: sess.SessionId,
+		Asset:     asset.Name,
+		AssetId:   asset.Id,
+	}
+	// Browsers draw the watermark of native terminals, guacd ones are drawn with an ASCII font
+	if sess.IsGuacd() {
+		watermarkData = watermarkData.Drawable()
+	}
+	sess.Watermark = service.RenderWatermark(result.GetResult(model.ActionConnect), watermarkData)
+
 	// Set permissions in session for protocol-specific usage
 	if protocol == "http" || protocol == "https" {
 		// For Web protocols, store all relevant permissions
@@ -274,19 +299,31 @@ func DoConnect(ctx *gin.Context, ws *websocket.Conn) (sess *gsession.Session, er
 
 	// For SSH, check if user has any file permissions before initializing SFTP
 	hasFilePermissions := false
-	if protocol == "ssh" {
+	if protocol == "ssh" && !sess.IsGuacd() {
 		hasFilePermissions = result.IsAllowed(model.ActionFileUpload) || result.IsAllowed(model.ActionFileDownload)
 	}
 
 	switch protocol {
 	case "ssh":
+		if sess.IsGuacd() {
+			go protocols.ConnectGuacd(ctx, sess, asset, account, gateway)
+			break
+		}
 		go protocols.ConnectSsh(ctx, sess, asset, account, gateway)
-	case "redis", "mysql", "mongodb", "postgresql":
+	case "redis", "mysql", "mongodb", "postgresql", "mssql", "oracle":
 		go db.ConnectDB(sess, asset, account, gateway)
 	case "telnet":
+		if sess.IsGuacd() {
+			go protocols.ConnectGuacd(ctx, sess, asset, account, gateway)
+			break
+		}
 		go protocols.ConnectTelnet(ctx, sess, asset, account, gateway)
 	case "vnc", "rdp":
 		go protocols.ConnectGuacd(ctx, sess, asset, account, gateway)
+	case "kubernetes":
+		go protocols.ConnectKubernetes(ctx, sess, asset, account, gateway)
+	case "docker":
+		go protocols.ConnectDocker(ctx, sess, asset, account, gateway)
 	case "http", "https":
 		// Web assets are handled through separate web proxy API endpoints
 		err = &myErrors.ApiError{Code: myErrors.ErrConnectServer, Data: map[string]any{"err": "Web assets should use web proxy API"}}
@@ -338,6 +375,46 @@ func DoConnect(ctx *gin.Context, ws *websocket.Conn) (sess *gsession.Session, er
 	return
 }
 
+// parseWorkloadTarget reads the target container from either namespace/pod/container
+// query params or a single target param: namespace/pod[/container] for kubernetes, the container name for docker
+func parseWorkloadTarget(ctx *gin.Context, sess *gsession.Session, asset *model.Asset) (target *model.WorkloadTarget, err error) {
+	target = &model.WorkloadTarget{
+		Namespace: ctx.Query("namespace"),
+		Pod:       ctx.Query("pod"),
+		Container: ctx.Query("container"),
+	}
+
+	if sess.IsDocker() {
+		target.Namespace, target.Pod = "", ""
+		if t := ctx.Query("target"); t != "" {
+			target.Container = t
+		}
+		if target.Container == "" {
+			err = &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": "container is required"}}
+		}
+		return
+	}
+
+	if t := ctx.Query("target"); t != "" {
+		parts := strings.SplitN(t, "/", 3)
+		if len(parts) < 2 {
+			err = &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": "target should be namespace/pod[/container]"}}
+			return
+		}
+		target.Namespace, target.Pod = parts[0], parts[1]
+		if len(parts) == 3 {
+			target.Container = parts[2]
+		}
+	}
+	if target.Namespace == "" && asset.KubernetesConfig != nil {
+		target.Namespace = asset.KubernetesConfig.DefaultNamespace
+	}
+	if target.Namespace == "" || target.Pod == "" {
+		err = &myErrors.ApiError{Code: myErrors.ErrInvalidArgument, Data: map[string]any{"err": "namespace and pod are required"}}
+	}
+	return
+}
+
 // HandleTerm handles terminal sessions
 func HandleTerm(sess *gsession.Session, ctx *gin.Context) (err error) {
 	defer func() {
@@ -365,6 +442,8 @@ func HandleTerm(sess *gsession.Session, ctx *gin.Context) (err error) {
 			logger.L().Error("upsert session failed", zap.Error(err))
 		}
 	}()
+	protocols.WriteWatermark(sess)
+
 	chs := sess.Chans
 	tk, tk1s, tk1m := time.NewTicker(time.Millisecond*100), time.NewTicker(time.Second), time.NewTicker(time.Minute)
 	assetService := service.NewAssetService()
@@ -388,6 +467,7 @@ func HandleTerm(sess *gsession.Session, ctx *gin.Context) (err error) {
 				protocols.WriteErrMsg(sess, msg)
 				return &myErrors.ApiError{Code: myErrors.ErrIdleTimeout, Data: map[string]any{"second": model.GlobalConfig.Load().Timeout}}
 			case <-tk1m.C:
+				protocols.RefreshWatermark(sess)
 				asset, err := assetService.GetById(sess.Gctx, sess.AssetId)
 				if err != nil {
 					continue
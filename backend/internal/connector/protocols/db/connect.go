@@ -20,7 +20,7 @@ import (
 	"github.com/veops/oneterm/pkg/logger"
 )
 
-// connectDB connects to other protocols (Redis, MySQL, PostgreSQL, MongoDB etc.)
+// connectDB connects to other protocols (Redis, MySQL, PostgreSQL, MongoDB, MSSQL, Oracle etc.)
 func connectDB(sess *gsession.Session, asset *model.Asset, account *model.Account, gateway *model.Gateway) (err error) {
 	chs := sess.Chans
 	defer func() {
@@ -52,13 +52,27 @@ func connectDB(sess *gsession.Session, asset *model.Asset, account *model.Accoun
 		clientConfig = getPostgreSQLConfig(ip, port, account)
 	case sess.IsMongo():
 		clientConfig = getMongoDBConfig(ip, port, account)
+	case sess.IsMssql():
+		clientConfig = getMSSQLConfig(ip, port, account)
+	case sess.IsOracle():
+		if clientConfig, err = getOracleConfig(ip, port, account); err != nil {
+			return err
+		}
 	default:
 		return fmt.Errorf("unsupported protocol: %s", sess.Protocol)
 	}
+	if clientConfig.Cleanup != nil {
+		defer func() {
+			if err != nil {
+				clientConfig.Cleanup()
+			}
+		}()
+	}
 
 	// Create command and pseudo-terminal
 	cmd := exec.CommandContext(sess.Gctx, clientConfig.Command, clientConfig.Args...)
 	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
+	cmd.Env = append(cmd.Env, clientConfig.Env...)
 	ptmx, err := pty.Start(cmd)
 	if err != nil {
 		logger.L().Error("Failed to start database client with pty", zap.Error(err), zap.String("command", clientConfig.Command))
@@ -83,6 +97,9 @@ func connectDB(sess *gsession.Session, asset *model.Asset, account *model.Accoun
 	// Monitor process exit
 	sess.G.Go(func() error {
 		err := cmd.Wait()
+		if clientConfig.Cleanup != nil {
+			clientConfig.Cleanup()
+		}
 
 		// Log process exit - only log as error if there was an actual error
 		if err != nil {
@@ -9,7 +9,10 @@ import (
 type DBClientConfig struct {
 	Command     string
 	Args        []string
+	Env         []string
 	ExitAliases []string
+	// Cleanup runs once the client exited, nil when there is nothing to clean
+	Cleanup func()
 }
 
 // ConnectDB connects to a database with the given session, asset, account, and gateway
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/veops/oneterm/internal/model"
+)
+
+// getMSSQLConfig returns Microsoft SQL Server client configuration
+func getMSSQLConfig(ip string, port int, account *model.Account) DBClientConfig {
+	// Account may carry a default database in username/database format
+	user, database, _ := strings.Cut(account.Account, "/")
+
+	args := []string{
+		"-S", fmt.Sprintf("tcp:%s,%d", ip, port),
+		"-U", user,
+		"-C", // Trust server certificate, legacy servers usually ship self-signed ones
+	}
+	if database != "" {
+		args = append(args, "-d", database)
+	}
+
+	// Pass password via environment to keep it out of the process list
+	var env []string
+	if account.Password != "" {
+		env = append(env, fmt.Sprintf("SQLCMDPASSWORD=%s", account.Password))
+	}
+
+	return DBClientConfig{
+		Command:     "sqlcmd",
+		Args:        args,
+		Env:         env,
+		ExitAliases: []string{"exit", "quit", ":exit", ":quit"},
+	}
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/veops/oneterm/internal/model"
+)
+
+const (
+	defaultOracleService = "ORCL"
+)
+
+// getOracleConfig returns Oracle client configuration
+func getOracleConfig(ip string, port int, account *model.Account) (DBClientConfig, error) {
+	// Account may carry the service name in username/service format
+	user, service, _ := strings.Cut(account.Account, "/")
+	if service == "" {
+		service = defaultOracleService
+	}
+	// The connect command is a line of the script, a quote or a line break in a field would end it early and the rest
+	// would run as sqlplus commands, HOST included. Oracle cannot quote a password holding a double quote anyway.
+	for _, field := range [][2]string{{"user", user}, {"password", account.Password}, {"service", service}} {
+		if strings.ContainsAny(field[1], "\"\r\n") {
+			return DBClientConfig{}, fmt.Errorf("oracle %s must not contain double quotes or line breaks", field[0])
+		}
+	}
+
+	// sqlplus reads passwords from neither the environment nor a pipe, the connect command goes into a private
+	// script that removes itself once run, keeping the password out of the process list and the terminal
+	dir, err := os.MkdirTemp("", "oneterm-oracle-*")
+	if err != nil {
+		return DBClientConfig{}, fmt.Errorf("failed to create oracle connect script: %w", err)
+	}
+	script := filepath.Join(dir, "connect.sql")
+	// Easy connect syntax, password quoted to allow special characters
+	content := fmt.Sprintf("CONNECT %s/\"%s\"@//%s:%d/%s\nHOST rm -rf %s\n", user, account.Password, ip, port, service, dir)
+	if err = os.WriteFile(script, []byte(content), 0600); err != nil {
+		os.RemoveAll(dir)
+		return DBClientConfig{}, fmt.Errorf("failed to write oracle connect script: %w", err)
+	}
+
+	return DBClientConfig{
+		Command: "sqlplus",
+		// -L makes sqlplus fail instead of prompting again on bad credentials
+		Args:        []string{"-L", "/nolog", "@" + script},
+		ExitAliases: []string{"exit", "quit"},
+		// HOST may be disabled by the product profile
+		Cleanup: func() { os.RemoveAll(dir) },
+	}, nil
+}
@@ -0,0 +1,52 @@
+package protocols
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/docker"
+	"github.com/veops/oneterm/internal/model"
+	gsession "github.com/veops/oneterm/internal/session"
+	"github.com/veops/oneterm/internal/tunneling"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+// ConnectDocker opens an exec shell into a container of a docker engine
+func ConnectDocker(ctx *gin.Context, sess *gsession.Session, asset *model.Asset, account *model.Account, gateway *model.Gateway) (err error) {
+	w, h := cast.ToInt(ctx.Query("w")), cast.ToInt(ctx.Query("h"))
+	chs := sess.Chans
+	defer func() {
+		if err != nil {
+			chs.ErrChan <- err
+		}
+	}()
+
+	ip, port, err := tunneling.Proxy(false, sess.SessionId, "docker", asset, gateway)
+	if err != nil {
+		return
+	}
+	defer tunneling.CloseTunnels(sess.SessionId)
+
+	cli, err := docker.NewClient(ip, port, strings.Split(asset.Ip, ":")[0], asset.DockerConfig, account)
+	if err != nil {
+		return
+	}
+
+	user, shell := "", ""
+	if asset.DockerConfig != nil {
+		user, shell = asset.DockerConfig.User, asset.DockerConfig.Shell
+	}
+
+	stream, err := cli.Exec(sess.Gctx, sess.Workload.Container, user, containerShell(shell))
+	if err != nil {
+		logger.L().Error("docker exec failed", zap.String("container", sess.Workload.Container), zap.Error(err))
+		return
+	}
+
+	pipeExecStream(sess, stream, w, h)
+
+	return
+}
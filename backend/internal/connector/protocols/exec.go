@@ -0,0 +1,96 @@
+package protocols
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+
+	gsession "github.com/veops/oneterm/internal/session"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+var (
+	// defaultContainerShell prefers bash and falls back to sh for minimal images
+	defaultContainerShell = []string{"/bin/sh", "-c", "command -v bash >/dev/null 2>&1 && exec bash || exec sh"}
+)
+
+// execStream is an interactive tty exec session inside a container
+type execStream interface {
+	io.ReadWriteCloser
+	Resize(w, h int) error
+	Err() error
+}
+
+// containerShell returns the command started in containers
+func containerShell(shell string) []string {
+	if shell == "" {
+		return defaultContainerShell
+	}
+	return []string{shell}
+}
+
+// pipeExecStream wires an exec stream into the terminal pipeline and blocks until the session ends
+func pipeExecStream(sess *gsession.Session, stream execStream, w, h int) {
+	chs := sess.Chans
+	defer stream.Close()
+
+	if w > 0 && h > 0 {
+		if err := stream.Resize(w, h); err != nil {
+			logger.L().Warn("exec initial resize failed", zap.Error(err))
+		}
+	}
+
+	chs.ErrChan <- nil
+
+	sess.G.Go(func() error {
+		defer sess.Once.Do(func() { close(chs.AwayChan) })
+		buf := bufio.NewReader(stream)
+		for {
+			rn, size, err := buf.ReadRune()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					if err := stream.Err(); err != nil {
+						return fmt.Errorf("exec end with error: %w", err)
+					}
+					return nil
+				}
+				return err
+			}
+			if size <= 0 || rn == utf8.RuneError {
+				continue
+			}
+			p := make([]byte, utf8.RuneLen(rn))
+			utf8.EncodeRune(p, rn)
+			chs.OutChan <- p
+		}
+	})
+	sess.G.Go(func() error {
+		_, err := io.Copy(stream, chs.Rin)
+		return err
+	})
+	sess.G.Go(func() error {
+		defer stream.Close()
+		for {
+			select {
+			case <-sess.Gctx.Done():
+				return nil
+			case <-chs.AwayChan:
+				// Normal termination - return sentinel error
+				return ErrSessionClosed
+			case window := <-chs.WindowChan:
+				if err := stream.Resize(window.Width, window.Height); err != nil {
+					logger.L().Warn("reset window size failed", zap.Error(err))
+					continue
+				}
+				sess.SshRecoder.Resize(window.Width, window.Height)
+				sess.SshParser.Resize(window.Width, window.Height)
+			}
+		}
+	})
+
+	sess.G.Wait()
+}
@@ -1,7 +1,10 @@
 package protocols
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -16,6 +19,7 @@ import (
 	"github.com/veops/oneterm/internal/model"
 	"github.com/veops/oneterm/internal/service"
 	gsession "github.com/veops/oneterm/internal/session"
+	"github.com/veops/oneterm/pkg/config"
 	myErrors "github.com/veops/oneterm/pkg/errors"
 	"github.com/veops/oneterm/pkg/logger"
 )
@@ -58,7 +62,14 @@ func ConnectGuacd(ctx *gin.Context, sess *gsession.Session, asset *model.Asset,
 		cleanProtocol = strings.Split(sess.Protocol, ":")[0]
 	}
 
-	t, err := guacd.NewTunnel("", sess.SessionId, w, h, dpi, cleanProtocol, asset, account, gateway, permissions)
+	// Terminal sessions get their look from the user preference and the command policy through the typescript
+	var terminal *guacdTerminal
+	var terminalOpts *guacd.TerminalOptions
+	if sess.IsGuacdTerminal() {
+		terminal, terminalOpts = newGuacdTerminal(ctx, sess, w, h, dpi)
+	}
+
+	t, err := guacd.NewTunnel("", sess.SessionId, w, h, dpi, cleanProtocol, asset, account, gateway, permissions, terminalOpts)
 	if err != nil {
 		logger.L().Error("guacd tunnel failed", zap.Error(err))
 		return
@@ -70,6 +81,23 @@ func ConnectGuacd(ctx *gin.Context, sess *gsession.Session, asset *model.Asset,
 
 	chs.ErrChan <- nil
 
+	var watermark *guacd.Watermark
+	if sess.Watermark != "" {
+		var wmErr error
+		if watermark, wmErr = guacd.NewWatermark(service.WatermarkAt(sess.Watermark, time.Now())); wmErr != nil {
+			logger.L().Warn("Failed to render watermark", zap.String("sessionId", sess.SessionId), zap.Error(wmErr))
+		}
+	}
+
+	// Record typed text and clipboard transfers, enforcing the clipboard limits of the matched rules
+	audit := newGuacdAuditor(sess.SessionId, batchResult, account, terminal, watermark, sess.Watermark)
+	defer audit.Close()
+	if terminal != nil {
+		sess.G.Go(func() error {
+			return terminal.Run(sess.Gctx)
+		})
+	}
+
 	sess.G.Go(func() error {
 		for {
 			select {
@@ -80,6 +108,9 @@ func ConnectGuacd(ctx *gin.Context, sess *gsession.Session, asset *model.Asset,
 				if err != nil {
 					return err
 				}
+				if p, err = audit.FromServer(p); err != nil {
+					return err
+				}
 				if len(p) <= 0 {
 					continue
 				}
@@ -96,7 +127,13 @@ func ConnectGuacd(ctx *gin.Context, sess *gsession.Session, asset *model.Asset,
 				// Normal termination - return sentinel error  
 				return ErrSessionClosed
 			case in := <-chs.InChan:
-				t.Write(in)
+				in, err := audit.FromClient(in)
+				if err != nil {
+					return err
+				}
+				if len(in) > 0 {
+					t.Write(in)
+				}
 			}
 		}
 	})
@@ -116,6 +153,7 @@ func HandleGuacd(sess *gsession.Session) (err error) {
 			logger.L().Error("offline guacd session failed", zap.Error(err))
 			return
 		}
+		go ingestGuacdRecording(sess.Session)
 	}()
 	chs := sess.Chans
 	tk := time.NewTicker(time.Minute)
@@ -156,6 +194,43 @@ func HandleGuacd(sess *gsession.Session) (err error) {
 	return
 }
 
+// guacdRecordingPolls is how many seconds a recording gets to stop growing before it is ingested
+const guacdRecordingPolls = 60
+
+// ingestGuacdRecording moves the recording guacd wrote for a session into storage once guacd has finished writing it
+func ingestGuacdRecording(session *model.Session) {
+	if service.DefaultStorageService == nil {
+		return
+	}
+	dir := lo.CoalesceOrEmpty(config.Cfg.Session.GuacdRecordingDir, config.Cfg.Session.ReplayDir)
+	path := filepath.Join(dir, session.SessionId)
+
+	// guacd flushes the recording asynchronously after the tunnel is closed, wait for its size to settle. A recording
+	// still growing is left in place, storing it would keep a truncated copy and remove the raw one.
+	size, settled := int64(-1), false
+	for i := 0; i < guacdRecordingPolls && !settled; i++ {
+		time.Sleep(time.Second)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		settled = info.Size() == size
+		size = info.Size()
+	}
+	if size < 0 {
+		logger.L().Warn("guacd recording not found", zap.String("id", session.SessionId), zap.String("path", path))
+		return
+	}
+	if !settled {
+		logger.L().Error("guacd recording still growing, left in place", zap.String("id", session.SessionId), zap.String("path", path), zap.Int64("size", size))
+		return
+	}
+
+	if err := service.DefaultStorageService.SaveGuacdRecording(context.Background(), session); err != nil {
+		logger.L().Error("ingest guacd recording failed", zap.String("id", session.SessionId), zap.Error(err))
+	}
+}
+
 // MonitGuacd handles monitoring of Guacamole sessions
 func MonitGuacd(ctx *gin.Context, sess *gsession.Session, chs *gsession.SessionChans, ws *websocket.Conn) (err error) {
 	w, h, dpi := cast.ToInt(ctx.Query("w")), cast.ToInt(ctx.Query("h")), cast.ToInt(ctx.Query("dpi"))
@@ -165,7 +240,7 @@ func MonitGuacd(ctx *gin.Context, sess *gsession.Session, chs *gsession.SessionC
 	}()
 
 	// For monitoring, no permissions needed since it's read-only
-	t, err := guacd.NewTunnel(sess.ConnectionId, "", w, h, dpi, ":", nil, nil, nil, nil)
+	t, err := guacd.NewTunnel(sess.ConnectionId, "", w, h, dpi, ":", nil, nil, nil, nil, nil)
 	if err != nil {
 		logger.L().Error("guacd tunnel failed", zap.Error(err))
 		return
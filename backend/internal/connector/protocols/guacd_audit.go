@@ -0,0 +1,468 @@
+package protocols
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/guacd"
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/service"
+	"github.com/veops/oneterm/pkg/config"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+const (
+	// maxTypedLine bounds the typed text kept before it is written as a command
+	maxTypedLine = 1024
+	// maxPendingInstruction bounds the bytes of an instruction waiting for the rest of it, guacd itself accepts
+	// instructions of up to 8192 code points
+	maxPendingInstruction = 64 * 1024
+
+	// maxPasteCheck is the clipboard size of guacd terminals, what is past it is never pasted
+	maxPasteCheck = 256 * 1024
+
+	maskedSecret = "******"
+)
+
+// X11 keysyms handled by the keystroke reconstruction
+const (
+	keysymBackSpace = 0xff08
+	keysymTab       = 0xff09
+	keysymReturn    = 0xff0d
+	keysymKpEnter   = 0xff8d
+	keysymUnicode   = 0x01000000
+)
+
+var (
+	keypadKeysyms = map[int]rune{
+		0xffaa: '*', 0xffab: '+', 0xffad: '-', 0xffae: '.', 0xffaf: '/',
+		0xffb0: '0', 0xffb1: '1', 0xffb2: '2', 0xffb3: '3', 0xffb4: '4',
+		0xffb5: '5', 0xffb6: '6', 0xffb7: '7', 0xffb8: '8', 0xffb9: '9',
+	}
+	modifierKeysyms = map[int]string{
+		0xffe3: "Ctrl", 0xffe4: "Ctrl",
+		0xffe7: "Meta", 0xffe8: "Meta",
+		0xffe9: "Alt", 0xffea: "Alt",
+		0xffeb: "Super", 0xffec: "Super",
+	}
+)
+
+// guacdAuditor inspects the instructions relayed between the browser and guacd. What the user types is rebuilt
+// into session commands and clipboard transfers are recorded, transfers above the limits of the authorization
+// rule are dropped. The watermark is drawn over the display whenever it is resized. Each direction is relayed by
+// a single goroutine, so no locking is needed. Instructions split over several reads are held until they are
+// complete, malformed data ends the session instead of being relayed unchecked.
+type guacdAuditor struct {
+	sessionId      string
+	sessionService *service.SessionService
+	contentLimit   int
+
+	// Typed text is only rebuilt when enabled, the password of the account is masked in it
+	recordKeys bool
+	secrets    []string
+
+	fromServer []byte
+	fromClient []byte
+
+	copies *clipboardTracker
+	pastes *clipboardTracker
+
+	// Terminal sessions parse commands from the typescript instead of rebuilding typed text
+	terminal *guacdTerminal
+
+	watermark *guacd.Watermark
+	// The watermark text follows the clock when it shows the time, it is drawn again once the minute changed
+	watermarkText  string
+	watermarkDrawn time.Time
+
+	line      []rune
+	modifiers map[int]bool
+}
+
+// clipboardTracker follows the clipboard streams sent in one direction
+type clipboardTracker struct {
+	direction string
+	limit     int
+	streams   map[string]*clipboardStream
+
+	// check refuses text holding a forbidden command, pastes to terminals submit their lines without keys
+	check func(text string) (string, bool)
+}
+
+type clipboardStream struct {
+	mimeType  string
+	size      int64
+	content   []byte
+	truncated bool
+	blocked   bool
+	held      bytes.Buffer // instructions kept back until the stream ends, only when a limit or a check applies
+	text      []byte       // content given to the check
+}
+
+func newGuacdAuditor(sessionId string, batchResult *model.BatchAuthResult, account *model.Account, terminal *guacdTerminal, watermark *guacd.Watermark, watermarkText string) *guacdAuditor {
+	var copyLimit, pasteLimit int
+	if batchResult != nil {
+		copyLimit = restrictionLimit(batchResult.GetResult(model.ActionCopy), model.RestrictionClipboardCopyLimit)
+		pasteLimit = restrictionLimit(batchResult.GetResult(model.ActionPaste), model.RestrictionClipboardPasteLimit)
+	}
+	var secrets []string
+	if account != nil && account.Password != "" {
+		secrets = append(secrets, account.Password)
+	}
+
+	pastes := newClipboardTracker(model.ClipboardDirectionPaste, pasteLimit)
+	if terminal != nil && terminal.HasPolicy() {
+		pastes.check = terminal.Paste
+	}
+
+	return &guacdAuditor{
+		sessionId:      sessionId,
+		sessionService: service.NewSessionService(),
+		contentLimit:   config.Cfg.Session.ClipboardContentLimit,
+		recordKeys:     config.Cfg.Session.RecordKeystrokes,
+		secrets:        secrets,
+		copies:         newClipboardTracker(model.ClipboardDirectionCopy, copyLimit),
+		pastes:         pastes,
+		terminal:       terminal,
+		watermark:      watermark,
+		watermarkText:  watermarkText,
+		watermarkDrawn: time.Now(),
+		modifiers:      make(map[int]bool),
+	}
+}
+
+func newClipboardTracker(direction string, limit int) *clipboardTracker {
+	return &clipboardTracker{
+		direction: direction,
+		limit:     limit,
+		streams:   make(map[string]*clipboardStream),
+	}
+}
+
+func restrictionLimit(result *model.AuthResult, key string) int {
+	if result == nil {
+		return 0
+	}
+	return cast.ToInt(result.Restrictions[key])
+}
+
+// FromServer inspects an instruction sent by guacd and returns what is forwarded to the browser
+func (a *guacdAuditor) FromServer(p []byte) ([]byte, error) {
+	instructions, err := a.split(&a.fromServer, p)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(p))
+	for _, ins := range instructions {
+		if relayed, ok := a.copies.relay(a, ins); ok {
+			out = append(out, relayed...)
+			continue
+		}
+		// guacd ends every frame with a sync, the watermark is redrawn within the frame
+		if ins.Opcode == "sync" {
+			out = a.refreshWatermark(out)
+		}
+		out = append(out, ins.Bytes()...)
+		// The default layer is sized first and after every resize of the display
+		if a.watermark != nil && ins.Opcode == "size" && len(ins.Args) >= 3 && ins.Args[0] == "0" {
+			out = append(out, a.watermark.Resize(cast.ToInt(ins.Args[1]), cast.ToInt(ins.Args[2]))...)
+		}
+	}
+	return out, nil
+}
+
+// FromClient inspects the instructions sent by the browser and returns what is forwarded to guacd
+func (a *guacdAuditor) FromClient(p []byte) ([]byte, error) {
+	instructions, err := a.split(&a.fromClient, p)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(p))
+	for _, ins := range instructions {
+		if relayed, ok := a.pastes.relay(a, ins); ok {
+			out = append(out, relayed...)
+			continue
+		}
+
+		if guacd.IsWatermarkAck(ins) {
+			continue
+		}
+
+		switch ins.Opcode {
+		case "key":
+			if len(ins.Args) < 2 {
+				break
+			}
+			keysym, pressed := cast.ToInt(ins.Args[0]), ins.Args[1] == "1"
+			if _, ok := modifierKeysyms[keysym]; ok {
+				a.modifiers[keysym] = pressed
+				break
+			}
+			if a.terminal == nil {
+				if a.recordKeys {
+					a.key(keysym, pressed)
+				}
+				break
+			}
+			forward, replacement := a.terminal.Key(a.sessionId, keysym, pressed, lo.Contains(a.activeModifiers(), "Ctrl"))
+			if !forward {
+				out = append(out, replacement...)
+				continue
+			}
+		case "size":
+			if a.terminal != nil && len(ins.Args) >= 2 {
+				a.terminal.Resize(cast.ToInt(ins.Args[0]), cast.ToInt(ins.Args[1]))
+			}
+		case "mouse":
+			// A click usually moves the focus, the text typed so far belongs together
+			if a.terminal == nil && a.recordKeys && len(ins.Args) >= 3 && ins.Args[2] != "0" {
+				a.flushLine()
+			}
+		}
+		out = append(out, ins.Bytes()...)
+	}
+	return out, nil
+}
+
+// refreshWatermark appends the instructions drawing the watermark again once the minute it shows is over
+func (a *guacdAuditor) refreshWatermark(out []byte) []byte {
+	now := time.Now()
+	if a.watermark == nil || !service.WatermarkChanges(a.watermarkText) || now.Truncate(time.Minute).Equal(a.watermarkDrawn.Truncate(time.Minute)) {
+		return out
+	}
+	a.watermarkDrawn = now
+	redraw, err := a.watermark.Update(service.WatermarkAt(a.watermarkText, now))
+	if err != nil {
+		logger.L().Warn("Failed to render watermark", zap.String("id", a.sessionId), zap.Error(err))
+		return out
+	}
+	return append(out, redraw...)
+}
+
+// split returns the complete instructions of the pending bytes followed by p, the rest is kept pending
+func (a *guacdAuditor) split(pending *[]byte, p []byte) ([]*guacd.Instruction, error) {
+	data := p
+	if len(*pending) > 0 {
+		data = append(*pending, p...)
+	}
+	instructions, rest, err := guacd.ParseInstructions(data)
+	if err == nil && len(rest) > maxPendingInstruction {
+		err = fmt.Errorf("%w: instruction longer than %d bytes", guacd.ErrMalformedInstruction, maxPendingInstruction)
+	}
+	if err != nil {
+		*pending = nil
+		logger.L().Warn("malformed guacd instruction, closing session", zap.String("id", a.sessionId), zap.Error(err))
+		return nil, err
+	}
+	*pending = append([]byte(nil), rest...)
+	return instructions, nil
+}
+
+// Close writes the text typed since the last flush
+func (a *guacdAuditor) Close() {
+	if a.terminal != nil {
+		a.terminal.Close()
+		return
+	}
+	a.flushLine()
+}
+
+func (a *guacdAuditor) key(keysym int, pressed bool) {
+	if !pressed {
+		return
+	}
+
+	r, printable := keysymRune(keysym)
+	if printable {
+		// Shortcuts like Ctrl+V are kept as tokens so they can be searched for
+		if mods := a.activeModifiers(); len(mods) > 0 {
+			a.appendLine([]rune("[" + strings.Join(append(mods, string(r)), "+") + "]")...)
+			return
+		}
+		a.appendLine(r)
+		return
+	}
+
+	switch keysym {
+	case keysymReturn, keysymKpEnter:
+		a.flushLine()
+	case keysymBackSpace:
+		if len(a.line) > 0 {
+			a.line = a.line[:len(a.line)-1]
+		}
+	case keysymTab:
+		a.appendLine('\t')
+	}
+}
+
+func (a *guacdAuditor) activeModifiers() []string {
+	var mods []string
+	for _, name := range []string{"Ctrl", "Alt", "Meta", "Super"} {
+		for keysym, pressed := range a.modifiers {
+			if pressed && modifierKeysyms[keysym] == name {
+				mods = append(mods, name)
+				break
+			}
+		}
+	}
+	return mods
+}
+
+func (a *guacdAuditor) appendLine(r ...rune) {
+	a.line = append(a.line, r...)
+	if len(a.line) >= maxTypedLine {
+		a.flushLine()
+	}
+}
+
+func (a *guacdAuditor) flushLine() {
+	if strings.TrimSpace(string(a.line)) == "" {
+		a.line = a.line[:0]
+		return
+	}
+
+	line := string(a.line)
+	for _, secret := range a.secrets {
+		line = strings.ReplaceAll(line, secret, maskedSecret)
+	}
+	cmd := &model.SessionCmd{
+		SessionId: a.sessionId,
+		Cmd:       line,
+		Level:     int(model.RiskLevelSafe),
+	}
+	a.line = a.line[:0]
+	if err := a.sessionService.CreateSessionCmd(context.Background(), cmd); err != nil {
+		logger.L().Error("write typed text failed", zap.String("id", a.sessionId), zap.Error(err))
+	}
+}
+
+func (a *guacdAuditor) recordClipboard(c *clipboardTracker, stream *clipboardStream) {
+	clipboard := &model.SessionClipboard{
+		SessionId: a.sessionId,
+		Direction: c.direction,
+		MimeType:  stream.mimeType,
+		Size:      stream.size,
+		Content:   strings.ToValidUTF8(string(stream.content), ""),
+		Truncated: stream.truncated,
+		Blocked:   stream.blocked,
+	}
+	if err := a.sessionService.CreateSessionClipboard(context.Background(), clipboard); err != nil {
+		logger.L().Error("write clipboard transfer failed", zap.String("id", a.sessionId), zap.Error(err))
+	}
+	if stream.blocked {
+		logger.L().Warn("clipboard transfer blocked", zap.String("id", a.sessionId), zap.String("direction", c.direction),
+			zap.Int64("size", stream.size), zap.Int("limit", c.limit))
+	}
+}
+
+// relay handles the instructions of clipboard streams, it reports false for anything else.
+// With a limit the stream is held back until it ends and dropped as a whole once it is too large.
+func (c *clipboardTracker) relay(a *guacdAuditor, ins *guacd.Instruction) ([]byte, bool) {
+	switch ins.Opcode {
+	case "clipboard":
+		if len(ins.Args) < 2 {
+			return nil, false
+		}
+		stream := &clipboardStream{mimeType: ins.Args[1]}
+		c.streams[ins.Args[0]] = stream
+		if c.holds() {
+			stream.held.Write(ins.Bytes())
+			return nil, true
+		}
+		return ins.Bytes(), true
+
+	case "blob":
+		if len(ins.Args) < 2 {
+			return nil, false
+		}
+		stream, ok := c.streams[ins.Args[0]]
+		if !ok {
+			return nil, false
+		}
+		data, _ := base64.StdEncoding.DecodeString(ins.Args[1])
+		stream.size += int64(len(data))
+		stream.capture(data, a.contentLimit)
+		if !c.holds() {
+			return ins.Bytes(), true
+		}
+		if c.check != nil && !stream.blocked {
+			stream.text = append(stream.text, data[:min(len(data), max(maxPasteCheck-len(stream.text), 0))]...)
+		}
+		if !stream.blocked && c.limit > 0 && stream.size > int64(c.limit) {
+			stream.blocked = true
+			stream.held.Reset()
+		}
+		if !stream.blocked {
+			stream.held.Write(ins.Bytes())
+		}
+		return nil, true
+
+	case "end":
+		if len(ins.Args) < 1 {
+			return nil, false
+		}
+		stream, ok := c.streams[ins.Args[0]]
+		if !ok {
+			return nil, false
+		}
+		delete(c.streams, ins.Args[0])
+		if c.check != nil && !stream.blocked {
+			if cmd, forbidden := c.check(string(stream.text)); forbidden {
+				stream.blocked = true
+				logger.L().Info("paste with forbidden command blocked", zap.String("id", a.sessionId), zap.String("cmd", cmd))
+			}
+		}
+		a.recordClipboard(c, stream)
+		if !c.holds() {
+			return ins.Bytes(), true
+		}
+		if stream.blocked {
+			return nil, true
+		}
+		return append(stream.held.Bytes(), ins.Bytes()...), true
+	}
+
+	return nil, false
+}
+
+// holds tells whether streams are kept back until they end
+func (c *clipboardTracker) holds() bool {
+	return c.limit > 0 || c.check != nil
+}
+
+// capture keeps text content up to limit bytes
+func (s *clipboardStream) capture(data []byte, limit int) {
+	if limit <= 0 || !strings.HasPrefix(s.mimeType, "text/") {
+		return
+	}
+	room := limit - len(s.content)
+	if len(data) > room {
+		data = data[:max(room, 0)]
+		s.truncated = true
+	}
+	s.content = append(s.content, data...)
+}
+
+// keysymRune returns the character typed by a keysym, false for keys that do not type one
+func keysymRune(keysym int) (rune, bool) {
+	switch {
+	case keysym >= 0x20 && keysym <= 0x7e, keysym >= 0xa0 && keysym <= 0xff:
+		return rune(keysym), true
+	case keysym&0xff000000 == keysymUnicode:
+		r := rune(keysym & 0x00ffffff)
+		return r, utf8.ValidRune(r)
+	}
+	r, ok := keypadKeysyms[keysym]
+	return r, ok
+}
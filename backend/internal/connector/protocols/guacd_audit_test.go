@@ -0,0 +1,125 @@
+package protocols
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/veops/oneterm/internal/guacd"
+	"github.com/veops/oneterm/internal/model"
+)
+
+func newTestAuditor() *guacdAuditor {
+	return &guacdAuditor{
+		sessionId: "test",
+		copies:    newClipboardTracker(model.ClipboardDirectionCopy, 0),
+		pastes:    newClipboardTracker(model.ClipboardDirectionPaste, 0),
+		modifiers: make(map[int]bool),
+	}
+}
+
+func TestGuacdAuditorSplitReads(t *testing.T) {
+	data := "4.size,1.0,4.1024,3.768;4.sync,2.42;4.name,2.日本;"
+	tests := []struct {
+		name  string
+		reads []string
+	}{
+		{name: "whole", reads: []string{data}},
+		{name: "inside a length", reads: []string{data[:25], data[25:]}},
+		{name: "inside a value", reads: []string{data[:14], data[14:]}},
+		{name: "inside a code point", reads: []string{data[:46], data[46:]}},
+		{name: "byte by byte", reads: strings.Split(data, "")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, relay := range []func(*guacdAuditor, []byte) ([]byte, error){(*guacdAuditor).FromServer, (*guacdAuditor).FromClient} {
+				a := newTestAuditor()
+				var out []byte
+				for _, read := range tt.reads {
+					relayed, err := relay(a, []byte(read))
+					if err != nil {
+						t.Fatalf("relay(%q) error = %v", read, err)
+					}
+					out = append(out, relayed...)
+				}
+				if string(out) != data {
+					t.Errorf("relayed %q, want %q", out, data)
+				}
+				if len(a.fromServer) > 0 || len(a.fromClient) > 0 {
+					t.Errorf("pending %q %q after the last instruction", a.fromServer, a.fromClient)
+				}
+			}
+		})
+	}
+}
+
+func TestGuacdAuditorPendingLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		wantErr bool
+	}{
+		{name: "at the limit", size: maxPendingInstruction, wantErr: false},
+		{name: "past the limit", size: maxPendingInstruction + 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAuditor()
+			head := "4.blob,1.1,99999."
+			value := strings.Repeat("A", tt.size-len(head))
+
+			// The instruction never ends, it is held back in small reads until it is too long
+			var err error
+			for read := head + value; len(read) > 0 && err == nil; {
+				n := min(len(read), 4096)
+				var out []byte
+				out, err = a.FromServer([]byte(read[:n]))
+				if len(out) > 0 {
+					t.Fatalf("relayed %d bytes of an incomplete instruction", len(out))
+				}
+				read = read[n:]
+			}
+			if tt.wantErr {
+				if !errors.Is(err, guacd.ErrMalformedInstruction) {
+					t.Fatalf("FromServer() error = %v, want ErrMalformedInstruction", err)
+				}
+				if a.fromServer != nil {
+					t.Errorf("pending %d bytes after the error", len(a.fromServer))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FromServer() error = %v", err)
+			}
+			if len(a.fromServer) != tt.size {
+				t.Errorf("pending %d bytes, want %d", len(a.fromServer), tt.size)
+			}
+		})
+	}
+}
+
+func TestGuacdAuditorMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		reads []string
+	}{
+		{name: "letters in length", reads: []string{"4.sync,x.1;"}},
+		{name: "negative length", reads: []string{"-4.sync;"}},
+		{name: "wrong length", reads: []string{"3.sync;"}},
+		{name: "split before the error", reads: []string{"4.sync,2.4", "2;3.nop,z"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAuditor()
+			var err error
+			for _, read := range tt.reads {
+				if _, err = a.FromClient([]byte(read)); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, guacd.ErrMalformedInstruction) {
+				t.Fatalf("FromClient() error = %v, want ErrMalformedInstruction", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package protocols
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/guacd"
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/service"
+	gsession "github.com/veops/oneterm/internal/session"
+	"github.com/veops/oneterm/pkg/config"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+// guacd color schemes, anything else given by a preference is passed as a custom scheme
+var guacdColorSchemes = map[string]string{
+	"black-white": "black-white",
+	"gray-black":  "gray-black",
+	"green-black": "green-black",
+	"white-black": "white-black",
+	"light":       "black-white",
+	"dark":        "gray-black",
+}
+
+var (
+	// Ctrl+U then enter, the same line reset native terminals send after a forbidden command
+	clearLineKeys = lo.Flatten([][]byte{
+		guacd.NewInstruction("key", "65507", "1").Bytes(),
+		guacd.NewInstruction("key", "117", "1").Bytes(),
+		guacd.NewInstruction("key", "117", "0").Bytes(),
+		guacd.NewInstruction("key", "65507", "0").Bytes(),
+		guacd.NewInstruction("key", "65293", "1").Bytes(),
+		guacd.NewInstruction("key", "65293", "0").Bytes(),
+	})
+	clearLineInput = []byte("\x15\r")
+)
+
+// typescriptTimeout is how long guacd gets to create the typescript after the session started
+const typescriptTimeout = 15 * time.Second
+
+// guacdTerminal applies the command policy to ssh and telnet sessions rendered by guacd. The terminal output guacd
+// writes to a typescript is fed to the parser native sessions use, and the command is checked when enter is pressed
+// so forbidden ones never reach the server. The typescript has to be readable by oneterm, with a command policy the
+// session is closed when it is not, and commands are refused until it is.
+type guacdTerminal struct {
+	parser *gsession.Parser
+	path   string
+	fontPx float64
+	dpi    int
+
+	mu     sync.Mutex
+	offset int64
+	opened bool
+}
+
+// newGuacdTerminal prepares the command policy of a session and the terminal options taken from the user preference
+func newGuacdTerminal(ctx *gin.Context, sess *gsession.Session, w, h, dpi int) (*guacdTerminal, *guacd.TerminalOptions) {
+	pref, err := service.DefaultUserPreferenceService.GetUserPreference(ctx, sess.Uid)
+	if err != nil {
+		logger.L().Warn("Failed to load user preference, using defaults", zap.Int("uid", sess.Uid), zap.Error(err))
+		pref = service.DefaultUserPreferenceService.GetDefaultPreference()
+	}
+
+	// Preferences size fonts in CSS pixels, guacd in points
+	fontPx := float64(lo.Ternary(pref.FontSize > 0, pref.FontSize, 12))
+	opts := &guacd.TerminalOptions{
+		FontName:       strings.Trim(strings.TrimSpace(strings.Split(pref.FontFamily, ",")[0]), `"'`),
+		FontSize:       max(int(math.Round(fontPx*0.75)), 6),
+		ColorScheme:    guacdColorScheme(pref),
+		Scrollback:     cast.ToInt(pref.Settings["scrollback"]),
+		TypescriptName: sess.SessionId + ".typescript",
+	}
+
+	t := &guacdTerminal{
+		path:   filepath.Join(lo.CoalesceOrEmpty(config.Cfg.Session.GuacdRecordingDir, config.Cfg.Session.ReplayDir), opts.TypescriptName),
+		fontPx: fontPx,
+		dpi:    dpi,
+	}
+	cols, rows := t.grid(w, h)
+	t.parser = gsession.NewParser(sess.SessionId, cols, rows)
+	t.parser.Protocol = sess.Protocol
+
+	cmds, err := service.NewCommandAnalyzer().AnalyzeSessionCommands(ctx, sess)
+	if err != nil {
+		logger.L().Error("Failed to analyze session commands", zap.String("sessionId", sess.SessionId), zap.Error(err))
+		cmds = []*model.Command{}
+	}
+	t.parser.Cmds = cmds
+
+	return t, opts
+}
+
+// guacdColorScheme maps the theme of a preference to a guacd color scheme, empty keeps the guacd default
+func guacdColorScheme(pref *model.UserPreference) string {
+	if scheme, ok := guacdColorSchemes[strings.ToLower(pref.Theme)]; ok {
+		return scheme
+	}
+
+	// Custom themes carry their colors in the settings
+	foreground, background := cast.ToString(pref.Settings["foreground"]), cast.ToString(pref.Settings["background"])
+	if !strings.HasPrefix(foreground, "#") || !strings.HasPrefix(background, "#") || len(foreground) != 7 || len(background) != 7 {
+		return ""
+	}
+	rgb := func(hex string) string { return "rgb:" + hex[1:3] + "/" + hex[3:5] + "/" + hex[5:7] }
+	return "foreground: " + rgb(foreground) + "; background: " + rgb(background)
+}
+
+// grid estimates the terminal size in characters guacd lays out in a display of w x h pixels
+func (t *guacdTerminal) grid(w, h int) (int, int) {
+	px := t.fontPx * float64(lo.Ternary(t.dpi > 0, t.dpi, 96)) / 96
+	return max(int(float64(w)/(px*0.6)), 1), max(int(float64(h)/(px*1.2)), 1)
+}
+
+// HasPolicy tells whether commands of the session are checked
+func (t *guacdTerminal) HasPolicy() bool {
+	return len(t.parser.Cmds) > 0
+}
+
+// Run feeds the typescript to the parser until ctx is done. An unreadable typescript ends the session when commands
+// are checked, without a policy only the command history is lost.
+func (t *guacdTerminal) Run(ctx context.Context) error {
+	tk := time.NewTicker(time.Millisecond * 100)
+	defer tk.Stop()
+	deadline := time.Now().Add(typescriptTimeout)
+	warned := false
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tk.C:
+		}
+
+		err := t.read()
+		if err == nil && !t.isOpened() && time.Now().After(deadline) {
+			err = fmt.Errorf("typescript %s was not created within %s, guacdRecordingDir must be the directory guacd records to", t.path, typescriptTimeout)
+		}
+		if err == nil || warned {
+			continue
+		}
+		if t.HasPolicy() {
+			logger.L().Error("Typescript unreadable, closing session to enforce the command policy", zap.String("path", t.path), zap.Error(err))
+			return err
+		}
+		logger.L().Warn("Typescript unreadable, commands are not recorded", zap.String("path", t.path), zap.Error(err))
+		warned = true
+	}
+}
+
+func (t *guacdTerminal) isOpened() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.opened
+}
+
+// read feeds the output guacd wrote since the last read, the typescript does not exist until guacd connected
+func (t *guacdTerminal) read() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f, err := os.Open(t.path)
+	if err != nil {
+		if os.IsNotExist(err) && !t.opened {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	t.opened = true
+
+	if _, err = f.Seek(t.offset, io.SeekStart); err != nil {
+		return err
+	}
+	out, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	t.offset += int64(len(out))
+	t.parser.AddOutput(out)
+	return nil
+}
+
+// Key feeds a key press to the parser, it returns false with the instructions to send instead when the key
+// submits a forbidden command
+func (t *guacdTerminal) Key(sessionId string, keysym int, pressed, ctrl bool) (bool, []byte) {
+	if !pressed {
+		return true, nil
+	}
+
+	switch keysym {
+	case keysymReturn, keysymKpEnter:
+		// Catch up with the echo of what was typed before checking the command, it cannot be checked without it
+		if err := t.read(); (err != nil || !t.isOpened()) && t.HasPolicy() {
+			logger.L().Warn("command refused, typescript unreadable", zap.String("id", sessionId), zap.Error(err))
+			t.parser.AddInput(clearLineInput)
+			return false, clearLineKeys
+		}
+		cmd, forbidden := t.parser.AddInput([]byte("\r"))
+		if !forbidden {
+			return true, nil
+		}
+		logger.L().Info("forbidden command blocked", zap.String("id", sessionId), zap.String("cmd", cmd))
+		t.parser.AddInput(clearLineInput)
+		return false, clearLineKeys
+	case keysymBackSpace:
+		t.parser.AddInput([]byte{0x7f})
+	default:
+		r, ok := keysymRune(keysym)
+		if !ok {
+			break
+		}
+		if ctrl && unicode.IsLetter(r) && r < unicode.MaxASCII {
+			t.parser.AddInput([]byte{byte(unicode.ToLower(r)) & 0x1f})
+			break
+		}
+		t.parser.AddInput([]byte(string(r)))
+	}
+	return true, nil
+}
+
+// Paste checks text put on the clipboard of the terminal, each line of it is submitted when pasted with its line
+// break and is never seen as keys. It returns the rule matched by a forbidden line.
+func (t *guacdTerminal) Paste(text string) (string, bool) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	for _, line := range strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == '\r' }) {
+		if cmd, forbidden := t.parser.IsForbidden(strings.TrimSpace(line)); forbidden {
+			return cmd, true
+		}
+	}
+	return "", false
+}
+
+// Resize follows the display size set by the browser
+func (t *guacdTerminal) Resize(w, h int) {
+	t.parser.Resize(t.grid(w, h))
+}
+
+// Close writes the last command and removes the typescript, the graphical recording is what is kept
+func (t *guacdTerminal) Close() {
+	t.read()
+	t.parser.WriteDb()
+	for _, path := range []string{t.path, t.path + ".timing"} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.L().Warn("Failed to remove typescript", zap.String("path", path), zap.Error(err))
+		}
+	}
+}
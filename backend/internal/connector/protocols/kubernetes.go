@@ -0,0 +1,52 @@
+package protocols
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/kubernetes"
+	"github.com/veops/oneterm/internal/model"
+	gsession "github.com/veops/oneterm/internal/session"
+	"github.com/veops/oneterm/internal/tunneling"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+// ConnectKubernetes opens an exec shell into a pod container
+func ConnectKubernetes(ctx *gin.Context, sess *gsession.Session, asset *model.Asset, account *model.Account, gateway *model.Gateway) (err error) {
+	w, h := cast.ToInt(ctx.Query("w")), cast.ToInt(ctx.Query("h"))
+	chs := sess.Chans
+	defer func() {
+		if err != nil {
+			chs.ErrChan <- err
+		}
+	}()
+
+	ip, port, err := tunneling.Proxy(false, sess.SessionId, "kubernetes", asset, gateway)
+	if err != nil {
+		return
+	}
+	defer tunneling.CloseTunnels(sess.SessionId)
+
+	cli, err := kubernetes.NewClient(ip, port, strings.Split(asset.Ip, ":")[0], asset.KubernetesConfig, account)
+	if err != nil {
+		return
+	}
+
+	shell := ""
+	if asset.KubernetesConfig != nil {
+		shell = asset.KubernetesConfig.Shell
+	}
+
+	stream, err := cli.Exec(sess.Gctx, sess.Workload, containerShell(shell))
+	if err != nil {
+		logger.L().Error("kubernetes exec failed", zap.String("target", sess.Workload.String()), zap.Error(err))
+		return
+	}
+
+	pipeExecStream(sess, stream, w, h)
+
+	return
+}
@@ -0,0 +1,41 @@
+package protocols
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/service"
+	gsession "github.com/veops/oneterm/internal/session"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+// WriteWatermark sends the watermark of a terminal session to the web client, which draws it over the terminal. It
+// goes in a binary message, terminal output is only ever sent in text messages so the target cannot forge it. It is
+// not recorded nor sent to monitors.
+func WriteWatermark(sess *gsession.Session) {
+	if sess.Watermark == "" || sess.SessionType != model.SESSIONTYPE_WEB || sess.Ws == nil {
+		return
+	}
+
+	payload, err := json.Marshal(map[string]any{"type": "watermark", "text": service.WatermarkAt(sess.Watermark, time.Now())})
+	if err != nil {
+		return
+	}
+
+	wsWriteMutex.Lock()
+	defer wsWriteMutex.Unlock()
+	if err = sess.Ws.WriteMessage(websocket.BinaryMessage, payload); err != nil {
+		logger.L().Warn("Failed to send watermark", zap.String("sessionId", sess.SessionId), zap.Error(err))
+	}
+}
+
+// RefreshWatermark sends the watermark again when its text follows the clock, it is called every minute
+func RefreshWatermark(sess *gsession.Session) {
+	if service.WatermarkChanges(sess.Watermark) {
+		WriteWatermark(sess)
+	}
+}
@@ -0,0 +1,262 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+
+	"github.com/veops/oneterm/internal/model"
+)
+
+const (
+	// apiVersion is the oldest engine API version providing everything used here
+	apiVersion = "v1.40"
+
+	defaultTimeout = time.Second * 10
+)
+
+// Client is a minimal Docker Engine API client covering container discovery and exec
+type Client struct {
+	addr       string
+	scheme     string
+	tlsConfig  *tls.Config
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the engine API reachable at ip:port.
+// serverName is the original engine host, used for certificate verification when tunneled.
+func NewClient(ip string, port int, serverName string, cfg *model.DockerConfig, account *model.Account) (*Client, error) {
+	if cfg == nil {
+		cfg = &model.DockerConfig{}
+	}
+
+	c := &Client{
+		addr:   net.JoinHostPort(ip, strconv.Itoa(port)),
+		scheme: lo.CoalesceOrEmpty(cfg.Scheme, "http"),
+	}
+
+	if c.scheme == "https" {
+		c.tlsConfig = &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+		}
+		if cfg.CaCert != "" {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM([]byte(cfg.CaCert)) {
+				return nil, fmt.Errorf("invalid engine ca certificate")
+			}
+			c.tlsConfig.RootCAs = pool
+		}
+		if account != nil && account.AccountType == model.AUTHMETHOD_CERT {
+			cert, err := tls.X509KeyPair([]byte(account.Pk), []byte(account.Pk))
+			if err != nil {
+				return nil, fmt.Errorf("invalid client certificate: %w", err)
+			}
+			c.tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+
+	c.httpClient = &http.Client{
+		Timeout: defaultTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: c.tlsConfig,
+		},
+	}
+
+	return c, nil
+}
+
+// Container is a trimmed down container summary
+type Container struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Image  string `json:"image"`
+	State  string `json:"state"`
+	Status string `json:"status"`
+}
+
+// ListContainers lists running containers of the engine
+func (c *Client) ListContainers(ctx context.Context) ([]*Container, error) {
+	list := []struct {
+		Id     string   `json:"Id"`
+		Names  []string `json:"Names"`
+		Image  string   `json:"Image"`
+		State  string   `json:"State"`
+		Status string   `json:"Status"`
+	}{}
+	if err := c.do(ctx, http.MethodGet, "/containers/json", nil, &list); err != nil {
+		return nil, err
+	}
+
+	res := make([]*Container, 0, len(list))
+	for _, item := range list {
+		ct := &Container{
+			Id:     item.Id,
+			Image:  item.Image,
+			State:  item.State,
+			Status: item.Status,
+		}
+		if len(item.Names) > 0 {
+			ct.Name = strings.TrimPrefix(item.Names[0], "/")
+		}
+		res = append(res, ct)
+	}
+	return res, nil
+}
+
+// Exec opens an interactive tty exec session into the named container.
+// The name must be the canonical container name, ids and id prefixes are rejected
+// so authorization by name pattern cannot be bypassed.
+func (c *Client) Exec(ctx context.Context, name string, user string, command []string) (*ExecStream, error) {
+	inspect := struct {
+		Name  string `json:"Name"`
+		State struct {
+			Running bool `json:"Running"`
+		} `json:"State"`
+	}{}
+	if err := c.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(name)+"/json", nil, &inspect); err != nil {
+		return nil, err
+	}
+	if strings.TrimPrefix(inspect.Name, "/") != name {
+		return nil, fmt.Errorf("container %s not found", name)
+	}
+	if !inspect.State.Running {
+		return nil, fmt.Errorf("container %s is not running", name)
+	}
+
+	created := struct {
+		Id string `json:"Id"`
+	}{}
+	err := c.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(name)+"/exec", map[string]any{
+		"AttachStdin":  true,
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"Tty":          true,
+		"Cmd":          command,
+		"User":         user,
+		"Env":          []string{"TERM=xterm-256color"},
+	}, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, br, err := c.hijack(ctx, "/exec/"+created.Id+"/start", map[string]any{"Detach": false, "Tty": true})
+	if err != nil {
+		return nil, err
+	}
+
+	return newExecStream(c, created.Id, conn, br), nil
+}
+
+// resize changes the tty size of an exec instance
+func (c *Client) resize(ctx context.Context, execId string, w, h int) error {
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/exec/%s/resize?h=%d&w=%d", execId, h, w), nil, nil)
+}
+
+// exitCode returns the exit code of a finished exec instance
+func (c *Client) exitCode(ctx context.Context, execId string) (int, error) {
+	res := struct {
+		ExitCode int `json:"ExitCode"`
+	}{}
+	err := c.do(ctx, http.MethodGet, "/exec/"+execId+"/json", nil, &res)
+	return res.ExitCode, err
+}
+
+func (c *Client) url(path string) string {
+	return fmt.Sprintf("%s://%s/%s%s", c.scheme, c.addr, apiVersion, path)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		bs, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(bs)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path), body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		bs, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("request %s failed with status %d: %s", path, resp.StatusCode, strings.TrimSpace(string(bs)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// hijack sends an upgrade request and returns the raw connection once the engine switches protocols
+func (c *Client) hijack(ctx context.Context, path string, in any) (net.Conn, *bufio.Reader, error) {
+	bs, err := json.Marshal(in)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: defaultTimeout}
+	var conn net.Conn
+	if c.tlsConfig != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: c.tlsConfig}).DialContext(ctx, "tcp", c.addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.url(path), bytes.NewReader(bs))
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+
+	if err = req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	// Older engines answer 200 and stream on the same connection
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		defer conn.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, nil, fmt.Errorf("exec start failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	return conn, br, nil
+}
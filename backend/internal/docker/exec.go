@@ -0,0 +1,58 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// ExecStream is a hijacked tty exec connection; with a tty the engine sends raw, unmultiplexed output
+type ExecStream struct {
+	cli    *Client
+	execId string
+	conn   net.Conn
+	br     *bufio.Reader
+	once   sync.Once
+	err    error
+}
+
+func newExecStream(cli *Client, execId string, conn net.Conn, br *bufio.Reader) *ExecStream {
+	return &ExecStream{cli: cli, execId: execId, conn: conn, br: br}
+}
+
+// Read reads tty output; it returns io.EOF once the remote process exits
+func (s *ExecStream) Read(p []byte) (int, error) {
+	return s.br.Read(p)
+}
+
+// Write sends p to the process stdin
+func (s *ExecStream) Write(p []byte) (int, error) {
+	return s.conn.Write(p)
+}
+
+// Resize changes the tty size of the remote process
+func (s *ExecStream) Resize(w, h int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	return s.cli.resize(ctx, s.execId, w, h)
+}
+
+// Err reports a non-zero exit code of the finished process, if any
+func (s *ExecStream) Err() error {
+	s.once.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+		defer cancel()
+		code, err := s.cli.exitCode(ctx, s.execId)
+		if err == nil && code != 0 {
+			s.err = fmt.Errorf("process exited with code %d", code)
+		}
+	})
+	return s.err
+}
+
+// Close closes the underlying connection
+func (s *ExecStream) Close() error {
+	return s.conn.Close()
+}
@@ -6,14 +6,13 @@ import (
 	"io"
 	"net"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/samber/lo"
 	"github.com/spf13/cast"
 
 	"github.com/veops/oneterm/internal/model"
 	"github.com/veops/oneterm/internal/tunneling"
-	"github.com/veops/oneterm/pkg/config"
 	"github.com/veops/oneterm/pkg/logger"
 )
 
@@ -42,6 +41,16 @@ type PermissionInfo struct {
 	AllowFileDownload bool
 }
 
+// TerminalOptions configures the terminal guacd renders for ssh and telnet connections
+type TerminalOptions struct {
+	FontName    string
+	FontSize    int // points
+	ColorScheme string
+	Scrollback  int
+	// TypescriptName is the file the terminal output is written to next to the recordings, empty for none
+	TypescriptName string
+}
+
 type Configuration struct {
 	Protocol   string
 	Parameters map[string]string
@@ -63,21 +72,36 @@ type Tunnel struct {
 	gw              *tunneling.GatewayTunnel
 	transferManager *FileTransferManager
 	drivePath       string
+	endpoint        *Endpoint
+	releaseOnce     sync.Once
 }
 
-func NewTunnel(connectionId, sessionId string, w, h, dpi int, protocol string, asset *model.Asset, account *model.Account, gateway *model.Gateway, permissions *PermissionInfo) (t *Tunnel, err error) {
-	var hostPort string
-	if strings.Contains(config.Cfg.Guacd.Host, ":") {
-		// IPv6 address
-		hostPort = fmt.Sprintf("[%s]:%d", config.Cfg.Guacd.Host, config.Cfg.Guacd.Port)
+func NewTunnel(connectionId, sessionId string, w, h, dpi int, protocol string, asset *model.Asset, account *model.Account, gateway *model.Gateway, permissions *PermissionInfo, terminal *TerminalOptions) (t *Tunnel, err error) {
+	if DefaultPool == nil {
+		return nil, fmt.Errorf("guacd pool not initialized")
+	}
+	var conn net.Conn
+	var endpoint *Endpoint
+	if connectionId == "" {
+		conn, endpoint, err = DefaultPool.Dial()
 	} else {
-		// IPv4 address or hostname
-		hostPort = fmt.Sprintf("%s:%d", config.Cfg.Guacd.Host, config.Cfg.Guacd.Port)
+		// Joining tunnels have to reach the daemon serving the connection
+		conn, endpoint, err = DefaultPool.DialConnection(connectionId)
 	}
-	conn, err := net.DialTimeout("tcp", hostPort, time.Second*3)
 	if err != nil {
 		return
 	}
+	defer func() {
+		if err != nil {
+			conn.Close()
+			if t == nil {
+				DefaultPool.release(connectionId, endpoint, false)
+				return
+			}
+			t.release()
+		}
+	}()
+
 	// Find the port for the protocol from asset.Protocols
 	var port string
 	protocolLower := strings.ToLower(protocol)
@@ -98,6 +122,8 @@ func NewTunnel(connectionId, sessionId string, w, h, dpi int, protocol string, a
 			port = "3389"
 		case "vnc":
 			port = "5900"
+		case "telnet":
+			port = "23"
 		default:
 			port = "22" // SSH default
 		}
@@ -108,6 +134,7 @@ func NewTunnel(connectionId, sessionId string, w, h, dpi int, protocol string, a
 
 	t = &Tunnel{
 		conn:            conn,
+		endpoint:        endpoint,
 		reader:          bufio.NewReader(conn),
 		writer:          bufio.NewWriter(conn),
 		ConnectionId:    connectionId,
@@ -160,6 +187,13 @@ func NewTunnel(connectionId, sessionId string, w, h, dpi int, protocol string, a
 						params[DRIVE_NAME] = "Drive"
 					}
 
+					switch protocolLower {
+					case "rdp":
+						setRdpParameters(params, asset.RdpConfig)
+					case "ssh", "telnet":
+						setTerminalParameters(params, terminal, account)
+					}
+
 					return params
 				}, func() map[string]string {
 					return map[string]string{
@@ -184,11 +218,81 @@ func NewTunnel(connectionId, sessionId string, w, h, dpi int, protocol string, a
 		t.Config.Parameters["port"] = cast.ToString(t.gw.LocalPort)
 	}
 
-	err = t.handshake()
+	if err = t.handshake(); err != nil {
+		return
+	}
+	if t.SessionId != "" {
+		DefaultPool.bind(t.ConnectionId, t.endpoint)
+	}
 
 	return
 }
 
+// setRdpParameters maps the RDP configuration of an asset to guacd parameters,
+// certificates stay ignored unless verification is enabled
+func setRdpParameters(params map[string]string, cfg *model.RdpConfig) {
+	if cfg == nil {
+		return
+	}
+
+	params["ignore-cert"] = cast.ToString(!cfg.VerifyCert)
+	if len(cfg.CertFingerprints) > 0 {
+		params["cert-fingerprints"] = strings.Join(cfg.CertFingerprints, ",")
+	}
+	if cfg.Console {
+		params["console"] = "true"
+	}
+	if cfg.ColorDepth > 0 {
+		params["color-depth"] = cast.ToString(cfg.ColorDepth)
+	}
+
+	for k, v := range map[string]string{
+		"security":        cfg.Security,
+		"domain":          cfg.Domain,
+		"server-layout":   cfg.ServerLayout,
+		"timezone":        cfg.Timezone,
+		"remote-app":      cfg.RemoteApp,
+		"remote-app-dir":  cfg.RemoteAppDir,
+		"remote-app-args": cfg.RemoteAppArgs,
+	} {
+		if v != "" {
+			params[k] = v
+		}
+	}
+}
+
+// setTerminalParameters maps the terminal options and key based ssh accounts to guacd parameters
+func setTerminalParameters(params map[string]string, opts *TerminalOptions, account *model.Account) {
+	if account.AccountType == model.AUTHMETHOD_PUBLICKEY {
+		delete(params, "password")
+		params["private-key"] = account.Pk
+		if account.Phrase != "" {
+			params["passphrase"] = account.Phrase
+		}
+	}
+
+	if opts == nil {
+		return
+	}
+	if opts.FontName != "" {
+		params["font-name"] = opts.FontName
+	}
+	if opts.FontSize > 0 {
+		params["font-size"] = cast.ToString(opts.FontSize)
+	}
+	if opts.ColorScheme != "" {
+		params["color-scheme"] = opts.ColorScheme
+	}
+	if opts.Scrollback > 0 {
+		params["scrollback"] = cast.ToString(opts.Scrollback)
+	}
+	if opts.TypescriptName != "" {
+		params["typescript-path"] = RECORDING_PATH
+		params["typescript-name"] = opts.TypescriptName
+		params["create-typescript-path"] = "true"
+	}
+}
+
 // handshake
 //
 //	https://guacamole.apache.org/doc/gug/guacamole-protocol.html#handshake-phase
@@ -310,11 +414,23 @@ func (t *Tunnel) assert(opcode string) (instruction *Instruction, err error) {
 
 func (t *Tunnel) Close() {
 	tunneling.CloseTunnels(t.SessionId)
+	t.release()
 }
 
 func (t *Tunnel) Disconnect() {
 	logger.L().Debug("client disconnect")
 	t.WriteInstruction(NewInstruction("disconnect"))
+	t.release()
+}
+
+// release gives the tunnel back to the pool once, the tunnel of a session owns its connection mapping
+func (t *Tunnel) release() {
+	if t == nil || t.endpoint == nil {
+		return
+	}
+	t.releaseOnce.Do(func() {
+		DefaultPool.release(t.ConnectionId, t.endpoint, t.SessionId != "")
+	})
 }
 
 // HandleFileUpload handles file upload request
@@ -1,8 +1,12 @@
 package guacd
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 const (
@@ -32,9 +36,10 @@ func (i *Instruction) String() string {
 		return i.cache
 	}
 
-	i.cache = fmt.Sprintf("%d.%s", len(i.Opcode), i.Opcode)
+	// Lengths count unicode code points, not bytes
+	i.cache = fmt.Sprintf("%d.%s", utf8.RuneCountInString(i.Opcode), i.Opcode)
 	for _, value := range i.Args {
-		i.cache += fmt.Sprintf(",%d.%s", len(value), value)
+		i.cache += fmt.Sprintf(",%d.%s", utf8.RuneCountInString(value), value)
 	}
 	i.cache += string(delimiter)
 	return i.cache
@@ -65,3 +70,67 @@ func IsActive(p []byte) bool {
 	i := (&Instruction{}).Parse(string(p))
 	return i.Opcode == "mouse" || i.Opcode == "key"
 }
+
+// ErrMalformedInstruction is returned for data that does not follow the instruction format
+var ErrMalformedInstruction = errors.New("malformed instruction")
+
+// ParseInstructions splits data into the complete instructions it holds, following the length prefix of each element
+// so values containing delimiters are kept intact. Bytes of each instruction are kept as they were received, the
+// bytes of a trailing instruction that is not complete yet are returned as rest.
+func ParseInstructions(data []byte) (instructions []*Instruction, rest []byte, err error) {
+	for start := 0; start < len(data); {
+		var elements []string
+		pos := start
+		for {
+			dot := bytes.IndexByte(data[pos:], '.')
+			if dot < 0 {
+				if !isDigits(data[pos:]) {
+					return nil, nil, fmt.Errorf("%w: invalid element length at %d", ErrMalformedInstruction, pos)
+				}
+				return instructions, data[start:], nil
+			}
+			// Lengths are plain decimal numbers, Atoi alone would also take a sign
+			if dot == 0 || !isDigits(data[pos:pos+dot]) {
+				return nil, nil, fmt.Errorf("%w: invalid element length at %d", ErrMalformedInstruction, pos)
+			}
+			n, err := strconv.Atoi(string(data[pos : pos+dot]))
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: invalid element length at %d", ErrMalformedInstruction, pos)
+			}
+			// Lengths count unicode code points, not bytes
+			value := pos + dot + 1
+			end := value
+			for i := 0; i < n; i++ {
+				// A code point may be split over two reads as well
+				if end >= len(data) || !utf8.FullRune(data[end:]) {
+					return instructions, data[start:], nil
+				}
+				_, size := utf8.DecodeRune(data[end:])
+				end += size
+			}
+			if end >= len(data) {
+				return instructions, data[start:], nil
+			}
+			elements = append(elements, string(data[value:end]))
+			pos = end + 1
+			if data[end] == delimiter {
+				break
+			}
+			if data[end] != ',' {
+				return nil, nil, fmt.Errorf("%w: unexpected %q at %d", ErrMalformedInstruction, data[end], end)
+			}
+		}
+		instructions = append(instructions, &Instruction{Opcode: elements[0], Args: elements[1:], cache: string(data[start:pos])})
+		start = pos
+	}
+	return instructions, nil, nil
+}
+
+func isDigits(p []byte) bool {
+	for _, c := range p {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
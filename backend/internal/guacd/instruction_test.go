@@ -0,0 +1,155 @@
+package guacd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseInstructions(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []*Instruction
+		rest string
+	}{
+		{
+			name: "complete",
+			data: "4.size,1.0,4.1024,3.768;",
+			want: []*Instruction{NewInstruction("size", "0", "1024", "768")},
+		},
+		{
+			name: "several",
+			data: "4.sync,8.12345678;3.nop;",
+			want: []*Instruction{NewInstruction("sync", "12345678"), NewInstruction("nop")},
+		},
+		{
+			name: "delimiters inside values",
+			data: "9.clipboard,1.1,5.a,b;c;",
+			want: []*Instruction{NewInstruction("clipboard", "1", "a,b;c")},
+		},
+		{
+			name: "empty element",
+			data: "3.key,0.;",
+			want: []*Instruction{NewInstruction("key", "")},
+		},
+		{
+			name: "multi-byte code points",
+			data: "4.name,2.日本,3.é€😀;",
+			want: []*Instruction{NewInstruction("name", "日本", "é€😀")},
+		},
+		{
+			name: "incomplete length",
+			data: "3.nop;12",
+			want: []*Instruction{NewInstruction("nop")},
+			rest: "12",
+		},
+		{
+			name: "incomplete value",
+			data: "3.nop;4.size,4.10",
+			want: []*Instruction{NewInstruction("nop")},
+			rest: "4.size,4.10",
+		},
+		{
+			name: "incomplete multi-byte value",
+			data: "4.name,2.日\xe6\x9c",
+			rest: "4.name,2.日\xe6\x9c",
+		},
+		{
+			name: "length covering a delimiter",
+			data: "4.nop;;",
+			want: []*Instruction{NewInstruction("nop;")},
+		},
+		{
+			name: "missing delimiter",
+			data: "3.nop",
+			rest: "3.nop",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rest, err := ParseInstructions([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("ParseInstructions() error = %v", err)
+			}
+			if string(rest) != tt.rest {
+				t.Errorf("ParseInstructions() rest = %q, want %q", rest, tt.rest)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseInstructions() got %d instructions, want %d", len(got), len(tt.want))
+			}
+			for i, ins := range got {
+				if ins.Opcode != tt.want[i].Opcode || len(ins.Args) != len(tt.want[i].Args) ||
+					(len(ins.Args) > 0 && !reflect.DeepEqual(ins.Args, tt.want[i].Args)) {
+					t.Errorf("instruction %d = %q %q, want %q %q", i, ins.Opcode, ins.Args, tt.want[i].Opcode, tt.want[i].Args)
+				}
+				if ins.String() != tt.want[i].String() {
+					t.Errorf("instruction %d bytes = %q, want %q", i, ins.String(), tt.want[i].String())
+				}
+			}
+		})
+	}
+}
+
+func TestParseInstructionsSplit(t *testing.T) {
+	data := "4.size,1.0,4.1024,3.768;9.clipboard,1.1,10.text/plain;4.blob,1.1,2.日本;3.end,1.1;"
+	whole, rest, err := ParseInstructions([]byte(data))
+	if err != nil || len(rest) > 0 {
+		t.Fatalf("ParseInstructions() rest = %q, error = %v", rest, err)
+	}
+
+	// Every split point, including inside a length and inside a multi-byte code point, gives the same instructions
+	for i := 1; i < len(data); i++ {
+		var got []*Instruction
+		var pending []byte
+		for _, read := range []string{data[:i], data[i:]} {
+			instructions, rest, err := ParseInstructions(append(pending, read...))
+			if err != nil {
+				t.Fatalf("split at %d: error = %v", i, err)
+			}
+			got = append(got, instructions...)
+			pending = append([]byte(nil), rest...)
+		}
+		if len(pending) > 0 {
+			t.Errorf("split at %d: pending = %q", i, pending)
+		}
+		if len(got) != len(whole) {
+			t.Fatalf("split at %d: got %d instructions, want %d", i, len(got), len(whole))
+		}
+		for j := range got {
+			if got[j].String() != whole[j].String() {
+				t.Errorf("split at %d: instruction %d = %q, want %q", i, j, got[j].String(), whole[j].String())
+			}
+		}
+	}
+}
+
+func TestParseInstructionsMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "letters in length", data: "x.nop;"},
+		{name: "letters before any dot", data: "nop"},
+		{name: "empty length", data: ".nop;"},
+		{name: "negative length", data: "-3.nop;"},
+		{name: "signed length", data: "+3.nop;"},
+		{name: "length overflow", data: "99999999999999999999.nop;"},
+		{name: "length too short", data: "2.nop;"},
+		{name: "length too long", data: "5.nop;,x"},
+		{name: "unexpected separator", data: "3.nop:"},
+		{name: "after a complete instruction", data: "3.nop;x"},
+		{name: "bad second element", data: "3.key,a.1;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rest, err := ParseInstructions([]byte(tt.data))
+			if !errors.Is(err, ErrMalformedInstruction) {
+				t.Fatalf("ParseInstructions() = %v, %q, error = %v, want ErrMalformedInstruction", got, rest, err)
+			}
+			if got != nil || rest != nil {
+				t.Errorf("ParseInstructions() returned %v, %q with an error", got, rest)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package guacd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/pkg/config"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+const (
+	dialTimeout                = time.Second * 3
+	defaultHealthCheckInterval = time.Second * 10
+)
+
+// Endpoint is a guacd daemon of the pool
+type Endpoint struct {
+	Addr    string
+	healthy atomic.Bool
+	active  atomic.Int64
+}
+
+// Healthy tells whether the last health check of the endpoint succeeded
+func (e *Endpoint) Healthy() bool {
+	return e.healthy.Load()
+}
+
+// Active returns the number of open tunnels to the endpoint
+func (e *Endpoint) Active() int64 {
+	return e.active.Load()
+}
+
+// Pool spreads new connections over the healthy guacd endpoints with the fewest tunnels, and remembers which
+// endpoint serves each connection so tunnels joining it reach the same daemon. The mapping lives in the process,
+// like the online sessions monitoring looks up, so a connection can only be joined through the replica serving
+// it and several replicas need sticky routing for monitoring.
+type Pool struct {
+	endpoints   []*Endpoint
+	connections sync.Map // connection id to *Endpoint
+	interval    time.Duration
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+// NewPool creates a pool of guacd endpoints given as host:port, all considered healthy until checked
+func NewPool(addrs []string, interval time.Duration) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		interval: interval,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	for _, addr := range addrs {
+		e := &Endpoint{Addr: addr}
+		e.healthy.Store(true)
+		p.endpoints = append(p.endpoints, e)
+	}
+	return p
+}
+
+// Global guacd pool instance
+var DefaultPool *Pool
+
+// InitPool creates the pool from the config and starts its health checks
+func InitPool() {
+	cfg := config.Cfg.Guacd
+	addrs := cfg.Endpoints
+	if len(addrs) == 0 {
+		addrs = []string{net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))}
+	}
+	interval := defaultHealthCheckInterval
+	if cfg.HealthCheckInterval > 0 {
+		interval = time.Duration(cfg.HealthCheckInterval) * time.Second
+	}
+
+	DefaultPool = NewPool(addrs, interval)
+	DefaultPool.Start()
+}
+
+// StopPool stops the health checks
+func StopPool() {
+	if DefaultPool != nil {
+		DefaultPool.Stop()
+	}
+}
+
+// Start checks the endpoints periodically
+func (p *Pool) Start() {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		p.check()
+		tk := time.NewTicker(p.interval)
+		defer tk.Stop()
+		for {
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-tk.C:
+				p.check()
+			}
+		}
+	}()
+
+	logger.L().Info("Guacd pool started", zap.Int("endpoints", len(p.endpoints)), zap.Duration("interval", p.interval))
+}
+
+// Stop stops the health checks
+func (p *Pool) Stop() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+// Endpoints returns the endpoints of the pool
+func (p *Pool) Endpoints() []*Endpoint {
+	return p.endpoints
+}
+
+func (p *Pool) check() {
+	wg := sync.WaitGroup{}
+	for _, e := range p.endpoints {
+		wg.Add(1)
+		go func(e *Endpoint) {
+			defer wg.Done()
+			err := probe(e.Addr)
+			if healthy := err == nil; e.healthy.Swap(healthy) != healthy {
+				if healthy {
+					logger.L().Info("Guacd endpoint recovered", zap.String("addr", e.Addr))
+				} else {
+					logger.L().Warn("Guacd endpoint unhealthy", zap.String("addr", e.Addr), zap.Error(err))
+				}
+			}
+		}(e)
+	}
+	wg.Wait()
+}
+
+// probe only opens a TCP connection, guacd forks a process for every handshake started
+func probe(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Dial connects to the healthy endpoint with the fewest tunnels, moving on to the next one when it is unreachable.
+// Unhealthy endpoints are only tried when none is healthy, the checks may lag behind a recovery.
+func (p *Pool) Dial() (net.Conn, *Endpoint, error) {
+	candidates := make([]*Endpoint, 0, len(p.endpoints))
+	for _, e := range p.endpoints {
+		if e.Healthy() {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = append(candidates, p.endpoints...)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Active() < candidates[j].Active() })
+
+	var err error
+	for _, e := range candidates {
+		var conn net.Conn
+		if conn, err = p.dial(e); err == nil {
+			return conn, e, nil
+		}
+		e.healthy.Store(false)
+		logger.L().Warn("Guacd endpoint unreachable", zap.String("addr", e.Addr), zap.Error(err))
+	}
+	return nil, nil, fmt.Errorf("no guacd endpoint reachable: %w", err)
+}
+
+// DialConnection connects to the endpoint serving a connection, to join it
+func (p *Pool) DialConnection(connectionId string) (net.Conn, *Endpoint, error) {
+	v, ok := p.connections.Load(connectionId)
+	if !ok {
+		return nil, nil, fmt.Errorf("guacd connection %s is not served by this pool", connectionId)
+	}
+	e := v.(*Endpoint)
+	conn, err := p.dial(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, e, nil
+}
+
+func (p *Pool) dial(e *Endpoint) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", e.Addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	e.active.Add(1)
+	return conn, nil
+}
+
+// bind remembers the endpoint serving a connection
+func (p *Pool) bind(connectionId string, e *Endpoint) {
+	p.connections.Store(connectionId, e)
+}
+
+// release forgets a tunnel, owner tunnels take the connection mapping with them
+func (p *Pool) release(connectionId string, e *Endpoint, owner bool) {
+	e.active.Add(-1)
+	if owner {
+		p.connections.Delete(connectionId)
+	}
+}
@@ -0,0 +1,254 @@
+package guacd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+)
+
+// The watermark uses a layer, a buffer and a stream index far from the ones guacd allocates
+const (
+	watermarkLayer  = "100000"
+	watermarkBuffer = "-100000"
+	watermarkStream = "100000"
+	watermarkZ      = "2147483647"
+
+	// channel mask replacing the destination, redrawing after a resize does not darken the watermark
+	maskSrc = "12"
+
+	watermarkScale  = 2
+	watermarkMargin = 48
+	blobMaxLength   = 6048
+)
+
+var watermarkColor = color.NRGBA{R: 128, G: 128, B: 128, A: 40}
+
+// Watermark draws a text tiled over the display, in a layer above everything guacd draws
+type Watermark struct {
+	text string
+	tile []byte
+	w, h int
+	sent bool
+
+	// size of the display, zero until it is known
+	displayW, displayH int
+}
+
+// NewWatermark renders the tile of a watermark, characters outside printable ASCII are drawn as '?', see
+// CanDrawWatermark
+func NewWatermark(text string) (*Watermark, error) {
+	m := &Watermark{}
+	if err := m.render(text); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Watermark) render(text string) error {
+	img := renderWatermarkTile(text)
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		return err
+	}
+	m.text, m.tile, m.w, m.h, m.sent = text, buf.Bytes(), img.Bounds().Dx(), img.Bounds().Dy(), false
+	return nil
+}
+
+// Update renders a new text, it returns the instructions drawing it when the display is sized already
+func (m *Watermark) Update(text string) ([]byte, error) {
+	if text == m.text {
+		return nil, nil
+	}
+	if err := m.render(text); err != nil {
+		return nil, err
+	}
+	if m.displayW == 0 || m.displayH == 0 {
+		return nil, nil
+	}
+	return m.Resize(m.displayW, m.displayH), nil
+}
+
+// Resize returns the instructions covering a display of w x h pixels with the watermark, the tile is only sent
+// with the first of them
+func (m *Watermark) Resize(w, h int) []byte {
+	m.displayW, m.displayH = w, h
+	width, height := strconv.Itoa(w), strconv.Itoa(h)
+	out := &bytes.Buffer{}
+	if !m.sent {
+		out.Write(NewInstruction("size", watermarkBuffer, strconv.Itoa(m.w), strconv.Itoa(m.h)).Bytes())
+		out.Write(NewInstruction("img", watermarkStream, maskSrc, watermarkBuffer, "image/png", "0", "0").Bytes())
+		data := base64.StdEncoding.EncodeToString(m.tile)
+		for len(data) > 0 {
+			n := min(len(data), blobMaxLength)
+			out.Write(NewInstruction("blob", watermarkStream, data[:n]).Bytes())
+			data = data[n:]
+		}
+		out.Write(NewInstruction("end", watermarkStream).Bytes())
+		m.sent = true
+	}
+	out.Write(NewInstruction("size", watermarkLayer, width, height).Bytes())
+	out.Write(NewInstruction("move", watermarkLayer, "0", "0", "0", watermarkZ).Bytes())
+	out.Write(NewInstruction("rect", watermarkLayer, "0", "0", width, height).Bytes())
+	out.Write(NewInstruction("lfill", maskSrc, watermarkLayer, watermarkBuffer).Bytes())
+	return out.Bytes()
+}
+
+// CanDrawWatermark tells whether the font of the watermark has every character of a text
+func CanDrawWatermark(text string) bool {
+	for _, r := range text {
+		if r < 0x20 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// IsWatermarkAck tells whether an instruction of the browser acknowledges the watermark stream, guacd does not
+// know about it
+func IsWatermarkAck(ins *Instruction) bool {
+	return ins.Opcode == "ack" && len(ins.Args) > 0 && ins.Args[0] == watermarkStream
+}
+
+// renderWatermarkTile draws the text twice, the second copy shifted by half a tile so the pattern is staggered
+func renderWatermarkTile(text string) *image.NRGBA {
+	glyphs := []rune(text)
+	textW := len(glyphs) * (glyphWidth + 1) * watermarkScale
+	textH := glyphHeight * watermarkScale
+	w, h := max(textW+watermarkMargin, 160), (textH+watermarkMargin)*2
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	drawText(img, glyphs, watermarkMargin/2, watermarkMargin/2)
+	drawText(img, glyphs, watermarkMargin/2+w/2, h/2+watermarkMargin/2)
+	return img
+}
+
+// drawText draws glyphs from x, y wrapping around the edges of the tile
+func drawText(img *image.NRGBA, glyphs []rune, x, y int) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	for _, r := range glyphs {
+		if r < 0x20 || r > 0x7e {
+			r = '?'
+		}
+		for col, bits := range watermarkFont[r-0x20] {
+			for row := 0; row < glyphHeight; row++ {
+				if bits&(1<<row) == 0 {
+					continue
+				}
+				for dx := 0; dx < watermarkScale; dx++ {
+					for dy := 0; dy < watermarkScale; dy++ {
+						px, py := (x+col*watermarkScale+dx)%w, (y+row*watermarkScale+dy)%h
+						img.SetNRGBA(px, py, watermarkColor)
+					}
+				}
+			}
+		}
+		x += (glyphWidth + 1) * watermarkScale
+	}
+}
+
+const (
+	glyphWidth  = 5
+	glyphHeight = 7
+)
+
+// watermarkFont is a 5x7 font of printable ASCII, one byte per column with the top row in the lowest bit
+var watermarkFont = [95][glyphWidth]byte{
+	{0x00, 0x00, 0x00, 0x00, 0x00}, // space
+	{0x00, 0x00, 0x5f, 0x00, 0x00}, // !
+	{0x00, 0x07, 0x00, 0x07, 0x00}, // "
+	{0x14, 0x7f, 0x14, 0x7f, 0x14}, // #
+	{0x24, 0x2a, 0x7f, 0x2a, 0x12}, // $
+	{0x23, 0x13, 0x08, 0x64, 0x62}, // %
+	{0x36, 0x49, 0x55, 0x22, 0x50}, // &
+	{0x00, 0x05, 0x03, 0x00, 0x00}, // '
+	{0x00, 0x1c, 0x22, 0x41, 0x00}, // (
+	{0x00, 0x41, 0x22, 0x1c, 0x00}, // )
+	{0x08, 0x2a, 0x1c, 0x2a, 0x08}, // *
+	{0x08, 0x08, 0x3e, 0x08, 0x08}, // +
+	{0x00, 0x50, 0x30, 0x00, 0x00}, // ,
+	{0x08, 0x08, 0x08, 0x08, 0x08}, // -
+	{0x00, 0x60, 0x60, 0x00, 0x00}, // .
+	{0x20, 0x10, 0x08, 0x04, 0x02}, // /
+	{0x3e, 0x51, 0x49, 0x45, 0x3e}, // 0
+	{0x00, 0x42, 0x7f, 0x40, 0x00}, // 1
+	{0x42, 0x61, 0x51, 0x49, 0x46}, // 2
+	{0x21, 0x41, 0x45, 0x4b, 0x31}, // 3
+	{0x18, 0x14, 0x12, 0x7f, 0x10}, // 4
+	{0x27, 0x45, 0x45, 0x45, 0x39}, // 5
+	{0x3c, 0x4a, 0x49, 0x49, 0x30}, // 6
+	{0x01, 0x71, 0x09, 0x05, 0x03}, // 7
+	{0x36, 0x49, 0x49, 0x49, 0x36}, // 8
+	{0x06, 0x49, 0x49, 0x29, 0x1e}, // 9
+	{0x00, 0x36, 0x36, 0x00, 0x00}, // :
+	{0x00, 0x56, 0x36, 0x00, 0x00}, // ;
+	{0x08, 0x14, 0x22, 0x41, 0x00}, // <
+	{0x14, 0x14, 0x14, 0x14, 0x14}, // =
+	{0x00, 0x41, 0x22, 0x14, 0x08}, // >
+	{0x02, 0x01, 0x51, 0x09, 0x06}, // ?
+	{0x32, 0x49, 0x79, 0x41, 0x3e}, // @
+	{0x7e, 0x11, 0x11, 0x11, 0x7e}, // A
+	{0x7f, 0x49, 0x49, 0x49, 0x36}, // B
+	{0x3e, 0x41, 0x41, 0x41, 0x22}, // C
+	{0x7f, 0x41, 0x41, 0x22, 0x1c}, // D
+	{0x7f, 0x49, 0x49, 0x49, 0x41}, // E
+	{0x7f, 0x09, 0x09, 0x09, 0x01}, // F
+	{0x3e, 0x41, 0x49, 0x49, 0x7a}, // G
+	{0x7f, 0x08, 0x08, 0x08, 0x7f}, // H
+	{0x00, 0x41, 0x7f, 0x41, 0x00}, // I
+	{0x20, 0x40, 0x41, 0x3f, 0x01}, // J
+	{0x7f, 0x08, 0x14, 0x22, 0x41}, // K
+	{0x7f, 0x40, 0x40, 0x40, 0x40}, // L
+	{0x7f, 0x02, 0x0c, 0x02, 0x7f}, // M
+	{0x7f, 0x04, 0x08, 0x10, 0x7f}, // N
+	{0x3e, 0x41, 0x41, 0x41, 0x3e}, // O
+	{0x7f, 0x09, 0x09, 0x09, 0x06}, // P
+	{0x3e, 0x41, 0x51, 0x21, 0x5e}, // Q
+	{0x7f, 0x09, 0x19, 0x29, 0x46}, // R
+	{0x46, 0x49, 0x49, 0x49, 0x31}, // S
+	{0x01, 0x01, 0x7f, 0x01, 0x01}, // T
+	{0x3f, 0x40, 0x40, 0x40, 0x3f}, // U
+	{0x1f, 0x20, 0x40, 0x20, 0x1f}, // V
+	{0x3f, 0x40, 0x38, 0x40, 0x3f}, // W
+	{0x63, 0x14, 0x08, 0x14, 0x63}, // X
+	{0x07, 0x08, 0x70, 0x08, 0x07}, // Y
+	{0x61, 0x51, 0x49, 0x45, 0x43}, // Z
+	{0x00, 0x7f, 0x41, 0x41, 0x00}, // [
+	{0x02, 0x04, 0x08, 0x10, 0x20}, // backslash
+	{0x00, 0x41, 0x41, 0x7f, 0x00}, // ]
+	{0x04, 0x02, 0x01, 0x02, 0x04}, // ^
+	{0x40, 0x40, 0x40, 0x40, 0x40}, // _
+	{0x00, 0x01, 0x02, 0x04, 0x00}, // `
+	{0x20, 0x54, 0x54, 0x54, 0x78}, // a
+	{0x7f, 0x48, 0x44, 0x44, 0x38}, // b
+	{0x38, 0x44, 0x44, 0x44, 0x20}, // c
+	{0x38, 0x44, 0x44, 0x48, 0x7f}, // d
+	{0x38, 0x54, 0x54, 0x54, 0x18}, // e
+	{0x08, 0x7e, 0x09, 0x01, 0x02}, // f
+	{0x0c, 0x52, 0x52, 0x52, 0x3e}, // g
+	{0x7f, 0x08, 0x04, 0x04, 0x78}, // h
+	{0x00, 0x44, 0x7d, 0x40, 0x00}, // i
+	{0x20, 0x40, 0x44, 0x3d, 0x00}, // j
+	{0x7f, 0x10, 0x28, 0x44, 0x00}, // k
+	{0x00, 0x41, 0x7f, 0x40, 0x00}, // l
+	{0x7c, 0x04, 0x18, 0x04, 0x78}, // m
+	{0x7c, 0x08, 0x04, 0x04, 0x78}, // n
+	{0x38, 0x44, 0x44, 0x44, 0x38}, // o
+	{0x7c, 0x14, 0x14, 0x14, 0x08}, // p
+	{0x08, 0x14, 0x14, 0x18, 0x7c}, // q
+	{0x7c, 0x08, 0x04, 0x04, 0x08}, // r
+	{0x48, 0x54, 0x54, 0x54, 0x20}, // s
+	{0x04, 0x3f, 0x44, 0x40, 0x20}, // t
+	{0x3c, 0x40, 0x40, 0x20, 0x7c}, // u
+	{0x1c, 0x20, 0x40, 0x20, 0x1c}, // v
+	{0x3c, 0x40, 0x30, 0x40, 0x3c}, // w
+	{0x44, 0x28, 0x10, 0x28, 0x44}, // x
+	{0x0c, 0x50, 0x50, 0x50, 0x3c}, // y
+	{0x44, 0x64, 0x54, 0x4c, 0x44}, // z
+	{0x00, 0x08, 0x36, 0x41, 0x00}, // {
+	{0x00, 0x00, 0x7f, 0x00, 0x00}, // |
+	{0x00, 0x41, 0x36, 0x08, 0x00}, // }
+	{0x08, 0x04, 0x08, 0x10, 0x08}, // ~
+}
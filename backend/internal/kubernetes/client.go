@@ -0,0 +1,235 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/veops/oneterm/internal/model"
+)
+
+const (
+	// execProtocol is the channel based subprotocol used by the exec endpoint
+	execProtocol = "v4.channel.k8s.io"
+
+	defaultTimeout = time.Second * 10
+)
+
+// Client is a minimal Kubernetes API client covering workload discovery and pod exec
+type Client struct {
+	baseURL    *url.URL
+	token      string
+	tlsConfig  *tls.Config
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the API server reachable at ip:port.
+// serverName is the original API server host, used for certificate verification when tunneled.
+func NewClient(ip string, port int, serverName string, cfg *model.KubernetesConfig, account *model.Account) (*Client, error) {
+	if cfg == nil {
+		cfg = &model.KubernetesConfig{}
+	}
+
+	scheme := cfg.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CaCert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(cfg.CaCert)) {
+			return nil, fmt.Errorf("invalid cluster ca certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	c := &Client{
+		baseURL:   &url.URL{Scheme: scheme, Host: net.JoinHostPort(ip, strconv.Itoa(port))},
+		tlsConfig: tlsConfig,
+	}
+
+	switch account.AccountType {
+	case model.AUTHMETHOD_TOKEN:
+		c.token = account.Password
+	case model.AUTHMETHOD_CERT:
+		cert, err := tls.X509KeyPair([]byte(account.Pk), []byte(account.Pk))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	default:
+		return nil, fmt.Errorf("invalid authmethod %d for kubernetes", account.AccountType)
+	}
+
+	c.httpClient = &http.Client{
+		Timeout:   defaultTimeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	return c, nil
+}
+
+// Namespace is a trimmed down v1.Namespace
+type Namespace struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// Pod is a trimmed down v1.Pod
+type Pod struct {
+	Name       string   `json:"name"`
+	Namespace  string   `json:"namespace"`
+	Status     string   `json:"status"`
+	Node       string   `json:"node"`
+	Containers []string `json:"containers"`
+}
+
+type objectMeta struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+// ListNamespaces lists the namespaces visible to the account
+func (c *Client) ListNamespaces(ctx context.Context) ([]*Namespace, error) {
+	list := struct {
+		Items []struct {
+			Metadata objectMeta `json:"metadata"`
+			Status   struct {
+				Phase string `json:"phase"`
+			} `json:"status"`
+		} `json:"items"`
+	}{}
+	if err := c.get(ctx, "/api/v1/namespaces", &list); err != nil {
+		return nil, err
+	}
+
+	res := make([]*Namespace, 0, len(list.Items))
+	for _, item := range list.Items {
+		res = append(res, &Namespace{Name: item.Metadata.Name, Status: item.Status.Phase})
+	}
+	return res, nil
+}
+
+// ListPods lists the pods of a namespace
+func (c *Client) ListPods(ctx context.Context, namespace string) ([]*Pod, error) {
+	list := struct {
+		Items []struct {
+			Metadata objectMeta `json:"metadata"`
+			Spec     struct {
+				NodeName   string `json:"nodeName"`
+				Containers []struct {
+					Name string `json:"name"`
+				} `json:"containers"`
+			} `json:"spec"`
+			Status struct {
+				Phase string `json:"phase"`
+			} `json:"status"`
+		} `json:"items"`
+	}{}
+	if err := c.get(ctx, fmt.Sprintf("/api/v1/namespaces/%s/pods", url.PathEscape(namespace)), &list); err != nil {
+		return nil, err
+	}
+
+	res := make([]*Pod, 0, len(list.Items))
+	for _, item := range list.Items {
+		pod := &Pod{
+			Name:      item.Metadata.Name,
+			Namespace: item.Metadata.Namespace,
+			Status:    item.Status.Phase,
+			Node:      item.Spec.NodeName,
+		}
+		for _, container := range item.Spec.Containers {
+			pod.Containers = append(pod.Containers, container.Name)
+		}
+		res = append(res, pod)
+	}
+	return res, nil
+}
+
+// Exec opens an interactive tty exec stream into the target container
+func (c *Client) Exec(ctx context.Context, target *model.WorkloadTarget, command []string) (*ExecStream, error) {
+	if target == nil || target.Namespace == "" || target.Pod == "" {
+		return nil, fmt.Errorf("namespace and pod are required")
+	}
+
+	query := url.Values{}
+	for _, arg := range command {
+		query.Add("command", arg)
+	}
+	if target.Container != "" {
+		query.Set("container", target.Container)
+	}
+	// stderr is merged into stdout when a tty is allocated
+	query.Set("stdin", "true")
+	query.Set("stdout", "true")
+	query.Set("tty", "true")
+
+	u := *c.baseURL
+	u.Scheme = map[string]string{"https": "wss", "http": "ws"}[u.Scheme]
+	u.Path = fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/exec", url.PathEscape(target.Namespace), url.PathEscape(target.Pod))
+	u.RawQuery = query.Encode()
+
+	dialer := &websocket.Dialer{
+		TLSClientConfig:  c.tlsConfig,
+		HandshakeTimeout: defaultTimeout,
+		Subprotocols:     []string{execProtocol},
+	}
+	conn, resp, err := dialer.DialContext(ctx, u.String(), c.header())
+	if err != nil {
+		if resp != nil {
+			defer resp.Body.Close()
+			bs, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			return nil, fmt.Errorf("exec failed with status %d: %s", resp.StatusCode, string(bs))
+		}
+		return nil, err
+	}
+
+	return newExecStream(conn), nil
+}
+
+func (c *Client) header() http.Header {
+	header := http.Header{}
+	if c.token != "" {
+		header.Set("Authorization", "Bearer "+c.token)
+	}
+	return header
+}
+
+func (c *Client) get(ctx context.Context, path string, out any) error {
+	u := *c.baseURL
+	u.Path = path
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header = c.header()
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bs, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("request %s failed with status %d: %s", path, resp.StatusCode, string(bs))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,98 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Channels of the v4.channel.k8s.io subprotocol
+const (
+	channelStdin  byte = 0
+	channelStdout byte = 1
+	channelStderr byte = 2
+	channelError  byte = 3
+	channelResize byte = 4
+)
+
+// ExecStream multiplexes stdin, stdout and resize events over an exec websocket
+type ExecStream struct {
+	conn    *websocket.Conn
+	wmtx    sync.Mutex
+	pending []byte
+	err     error
+}
+
+func newExecStream(conn *websocket.Conn) *ExecStream {
+	return &ExecStream{conn: conn}
+}
+
+// Read reads tty output; it returns io.EOF once the remote process exits
+func (s *ExecStream) Read(p []byte) (n int, err error) {
+	for len(s.pending) == 0 {
+		_, msg, err := s.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+		if len(msg) == 0 {
+			continue
+		}
+		switch msg[0] {
+		case channelStdout, channelStderr:
+			s.pending = msg[1:]
+		case channelError:
+			status := struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			}{}
+			if err := json.Unmarshal(msg[1:], &status); err == nil && status.Status != "Success" {
+				s.err = fmt.Errorf("%s", status.Message)
+			}
+			return 0, io.EOF
+		}
+	}
+
+	n = copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return
+}
+
+// Write sends p to the container stdin
+func (s *ExecStream) Write(p []byte) (n int, err error) {
+	if err = s.write(channelStdin, p); err != nil {
+		return
+	}
+	return len(p), nil
+}
+
+// Resize changes the tty size of the remote process
+func (s *ExecStream) Resize(w, h int) error {
+	bs, err := json.Marshal(map[string]int{"Width": w, "Height": h})
+	if err != nil {
+		return err
+	}
+	return s.write(channelResize, bs)
+}
+
+// Err returns the failure reported by the API server when the process ended, if any
+func (s *ExecStream) Err() error {
+	return s.err
+}
+
+// Close closes the underlying websocket
+func (s *ExecStream) Close() error {
+	return s.conn.Close()
+}
+
+func (s *ExecStream) write(channel byte, p []byte) error {
+	s.wmtx.Lock()
+	defer s.wmtx.Unlock()
+
+	return s.conn.WriteMessage(websocket.BinaryMessage, append([]byte{channel}, p...))
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -139,6 +140,18 @@ type Asset struct {
 	// Web-specific configuration (only valid when protocols contain http/https)
 	WebConfig *WebConfig `json:"web_config,omitempty" gorm:"column:web_config;type:json"`
 
+	// Terminal backend of ssh and telnet connections, native (default) or guacd
+	TerminalBackend string `json:"terminal_backend" gorm:"column:terminal_backend;size:16"`
+
+	// RDP-specific configuration (only valid when protocols contain rdp)
+	RdpConfig *RdpConfig `json:"rdp_config,omitempty" gorm:"column:rdp_config;type:json"`
+
+	// Kubernetes-specific configuration (only valid when protocols contain kubernetes)
+	KubernetesConfig *KubernetesConfig `json:"kubernetes_config,omitempty" gorm:"column:kubernetes_config;type:json"`
+
+	// Docker-specific configuration (only valid when protocols contain docker)
+	DockerConfig *DockerConfig `json:"docker_config,omitempty" gorm:"column:docker_config;type:json"`
+
 	Permissions []string              `json:"permissions" gorm:"-"`
 	ResourceId  int                   `json:"resource_id" gorm:"column:resource_id"`
 	CreatorId   int                   `json:"creator_id" gorm:"column:creator_id"`
@@ -221,10 +234,40 @@ func (m *AssetIdPid) TableName() string {
 
 // WebConfig contains Web-specific configuration for assets
 type WebConfig struct {
-	AuthMode      string            `json:"auth_mode"`      // none, smart, manual
+	AuthMode      string            `json:"auth_mode"`      // none, smart, manual, bearer, header
 	LoginAccounts []WebLoginAccount `json:"login_accounts"` // Web login credentials
 	AccessPolicy  string            `json:"access_policy"`  // full_access, read_only
 	ProxySettings *WebProxySettings `json:"proxy_settings"` // Proxy configuration
+
+	// Credentials the proxy adds to every upstream request, users of the asset never see them
+	BearerToken   string            `json:"bearer_token"`   // Sent as Authorization: Bearer in the bearer mode
+	InjectHeaders map[string]string `json:"inject_headers"` // Sent as they are in the header mode
+	// CookieJar keeps the cookies of the target on the server, the browser never receives them. Always on in the
+	// smart mode, the proxy logs in for the user.
+	CookieJar bool `json:"cookie_jar"`
+}
+
+// Auth modes of web assets
+const (
+	WebAuthModeNone   = "none"
+	WebAuthModeSmart  = "smart"
+	WebAuthModeManual = "manual"
+	WebAuthModeBearer = "bearer"
+	WebAuthModeHeader = "header"
+
+	maskedCredential = "******"
+)
+
+// Masked returns a copy of the config with its credentials hidden, for the users of the asset
+func (w *WebConfig) Masked() *WebConfig {
+	cp := *w
+	cp.LoginAccounts = lo.Map(w.LoginAccounts, func(a WebLoginAccount, _ int) WebLoginAccount {
+		a.Password = lo.Ternary(a.Password == "", "", maskedCredential)
+		return a
+	})
+	cp.BearerToken = lo.Ternary(w.BearerToken == "", "", maskedCredential)
+	cp.InjectHeaders = lo.MapValues(w.InjectHeaders, func(_ string, _ string) string { return maskedCredential })
+	return &cp
 }
 
 func (w *WebConfig) Scan(value interface{}) error {
@@ -260,6 +303,159 @@ type WebProxySettings struct {
 	BlockedPaths     []string `json:"blocked_paths"`     // Blocked URL paths
 	RecordingEnabled bool     `json:"recording_enabled"` // Enable session recording
 	WatermarkEnabled bool     `json:"watermark_enabled"` // Enable watermark
+
+	// Extra request headers and form fields to redact from recordings, on top of the built-in credentials
+	RedactHeaders []string `json:"redact_headers"`
+	RedactFields  []string `json:"redact_fields"`
+
+	// Path rules, a request matching a deny rule is refused and once allow rules apply the path has to match one
+	PathRules []WebPathRule `json:"path_rules"`
+
+	// Limits of the files uploaded through the proxy, extensions without the dot. Only multipart bodies are
+	// inspected, a file sent as the raw body of a PUT or POST is not seen as an upload.
+	MaxUploadSize           int64    `json:"max_upload_size"` // Bytes per file, 0 for no limit
+	AllowedUploadExtensions []string `json:"allowed_upload_extensions"`
+	BlockedUploadExtensions []string `json:"blocked_upload_extensions"`
+}
+
+// Actions and pattern types of web path rules
+const (
+	WebPathRuleAllow = "allow"
+	WebPathRuleDeny  = "deny"
+
+	WebPathPatternGlob  = "glob"  // * within a path segment, ** across segments, ? one character
+	WebPathPatternRegex = "regex" // matched against the whole path
+)
+
+// WebPathRule allows or denies the paths matching a pattern, optionally only for some methods and for the sessions
+// allowed by some authorization rules. Admins and shared sessions are not allowed through an authorization rule,
+// rules limited to some authorization rules never apply to them.
+type WebPathRule struct {
+	Action      string   `json:"action"`
+	Pattern     string   `json:"pattern"`
+	PatternType string   `json:"pattern_type"`  // glob by default
+	Methods     []string `json:"methods"`       // empty for all methods
+	AuthRuleIds []int    `json:"auth_rule_ids"` // empty for all sessions, admins and shares included
+}
+
+// Regexp compiles the pattern of the rule
+func (r *WebPathRule) Regexp() (*regexp.Regexp, error) {
+	if r.PatternType == WebPathPatternRegex {
+		return regexp.Compile("^(?:" + r.Pattern + ")$")
+	}
+
+	pattern := []rune(r.Pattern)
+	sb := strings.Builder{}
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				sb.WriteString(".*")
+				i++
+				continue
+			}
+			sb.WriteString("[^/]*")
+		case '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// AppliesTo tells whether the rule applies to a method of a session allowed by an authorization rule
+func (r *WebPathRule) AppliesTo(method string, authRuleId int) bool {
+	if len(r.Methods) > 0 && !lo.ContainsBy(r.Methods, func(m string) bool { return strings.EqualFold(m, method) }) {
+		return false
+	}
+	return len(r.AuthRuleIds) == 0 || lo.Contains(r.AuthRuleIds, authRuleId)
+}
+
+// Terminal backends of ssh and telnet connections
+const (
+	TerminalBackendNative = "native"
+	TerminalBackendGuacd  = "guacd" // rendered by guacd, recorded and watermarked like graphical sessions
+)
+
+// RdpConfig contains RDP-specific configuration for assets
+type RdpConfig struct {
+	Security         string   `json:"security"`          // any (default), nla, nla-ext, tls, rdp or vmconnect
+	Domain           string   `json:"domain"`            // Windows domain to authenticate against
+	VerifyCert       bool     `json:"verify_cert"`       // Verify the server certificate instead of ignoring it
+	CertFingerprints []string `json:"cert_fingerprints"` // SHA-256 fingerprints of trusted server certificates
+	ServerLayout     string   `json:"server_layout"`     // Server keyboard layout like en-us-qwerty, empty for the guacd default
+	Timezone         string   `json:"timezone"`          // IANA timezone forwarded to the session
+	ColorDepth       int      `json:"color_depth"`       // 8, 16, 24 or 32, 0 for the guacd default
+	Console          bool     `json:"console"`           // Connect to the administrative console session
+	RemoteApp        string   `json:"remote_app"`        // RemoteApp program like ||notepad, empty for a full desktop
+	RemoteAppDir     string   `json:"remote_app_dir"`    // Working directory of the RemoteApp program
+	RemoteAppArgs    string   `json:"remote_app_args"`   // Command line arguments of the RemoteApp program
+}
+
+func (r *RdpConfig) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(bytes, r)
+}
+
+func (r RdpConfig) Value() (driver.Value, error) {
+	return json.Marshal(r)
+}
+
+// KubernetesConfig contains Kubernetes-specific configuration for assets
+type KubernetesConfig struct {
+	Scheme             string `json:"scheme"`               // https (default) or http
+	CaCert             string `json:"ca_cert"`              // PEM encoded cluster CA, empty to use system roots
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"` // Skip API server certificate verification
+	DefaultNamespace   string `json:"default_namespace"`    // Namespace preselected when picking pods
+	Shell              string `json:"shell"`                // Shell started in containers, empty to prefer bash then sh
+}
+
+func (k *KubernetesConfig) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(bytes, k)
+}
+
+func (k KubernetesConfig) Value() (driver.Value, error) {
+	return json.Marshal(k)
+}
+
+// DockerConfig contains Docker Engine API configuration for assets
+type DockerConfig struct {
+	Scheme             string `json:"scheme"`               // http (default) or https for TLS protected engines
+	CaCert             string `json:"ca_cert"`              // PEM encoded engine CA, empty to use system roots
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"` // Skip engine certificate verification
+	User               string `json:"user"`                 // User to exec as, empty for the container default
+	Shell              string `json:"shell"`                // Shell started in containers, empty to prefer bash then sh
+}
+
+func (d *DockerConfig) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(bytes, d)
+}
+
+func (d DockerConfig) Value() (driver.Value, error) {
+	return json.Marshal(d)
 }
 
 // IsWebAsset checks if the asset is a Web asset
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"time"
+)
+
+// AuditExport is a background job packing the evidence of sessions into a signed zip bundle,
+// selected by a session id or by user, asset and time range
+type AuditExport struct {
+	Id        int        `json:"id" gorm:"column:id;primarykey;autoIncrement"`
+	SessionId string     `json:"session_id" gorm:"column:session_id;size:128"`
+	Uid       int        `json:"uid" gorm:"column:uid"`
+	AssetId   int        `json:"asset_id" gorm:"column:asset_id"`
+	Start     *time.Time `json:"start" gorm:"column:start"`
+	End       *time.Time `json:"end" gorm:"column:end"`
+
+	Status       string `json:"status" gorm:"column:status;size:32;not null;index"` // pending, running, completed, failed, expired
+	SessionCount int    `json:"session_count" gorm:"column:session_count;default:0"`
+	StorageName  string `json:"storage_name" gorm:"column:storage_name;size:64"`
+	StorageKey   string `json:"storage_key" gorm:"column:storage_key;size:512"`
+	FileSize     int64  `json:"file_size" gorm:"column:file_size;default:0"`
+	Checksum     string `json:"checksum" gorm:"column:checksum;size:64"` // hex encoded SHA-256 of the bundle
+
+	// Ed25519 signature of the bundle manifest, also stored in the bundle as manifest.sig
+	ManifestSignature string `json:"manifest_signature" gorm:"column:manifest_signature;size:128"`
+	SigningKeyId      string `json:"signing_key_id" gorm:"column:signing_key_id;size:32"`
+
+	ErrorMessage string     `json:"error_message" gorm:"column:error_message;type:text"`
+	StartedAt    *time.Time `json:"started_at" gorm:"column:started_at"`
+	CompletedAt  *time.Time `json:"completed_at" gorm:"column:completed_at"`
+
+	CreatorId int       `json:"creator_id" gorm:"column:creator_id"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"column:updated_at"`
+}
+
+func (m *AuditExport) TableName() string {
+	return "audit_export"
+}
+
+// Audit export status, same values as migrations
+const (
+	AuditExportStatusPending   = MigrationStatusPending
+	AuditExportStatusRunning   = MigrationStatusRunning
+	AuditExportStatusCompleted = MigrationStatusCompleted
+	AuditExportStatusFailed    = MigrationStatusFailed
+	// The bundle was deleted by the retention of its storage
+	AuditExportStatusExpired = "expired"
+)
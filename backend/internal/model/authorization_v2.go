@@ -223,6 +223,35 @@ type AccessControl struct {
 
 	MaxSessions    int `json:"max_sessions" gorm:"column:max_sessions"`
 	SessionTimeout int `json:"session_timeout" gorm:"column:session_timeout"`
+
+	// Clipboard size limits of graphical sessions in bytes, 0 for unlimited
+	ClipboardCopyLimit  int `json:"clipboard_copy_limit" gorm:"column:clipboard_copy_limit"`
+	ClipboardPasteLimit int `json:"clipboard_paste_limit" gorm:"column:clipboard_paste_limit"`
+
+	// Watermark overrides the global watermark for the sessions the rule allows, nil keeps it
+	Watermark *WatermarkConfig `json:"watermark,omitempty" gorm:"column:watermark;type:json"`
+}
+
+// Restriction keys of AuthResult.Restrictions
+const (
+	RestrictionClipboardCopyLimit  = "clipboard_copy_limit"
+	RestrictionClipboardPasteLimit = "clipboard_paste_limit"
+	RestrictionWatermark           = "watermark"
+)
+
+// Restrictions returns the limits of a rule that apply to sessions it allows
+func (a AccessControl) Restrictions() map[string]interface{} {
+	restrictions := make(map[string]interface{})
+	if a.ClipboardCopyLimit > 0 {
+		restrictions[RestrictionClipboardCopyLimit] = a.ClipboardCopyLimit
+	}
+	if a.ClipboardPasteLimit > 0 {
+		restrictions[RestrictionClipboardPasteLimit] = a.ClipboardPasteLimit
+	}
+	if a.Watermark != nil {
+		restrictions[RestrictionWatermark] = *a.Watermark
+	}
+	return restrictions
 }
 
 func (a *AccessControl) Scan(value interface{}) error {
@@ -252,6 +281,10 @@ type AuthorizationV2 struct {
 	AssetSelector   TargetSelector `json:"asset_selector" gorm:"column:asset_selector;type:json"`
 	AccountSelector TargetSelector `json:"account_selector" gorm:"column:account_selector;type:json"`
 
+	// Workload selectors, only applied to container platform sessions
+	NamespaceSelector TargetSelector `json:"namespace_selector" gorm:"column:namespace_selector;type:json"`
+	ContainerSelector TargetSelector `json:"container_selector" gorm:"column:container_selector;type:json"`
+
 	// Permissions configuration
 	Permissions AuthPermissions `json:"permissions" gorm:"column:permissions;type:json"`
 
@@ -334,6 +367,8 @@ type AuthRequest struct {
 	NodeId    int        `json:"node_id"`
 	AssetId   int        `json:"asset_id"`
 	AccountId int        `json:"account_id"`
+	Namespace string     `json:"namespace"`
+	Container string     `json:"container"`
 	Action    AuthAction `json:"action"`
 	ClientIP  string     `json:"client_ip"`
 	UserAgent string     `json:"user_agent"`
@@ -346,6 +381,8 @@ type BatchAuthRequest struct {
 	NodeId    int          `json:"node_id"`
 	AssetId   int          `json:"asset_id"`
 	AccountId int          `json:"account_id"`
+	Namespace string       `json:"namespace"`
+	Container string       `json:"container"`
 	Actions   []AuthAction `json:"actions"`
 	ClientIP  string       `json:"client_ip"`
 	UserAgent string       `json:"user_agent"`
@@ -21,6 +21,13 @@ type DefaultPermissions struct {
 	Share        bool `json:"share" gorm:"column:share"`
 }
 
+// WatermarkConfig defines the watermark drawn over sessions, the template accepts the {user}, {client_ip}, {time},
+// {session_id} and {asset} placeholders
+type WatermarkConfig struct {
+	Enabled  bool   `json:"enabled" gorm:"column:enabled"`
+	Template string `json:"template" gorm:"column:template;size:255"`
+}
+
 type Config struct {
 	Id      int `json:"id" gorm:"column:id;primarykey;autoIncrement"`
 	Timeout int `json:"timeout" gorm:"column:timeout"`
@@ -28,6 +35,9 @@ type Config struct {
 	// Default permissions for authorization creation
 	DefaultPermissions DefaultPermissions `json:"default_permissions" gorm:"embedded;embeddedPrefix:default_"`
 
+	// Watermark of all sessions, authorization rules may override it
+	Watermark WatermarkConfig `json:"watermark" gorm:"embedded;embeddedPrefix:watermark_"`
+
 	CreatorId int                   `json:"creator_id" gorm:"column:creator_id"`
 	UpdaterId int                   `json:"updater_id" gorm:"column:updater_id"`
 	CreatedAt time.Time             `json:"created_at" gorm:"column:created_at"`
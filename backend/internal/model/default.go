@@ -1,23 +1,30 @@
 package model
 
 var (
-	DefaultAccount         = &Account{}
-	DefaultAsset           = &Asset{}
-	DefaultAuthorization   = &Authorization{}
-	DefaultCommand         = &Command{}
-	DefaultCommandTemplate = &CommandTemplate{}
-	DefaultConfig          = &Config{}
-	DefaultFileHistory     = &FileHistory{}
-	DefaultGateway         = &Gateway{}
-	DefaultHistory         = &History{}
-	DefaultNode            = &Node{}
-	DefaultPublicKey       = &PublicKey{}
-	DefaultSession         = &Session{}
-	DefaultSessionCmd      = &SessionCmd{}
-	DefaultShare           = &Share{}
-	DefaultQuickCommand    = &QuickCommand{}
-	DefaultUserPreference  = &UserPreference{}
-	DefaultStorageConfig   = &StorageConfig{}
-	DefaultStorageMetrics  = &StorageMetrics{}
-	DefaultMigrationRecord = &MigrationRecord{}
+	DefaultAccount           = &Account{}
+	DefaultAsset             = &Asset{}
+	DefaultAuthorization     = &Authorization{}
+	DefaultCommand           = &Command{}
+	DefaultCommandTemplate   = &CommandTemplate{}
+	DefaultConfig            = &Config{}
+	DefaultFileHistory       = &FileHistory{}
+	DefaultGateway           = &Gateway{}
+	DefaultHistory           = &History{}
+	DefaultNode              = &Node{}
+	DefaultPublicKey         = &PublicKey{}
+	DefaultSession           = &Session{}
+	DefaultSessionCmd        = &SessionCmd{}
+	DefaultSessionClipboard  = &SessionClipboard{}
+	DefaultSessionWebRequest = &SessionWebRequest{}
+	DefaultShare             = &Share{}
+	DefaultQuickCommand      = &QuickCommand{}
+	DefaultUserPreference    = &UserPreference{}
+	DefaultStorageConfig     = &StorageConfig{}
+	DefaultStorageMetrics    = &StorageMetrics{}
+	DefaultFileMetadata      = &FileMetadata{}
+	DefaultMigrationRecord   = &MigrationRecord{}
+	DefaultReplayVideo       = &ReplayVideo{}
+	DefaultFileReplica       = &FileReplica{}
+	DefaultStorageMigration  = &StorageMigration{}
+	DefaultAuditExport       = &AuditExport{}
 )
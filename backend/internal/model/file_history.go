@@ -21,6 +21,10 @@ type FileHistory struct {
 	Action    int    `json:"action" gorm:"column:action"`
 	Dir       string `json:"dir" gorm:"column:dir"`
 	Filename  string `json:"filename" gorm:"column:filename"`
+	SessionId string `json:"session_id" gorm:"column:session_id;index"`
+	Size      int64  `json:"size" gorm:"column:size"`     // Bytes, 0 when unknown
+	Hash      string `json:"hash" gorm:"column:hash"`     // Hex sha256 of the content, empty when unknown
+	Status    int    `json:"status" gorm:"column:status"` // Status the target answered a web upload with, 0 otherwise
 
 	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
 	UpdatedAt time.Time `json:"updated_at" gorm:"column:updated_at"`
@@ -24,7 +24,9 @@ func (m *MigrationRecord) TableName() string {
 
 // Migration constants
 const (
-	MigrationAuthV1ToV2 = "auth_v1_to_v2"
+	MigrationAuthV1ToV2          = "auth_v1_to_v2"
+	MigrationReplayIndexBackfill = "replay_index_backfill"
+	MigrationStorageKeyRotation  = "storage_key_rotation" // suffixed with ":<storage name>"
 )
 
 // Migration status constants
@@ -9,6 +9,8 @@ import (
 const (
 	AUTHMETHOD_PASSWORD  = 1
 	AUTHMETHOD_PUBLICKEY = 2
+	AUTHMETHOD_TOKEN     = 3 // Bearer token stored in password, e.g. kubernetes service account
+	AUTHMETHOD_CERT      = 4 // PEM client certificate and key stored in pk
 )
 
 type PublicKey struct {
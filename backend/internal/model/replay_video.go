@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+)
+
+// ReplayVideo tracks the conversion of a guacd recording into a standard video file
+type ReplayVideo struct {
+	Id           int        `json:"id" gorm:"column:id;primarykey;autoIncrement"`
+	SessionId    string     `json:"session_id" gorm:"column:session_id;index;size:128;not null"`
+	Format       string     `json:"format" gorm:"column:format;size:8;not null"`  // mp4, webm
+	Status       string     `json:"status" gorm:"column:status;size:32;not null"` // pending, running, completed, failed
+	StorageName  string     `json:"storage_name" gorm:"column:storage_name;size:64"`
+	StorageKey   string     `json:"storage_key" gorm:"column:storage_key;size:512"`
+	FileSize     int64      `json:"file_size" gorm:"column:file_size;default:0"`
+	ErrorMessage string     `json:"error_message" gorm:"column:error_message;type:text"`
+	StartedAt    *time.Time `json:"started_at" gorm:"column:started_at"`
+	CompletedAt  *time.Time `json:"completed_at" gorm:"column:completed_at"`
+
+	CreatorId int       `json:"creator_id" gorm:"column:creator_id"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"column:updated_at"`
+}
+
+func (m *ReplayVideo) TableName() string {
+	return "replay_video"
+}
+
+// Video formats a recording can be converted to
+const (
+	VideoFormatMp4  = "mp4"
+	VideoFormatWebm = "webm"
+)
+
+// Video conversion status, same values as migrations
+const (
+	VideoStatusPending   = MigrationStatusPending
+	VideoStatusRunning   = MigrationStatusRunning
+	VideoStatusCompleted = MigrationStatusCompleted
+	VideoStatusFailed    = MigrationStatusFailed
+)
+
+// VideoMimeType returns the content type of a video format
+func VideoMimeType(format string) string {
+	return "video/" + format
+}
@@ -1,8 +1,12 @@
 package model
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"strings"
 	"time"
+
+	"github.com/samber/lo"
 )
 
 const (
@@ -41,6 +45,18 @@ type Session struct {
 	ClosedAt    *time.Time `json:"closed_at" gorm:"column:closed_at"`
 	ShareId     int        `json:"share_id" gorm:"column:share_id"`
 
+	// Artifacts of a session on legal hold are exempt from retention cleanup
+	LegalHold bool `json:"legal_hold" gorm:"column:legal_hold;default:false;index"`
+
+	// Workload inside a container platform asset (kubernetes pod, docker container)
+	Workload *WorkloadTarget `json:"workload,omitempty" gorm:"column:workload;type:json"`
+
+	// Authorization rule that granted the connection, 0 for sessions opened before it was recorded
+	AuthRuleId int `json:"auth_rule_id" gorm:"column:auth_rule_id"`
+
+	// Terminal backend of ssh and telnet sessions, guacd sessions are recorded like graphical ones
+	TerminalBackend string `json:"terminal_backend,omitempty" gorm:"column:terminal_backend;size:16"`
+
 	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
 	UpdatedAt time.Time `json:"updated_at" gorm:"column:updated_at"`
 
@@ -53,24 +69,162 @@ func (m *Session) TableName() string {
 
 type SessionCmd struct {
 	Id        int    `json:"id" gorm:"column:id;primarykey;autoIncrement"`
-	SessionId string `json:"session_id" gorm:"column:session_id"`
+	SessionId string `json:"session_id" gorm:"column:session_id;index;size:128"`
 	Cmd       string `json:"cmd" gorm:"column:cmd"`
 	Result    string `json:"result" gorm:"column:result"`
-	Level     int    `json:"level" gorm:"column:level"`
+	Level     int    `json:"level" gorm:"column:level;index"` // Risk level of the matched command rule, see CommandRiskLevel
 
-	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+	// Seconds since the recording started, on the same clock as the cast frames; nil for rows written before it was tracked
+	Offset *float64 `json:"offset" gorm:"column:time_offset"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at;index"`
 }
 
 func (m *SessionCmd) TableName() string {
 	return "session_cmd"
 }
 
+// SessionCmdSearchIndex is the full-text index over the command and result of session commands
+const SessionCmdSearchIndex = "idx_session_cmd_search"
+
+// Directions of clipboard transfers in graphical sessions
+const (
+	ClipboardDirectionCopy  = "copy"  // from the remote desktop to the user
+	ClipboardDirectionPaste = "paste" // from the user to the remote desktop
+)
+
+// SessionClipboard is a clipboard transfer of a graphical session
+type SessionClipboard struct {
+	Id        int    `json:"id" gorm:"column:id;primarykey;autoIncrement"`
+	SessionId string `json:"session_id" gorm:"column:session_id;index;size:128"`
+	Direction string `json:"direction" gorm:"column:direction;size:16"`
+	MimeType  string `json:"mime_type" gorm:"column:mime_type;size:128"`
+	Size      int64  `json:"size" gorm:"column:size"`
+	Content   string `json:"content" gorm:"column:content;type:text"` // Text content up to the configured limit, empty when not captured
+	Truncated bool   `json:"truncated" gorm:"column:truncated"`
+	Blocked   bool   `json:"blocked" gorm:"column:blocked"` // Dropped because it exceeded the size limit of the authorization rule
+
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at;index"`
+}
+
+func (m *SessionClipboard) TableName() string {
+	return "session_clipboard"
+}
+
+// SessionWebRequest is a request proxied in a web session, sensitive headers, query parameters and form fields are
+// redacted before it is written
+type SessionWebRequest struct {
+	Id             int                 `json:"id" gorm:"column:id;primarykey;autoIncrement"`
+	SessionId      string              `json:"session_id" gorm:"column:session_id;index;size:128"`
+	Method         string              `json:"method" gorm:"column:method;size:16"`
+	Host           string              `json:"host" gorm:"column:host;size:255"`
+	Path           string              `json:"path" gorm:"column:path;type:text"`
+	Query          string              `json:"query" gorm:"column:query;type:text"`
+	RequestHeaders Map[string, string] `json:"request_headers" gorm:"column:request_headers;type:json"`
+	FormFields     Map[string, string] `json:"form_fields" gorm:"column:form_fields;type:json"`
+	Status         int                 `json:"status" gorm:"column:status;index"`
+	ResponseSize   int64               `json:"response_size" gorm:"column:response_size"`
+	ContentType    string              `json:"content_type" gorm:"column:content_type;size:255"`
+	Duration       int64               `json:"duration" gorm:"column:duration"` // Milliseconds until the response was written
+
+	// Seconds since the session started
+	Offset float64 `json:"offset" gorm:"column:time_offset"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at;index"`
+}
+
+func (m *SessionWebRequest) TableName() string {
+	return "session_web_request"
+}
+
+// WebRequestTimeline lists the requests of a web session in the order they were made
+type WebRequestTimeline struct {
+	SessionId string               `json:"session_id"`
+	AssetInfo string               `json:"asset_info"`
+	StartedAt time.Time            `json:"started_at"`
+	Items     []*SessionWebRequest `json:"items"`
+}
+
+// SessionCmdHit is a command matched by the cross session search, with the session it belongs to
+type SessionCmdHit struct {
+	SessionCmd
+	Uid              int       `json:"uid" gorm:"column:uid"`
+	UserName         string    `json:"user_name" gorm:"column:user_name"`
+	AssetId          int       `json:"asset_id" gorm:"column:asset_id"`
+	AssetInfo        string    `json:"asset_info" gorm:"column:asset_info"`
+	AccountInfo      string    `json:"account_info" gorm:"column:account_info"`
+	Protocol         string    `json:"protocol" gorm:"column:protocol"`
+	SessionCreatedAt time.Time `json:"session_created_at" gorm:"column:session_created_at"`
+
+	// Seconds from the start of the recording, used to seek the replay player
+	ReplayOffset float64 `json:"replay_offset" gorm:"-"`
+}
+
+// ReplayPosition returns the command position in the recording, estimated from
+// wall clock times when the exact offset was not recorded
+func (m *SessionCmd) ReplayPosition(sessionStart time.Time) float64 {
+	if m.Offset != nil {
+		return *m.Offset
+	}
+	return max(m.CreatedAt.Sub(sessionStart).Seconds(), 0)
+}
+
+// ReplayTimeline lists the commands of a session in recording order
+type ReplayTimeline struct {
+	SessionId string             `json:"session_id"`
+	Protocol  string             `json:"protocol"`
+	Items     []*TimelineCommand `json:"items"`
+}
+
+// TimelineCommand is a seekable command entry of a replay
+type TimelineCommand struct {
+	Id     int     `json:"id"`
+	Cmd    string  `json:"cmd"`
+	Level  int     `json:"level"`
+	Offset float64 `json:"offset"`
+}
+
+// WorkloadTarget identifies a container inside a container platform asset
+type WorkloadTarget struct {
+	Namespace string `json:"namespace,omitempty"`
+	Pod       string `json:"pod,omitempty"`
+	Container string `json:"container,omitempty"`
+}
+
+func (t *WorkloadTarget) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(bytes, t)
+}
+
+func (t WorkloadTarget) Value() (driver.Value, error) {
+	return json.Marshal(t)
+}
+
+// String returns the target in namespace/pod/container form, omitting empty parts
+func (t *WorkloadTarget) String() string {
+	return strings.Join(lo.Compact([]string{t.Namespace, t.Pod, t.Container}), "/")
+}
+
 func (m *Session) IsGuacd() bool {
-	return m.IsRdp() || m.IsVnc()
+	return m.IsRdp() || m.IsVnc() || m.IsGuacdTerminal()
+}
+
+// IsGuacdTerminal tells whether an ssh or telnet session is rendered by guacd instead of the native terminal
+func (m *Session) IsGuacdTerminal() bool {
+	return m.TerminalBackend == TerminalBackendGuacd && (m.IsSsh() || m.IsTelnet())
 }
 func (m *Session) IsSsh() bool {
 	return strings.HasPrefix(m.Protocol, "ssh")
 }
+func (m *Session) IsTelnet() bool {
+	return strings.HasPrefix(m.Protocol, "telnet")
+}
 func (m *Session) IsRdp() bool {
 	return strings.HasPrefix(m.Protocol, "rdp")
 }
@@ -86,6 +240,18 @@ func (m *Session) IsMysql() bool {
 func (m *Session) IsMongo() bool {
 	return strings.HasPrefix(m.Protocol, "mongo")
 }
+func (m *Session) IsMssql() bool {
+	return strings.HasPrefix(m.Protocol, "mssql")
+}
+func (m *Session) IsOracle() bool {
+	return strings.HasPrefix(m.Protocol, "oracle")
+}
+func (m *Session) IsKubernetes() bool {
+	return strings.HasPrefix(m.Protocol, "kubernetes")
+}
+func (m *Session) IsDocker() bool {
+	return strings.HasPrefix(m.Protocol, "docker")
+}
 
 type CmdCount struct {
 	SessionId string `gorm:"column:session_id"`
@@ -118,6 +118,26 @@ func (m *StorageMetrics) TableName() string {
 	return "storage_metrics"
 }
 
+// File categories of FileMetadata
+const (
+	FileCategoryReplay      = "replay"
+	FileCategoryReplayVideo = "replay_video"
+	FileCategoryRdpFile     = "rdp_file"
+	FileCategoryAuditExport = "audit_export"
+
+	// Retention category of guacd recordings, which are indexed as FileCategoryReplay
+	FileCategoryGuacdRecording = "guacd_recording"
+)
+
+// Content types of session recordings
+const (
+	MimeTypeAsciicast      = "application/x-asciicast"
+	MimeTypeGuacRecording  = "application/x-guacamole-recording"
+	ContentEncodingGzip    = "gzip"
+	ContentEncodingZstd    = "zstd"
+	GuacRecordingExtension = ".guac"
+)
+
 // FileMetadata represents metadata for files stored in storage backends
 type FileMetadata struct {
 	Id          int         `json:"id" gorm:"column:id;primarykey;autoIncrement"`
@@ -125,14 +145,25 @@ type FileMetadata struct {
 	FileName    string      `json:"file_name" gorm:"column:file_name;size:255;not null"`
 	FileSize    int64       `json:"file_size" gorm:"column:file_size;default:0"`
 	MimeType    string      `json:"mime_type" gorm:"column:mime_type;size:100"`
+	Encoding    string      `json:"encoding" gorm:"column:encoding;size:16"` // Content-Encoding of the stored bytes, empty when stored as is
 	Checksum    string      `json:"checksum" gorm:"column:checksum;size:64"`
 	StorageType StorageType `json:"storage_type" gorm:"column:storage_type;size:32;not null"`
 	StorageName string      `json:"storage_name" gorm:"column:storage_name;size:64;not null"`
 	Category    string      `json:"category" gorm:"column:category;size:32"` // replay, rdp_file, etc.
-	SessionId   string      `json:"session_id" gorm:"column:session_id;size:64"`
+	SessionId   string      `json:"session_id" gorm:"column:session_id;size:64;index"`
 	AssetId     int         `json:"asset_id" gorm:"column:asset_id"`
 	UserId      int         `json:"user_id" gorm:"column:user_id"`
 
+	// Tamper evidence, see storage.HashChain; the signature covers key, session, size, checksum and chain
+	ChainHash    string `json:"chain_hash" gorm:"column:chain_hash;size:64"`
+	ChunkCount   int    `json:"chunk_count" gorm:"column:chunk_count;default:0"`
+	ChunkHashes  []byte `json:"-" gorm:"column:chunk_hashes"` // SHA-256 of each chunk one after the other, the chain vouches for them
+	Signature    string `json:"signature" gorm:"column:signature;size:128"`
+	SigningKeyId string `json:"signing_key_id" gorm:"column:signing_key_id;size:32"`
+
+	// Master key wrapping the data key of the stored bytes, empty when the storage is not encrypted
+	EncryptionKeyId string `json:"encryption_key_id" gorm:"column:encryption_key_id;size:64;index"`
+
 	// Standard fields
 	CreatorId int                   `json:"creator_id" gorm:"column:creator_id"`
 	UpdaterId int                   `json:"updater_id" gorm:"column:updater_id"`
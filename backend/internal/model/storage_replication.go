@@ -0,0 +1,62 @@
+package model
+
+import (
+	"time"
+)
+
+// FileReplica is a copy of a stored file on another storage, kept by mirroring or left behind by a migration
+type FileReplica struct {
+	Id            int    `json:"id" gorm:"column:id;primarykey;autoIncrement"`
+	StorageKey    string `json:"storage_key" gorm:"column:storage_key;uniqueIndex:storage_key_target;size:255;not null"`
+	TargetStorage string `json:"target_storage" gorm:"column:target_storage;uniqueIndex:storage_key_target;size:64;not null"`
+	SourceStorage string `json:"source_storage" gorm:"column:source_storage;size:64;not null"`
+	Category      string `json:"category" gorm:"column:category;size:32"`
+	FileSize      int64  `json:"file_size" gorm:"column:file_size;default:0"`
+	Checksum      string `json:"checksum" gorm:"column:checksum;size:64"`
+	Status        string `json:"status" gorm:"column:status;size:32;not null;index"` // pending, running, completed, failed
+	Attempts      int    `json:"attempts" gorm:"column:attempts;default:0"`
+	ErrorMessage  string `json:"error_message" gorm:"column:error_message;type:text"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"column:updated_at"`
+}
+
+func (m *FileReplica) TableName() string {
+	return "file_replica"
+}
+
+// StorageMigration is an admin triggered job copying the indexed files of a category from one storage to another.
+// Every copy is read back and verified before the index is pointed at the target, LastId is the resume cursor.
+type StorageMigration struct {
+	Id            int        `json:"id" gorm:"column:id;primarykey;autoIncrement"`
+	SourceStorage string     `json:"source_storage" gorm:"column:source_storage;size:64;not null"`
+	TargetStorage string     `json:"target_storage" gorm:"column:target_storage;size:64;not null"`
+	Category      string     `json:"category" gorm:"column:category;size:32"` // empty for every category
+	DeleteSource  bool       `json:"delete_source" gorm:"column:delete_source;default:false"`
+	Status        string     `json:"status" gorm:"column:status;size:32;not null;index"` // pending, running, completed, failed
+	TotalCount    int        `json:"total_count" gorm:"column:total_count;default:0"`
+	CopiedCount   int        `json:"copied_count" gorm:"column:copied_count;default:0"`
+	SkippedCount  int        `json:"skipped_count" gorm:"column:skipped_count;default:0"`
+	FailedCount   int        `json:"failed_count" gorm:"column:failed_count;default:0"`
+	CopiedBytes   int64      `json:"copied_bytes" gorm:"column:copied_bytes;default:0"`
+	LastId        int        `json:"last_id" gorm:"column:last_id;default:0"`
+	ErrorMessage  string     `json:"error_message" gorm:"column:error_message;type:text"`
+	StartedAt     *time.Time `json:"started_at" gorm:"column:started_at"`
+	CompletedAt   *time.Time `json:"completed_at" gorm:"column:completed_at"`
+
+	CreatorId int       `json:"creator_id" gorm:"column:creator_id"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:created_at"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"column:updated_at"`
+}
+
+func (m *StorageMigration) TableName() string {
+	return "storage_migration"
+}
+
+// Replica and storage migration status, same values as migrations
+const (
+	ReplicaStatusPending   = MigrationStatusPending
+	ReplicaStatusRunning   = MigrationStatusRunning
+	ReplicaStatusCompleted = MigrationStatusCompleted
+	ReplicaStatusFailed    = MigrationStatusFailed
+)
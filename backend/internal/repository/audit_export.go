@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/veops/oneterm/internal/model"
+	dbpkg "github.com/veops/oneterm/pkg/db"
+)
+
+// AuditExportRepository defines the interface for audit export jobs and the records they collect
+type AuditExportRepository interface {
+	GetAuditExport(ctx context.Context, id int) (*model.AuditExport, error)
+	GetAuditExports(ctx context.Context, limit int) ([]*model.AuditExport, error)
+	GetAuditExportsByStatus(ctx context.Context, status ...string) ([]*model.AuditExport, error)
+	CreateAuditExport(ctx context.Context, export *model.AuditExport) error
+	UpdateAuditExport(ctx context.Context, export *model.AuditExport) error
+	// GetAuditExportByKey retrieves the export whose bundle is stored under a key
+	GetAuditExportByKey(ctx context.Context, storageName, key string) (*model.AuditExport, error)
+
+	// GetExportSessions lists the offline sessions selected by an export after lastId, oldest first
+	GetExportSessions(ctx context.Context, export *model.AuditExport, lastId, limit int) ([]*model.Session, error)
+	// GetSessionFileHistories lists the file transfers of the user on the asset account while the session was open
+	GetSessionFileHistories(ctx context.Context, session *model.Session) ([]*model.FileHistory, error)
+	// GetHistories lists the change history of targets of a type, oldest first
+	GetHistories(ctx context.Context, historyType string, targetIds []int) ([]*model.History, error)
+	// GetSessionFiles lists the stored files of a session
+	GetSessionFiles(ctx context.Context, sessionId string) ([]*model.FileMetadata, error)
+}
+
+type auditExportRepository struct{}
+
+// NewAuditExportRepository creates a new audit export repository
+func NewAuditExportRepository() AuditExportRepository {
+	return &auditExportRepository{}
+}
+
+// GetAuditExport retrieves an export job by ID
+func (r *auditExportRepository) GetAuditExport(ctx context.Context, id int) (*model.AuditExport, error) {
+	export := &model.AuditExport{}
+	if err := dbpkg.DB.Where("id = ?", id).First(export).Error; err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// GetAuditExports retrieves the latest export jobs, newest first
+func (r *auditExportRepository) GetAuditExports(ctx context.Context, limit int) ([]*model.AuditExport, error) {
+	var exports []*model.AuditExport
+	err := dbpkg.DB.
+		Order("id DESC").
+		Limit(limit).
+		Find(&exports).
+		Error
+	return exports, err
+}
+
+// GetAuditExportsByStatus retrieves export jobs in any of the given status, oldest first
+func (r *auditExportRepository) GetAuditExportsByStatus(ctx context.Context, status ...string) ([]*model.AuditExport, error) {
+	var exports []*model.AuditExport
+	err := dbpkg.DB.
+		Where("status IN ?", status).
+		Order("id ASC").
+		Find(&exports).
+		Error
+	return exports, err
+}
+
+// CreateAuditExport creates an export job
+func (r *auditExportRepository) CreateAuditExport(ctx context.Context, export *model.AuditExport) error {
+	return dbpkg.DB.Create(export).Error
+}
+
+// UpdateAuditExport saves the state of an export job
+func (r *auditExportRepository) UpdateAuditExport(ctx context.Context, export *model.AuditExport) error {
+	return dbpkg.DB.Save(export).Error
+}
+
+func (r *auditExportRepository) GetAuditExportByKey(ctx context.Context, storageName, key string) (*model.AuditExport, error) {
+	export := &model.AuditExport{}
+	if err := dbpkg.DB.Where("storage_name = ? AND storage_key = ?", storageName, key).Order("id DESC").First(export).Error; err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+func (r *auditExportRepository) GetExportSessions(ctx context.Context, export *model.AuditExport, lastId, limit int) ([]*model.Session, error) {
+	db := dbpkg.DB.Where("id > ? AND status = ?", lastId, model.SESSIONSTATUS_OFFLINE)
+	if export.SessionId != "" {
+		db = db.Where("session_id = ?", export.SessionId)
+	}
+	if export.Uid != 0 {
+		db = db.Where("uid = ?", export.Uid)
+	}
+	if export.AssetId != 0 {
+		db = db.Where("asset_id = ?", export.AssetId)
+	}
+	if export.Start != nil {
+		db = db.Where("created_at >= ?", export.Start)
+	}
+	if export.End != nil {
+		db = db.Where("created_at <= ?", export.End)
+	}
+
+	var sessions []*model.Session
+	err := db.Order("id ASC").Limit(limit).Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *auditExportRepository) GetSessionFileHistories(ctx context.Context, session *model.Session) ([]*model.FileHistory, error) {
+	db := dbpkg.DB.
+		Where("uid = ? AND asset_id = ? AND account_id = ?", session.Uid, session.AssetId, session.AccountId).
+		Where("created_at >= ?", session.CreatedAt)
+	if session.ClosedAt != nil {
+		db = db.Where("created_at <= ?", session.ClosedAt)
+	}
+
+	var histories []*model.FileHistory
+	err := db.Order("id ASC").Find(&histories).Error
+	return histories, err
+}
+
+func (r *auditExportRepository) GetHistories(ctx context.Context, historyType string, targetIds []int) ([]*model.History, error) {
+	histories := make([]*model.History, 0)
+	if len(targetIds) == 0 {
+		return histories, nil
+	}
+	err := dbpkg.DB.
+		Where("type = ? AND target_id IN ?", historyType, targetIds).
+		Order("id ASC").
+		Find(&histories).
+		Error
+	return histories, err
+}
+
+func (r *auditExportRepository) GetSessionFiles(ctx context.Context, sessionId string) ([]*model.FileMetadata, error) {
+	var files []*model.FileMetadata
+	err := dbpkg.DB.
+		Where("session_id = ?", sessionId).
+		Order("id ASC").
+		Find(&files).
+		Error
+	return files, err
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/veops/oneterm/internal/model"
+	dbpkg "github.com/veops/oneterm/pkg/db"
+)
+
+// ReplayVideoRepository defines the interface for replay video conversion jobs
+type ReplayVideoRepository interface {
+	GetReplayVideo(ctx context.Context, id int) (*model.ReplayVideo, error)
+	GetReplayVideos(ctx context.Context, sessionId string) ([]*model.ReplayVideo, error)
+	GetReplayVideosByStatus(ctx context.Context, status ...string) ([]*model.ReplayVideo, error)
+	CreateReplayVideo(ctx context.Context, video *model.ReplayVideo) error
+	UpdateReplayVideo(ctx context.Context, video *model.ReplayVideo) error
+}
+
+type replayVideoRepository struct{}
+
+// NewReplayVideoRepository creates a new replay video repository
+func NewReplayVideoRepository() ReplayVideoRepository {
+	return &replayVideoRepository{}
+}
+
+// GetReplayVideo retrieves a conversion job by ID
+func (r *replayVideoRepository) GetReplayVideo(ctx context.Context, id int) (*model.ReplayVideo, error) {
+	video := &model.ReplayVideo{}
+	if err := dbpkg.DB.Where("id = ?", id).First(video).Error; err != nil {
+		return nil, err
+	}
+	return video, nil
+}
+
+// GetReplayVideos retrieves the conversion jobs of a session, newest first
+func (r *replayVideoRepository) GetReplayVideos(ctx context.Context, sessionId string) ([]*model.ReplayVideo, error) {
+	var videos []*model.ReplayVideo
+	err := dbpkg.DB.
+		Where("session_id = ?", sessionId).
+		Order("id DESC").
+		Find(&videos).
+		Error
+	return videos, err
+}
+
+// GetReplayVideosByStatus retrieves conversion jobs in any of the given status, oldest first
+func (r *replayVideoRepository) GetReplayVideosByStatus(ctx context.Context, status ...string) ([]*model.ReplayVideo, error) {
+	var videos []*model.ReplayVideo
+	err := dbpkg.DB.
+		Where("status IN ?", status).
+		Order("id ASC").
+		Find(&videos).
+		Error
+	return videos, err
+}
+
+// CreateReplayVideo creates a conversion job
+func (r *replayVideoRepository) CreateReplayVideo(ctx context.Context, video *model.ReplayVideo) error {
+	return dbpkg.DB.Create(video).Error
+}
+
+// UpdateReplayVideo saves the state of a conversion job
+func (r *replayVideoRepository) UpdateReplayVideo(ctx context.Context, video *model.ReplayVideo) error {
+	return dbpkg.DB.Save(video).Error
+}
@@ -2,9 +2,13 @@ package repository
 
 import (
 	"context"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
 	"github.com/veops/oneterm/internal/model"
 	gsession "github.com/veops/oneterm/internal/session"
 	dbpkg "github.com/veops/oneterm/pkg/db"
@@ -16,14 +20,23 @@ type SessionRepository interface {
 	GetSession(ctx context.Context, sessionId string) (*model.Session, error)
 	BuildQuery(ctx *gin.Context, isAdmin bool, uid int) (*gorm.DB, error)
 	BuildCmdQuery(ctx *gin.Context, sessionId string) *gorm.DB
+	BuildCmdSearchQuery(ctx *gin.Context, isAdmin bool, uid int) (*gorm.DB, error)
 	GetSessionOptionAssets(ctx context.Context) ([]*model.SessionOptionAsset, error)
 	GetSessionOptionClientIps(ctx context.Context) ([]string, error)
 	CreateSessionCmd(ctx context.Context, cmd *model.SessionCmd) error
+	GetSessionCmds(ctx context.Context, sessionId string) ([]*model.SessionCmd, error)
 	GetSessionCmdCounts(ctx context.Context, sessionIds []string) (map[string]int64, error)
+	CreateSessionClipboard(ctx context.Context, clipboard *model.SessionClipboard) error
+	BuildClipboardQuery(ctx *gin.Context, sessionId string) *gorm.DB
+	CreateSessionWebRequest(ctx context.Context, req *model.SessionWebRequest) error
+	BuildWebRequestQuery(ctx *gin.Context, sessionId string) *gorm.DB
+	GetSessionWebRequests(ctx context.Context, sessionId string) ([]*model.SessionWebRequest, error)
 	GetOnlineSessionByID(ctx context.Context, sessionID string) (*gsession.Session, error)
 	GetSshParserCommands(ctx context.Context, cmdIDs []int) ([]*model.Command, error)
 	// GetRecentSessionsByUser retrieves recent sessions deduplicated by asset_id and account_id combination
 	GetRecentSessionsByUser(ctx context.Context, uid int, limit int) ([]*model.Session, error)
+	SetLegalHold(ctx context.Context, sessionId string, hold bool) error
+	GetLegalHoldSessionIds(ctx context.Context) ([]string, error)
 }
 
 type sessionRepository struct{}
@@ -42,6 +55,18 @@ func (r *sessionRepository) GetSession(ctx context.Context, sessionId string) (*
 	return session, nil
 }
 
+// SetLegalHold places a session on legal hold or releases it
+func (r *sessionRepository) SetLegalHold(ctx context.Context, sessionId string, hold bool) error {
+	return dbpkg.DB.Model(&model.Session{}).Where("session_id = ?", sessionId).Update("legal_hold", hold).Error
+}
+
+// GetLegalHoldSessionIds retrieves the ids of all sessions on legal hold
+func (r *sessionRepository) GetLegalHoldSessionIds(ctx context.Context) ([]string, error) {
+	var ids []string
+	err := dbpkg.DB.Model(&model.Session{}).Where("legal_hold = ?", true).Pluck("session_id", &ids).Error
+	return ids, err
+}
+
 // BuildQuery constructs a query for sessions with filters
 func (r *sessionRepository) BuildQuery(ctx *gin.Context, isAdmin bool, uid int) (*gorm.DB, error) {
 	db := dbpkg.DB.Model(model.DefaultSession)
@@ -97,6 +122,81 @@ func (r *sessionRepository) BuildCmdQuery(ctx *gin.Context, sessionId string) *g
 	return db
 }
 
+// cmdSearchIndexed tells whether the full-text index of session commands exists, it is created at startup
+var cmdSearchIndexed = sync.OnceValue(func() bool {
+	return dbpkg.DB.Migrator().HasIndex(model.DefaultSessionCmd, model.SessionCmdSearchIndex)
+})
+
+// cmdSearchCondition matches commands or results containing the phrase q through the full-text index. Without the
+// index, and for single characters the ngram index cannot find, it falls back to a prefix match on the command, never
+// a leading wildcard.
+func cmdSearchCondition(db *gorm.DB, q string) *gorm.DB {
+	if cmdSearchIndexed() && utf8.RuneCountInString(q) >= 2 {
+		switch dbpkg.Type() {
+		case dbpkg.MySQL, "":
+			phrase := `"` + strings.ReplaceAll(q, `"`, " ") + `"`
+			return db.Where("MATCH(session_cmd.cmd, session_cmd.result) AGAINST (? IN BOOLEAN MODE)", phrase)
+		case dbpkg.Postgres:
+			return db.Where(dbpkg.FullTextExpr("session_cmd.cmd", "session_cmd.result")+" @@ phraseto_tsquery('simple', ?)", q)
+		}
+	}
+	escaped := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(q)
+	return db.Where("session_cmd.cmd LIKE ? ESCAPE '!'", escaped+"%")
+}
+
+// BuildCmdSearchQuery constructs a query for commands across sessions, joined with their session
+func (r *sessionRepository) BuildCmdSearchQuery(ctx *gin.Context, isAdmin bool, uid int) (*gorm.DB, error) {
+	db := dbpkg.DB.Model(&model.SessionCmd{}).
+		Select("session_cmd.*, session.uid, session.user_name, session.asset_id, session.asset_info, session.account_info, session.protocol, session.created_at AS session_created_at").
+		Joins("JOIN session ON session.session_id = session_cmd.session_id")
+
+	// Apply user filter if not admin
+	if !isAdmin {
+		db = db.Where("session.uid = ?", uid)
+	}
+
+	// Apply text search on command and its output
+	if q, ok := ctx.GetQuery("search"); ok && strings.TrimSpace(q) != "" {
+		db = cmdSearchCondition(db, strings.TrimSpace(q))
+	}
+
+	// Apply date range filters on command time
+	if start, ok := ctx.GetQuery("start"); ok {
+		t, err := time.Parse(time.RFC3339, start)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where("session_cmd.created_at >= ?", t)
+	}
+
+	if end, ok := ctx.GetQuery("end"); ok {
+		t, err := time.Parse(time.RFC3339, end)
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where("session_cmd.created_at <= ?", t)
+	}
+
+	// Apply exact match filters
+	for _, field := range []string{"uid", "asset_id", "account_id", "session_id"} {
+		if q, ok := ctx.GetQuery(field); ok && q != "" {
+			db = db.Where("session."+field+" = ?", q)
+		}
+	}
+
+	// Protocol is stored with its port, e.g. ssh:22
+	if q, ok := ctx.GetQuery("protocol"); ok && q != "" {
+		db = db.Where("session.protocol LIKE ?", q+"%")
+	}
+
+	// Risk level filter matches the given level and above
+	if q, ok := ctx.GetQuery("level"); ok && q != "" {
+		db = db.Where("session_cmd.level >= ?", q)
+	}
+
+	return db, nil
+}
+
 // GetSessionOptionAssets retrieves session option assets
 func (r *sessionRepository) GetSessionOptionAssets(ctx context.Context) ([]*model.SessionOptionAsset, error) {
 	opts := make([]*model.SessionOptionAsset, 0)
@@ -128,6 +228,71 @@ func (r *sessionRepository) CreateSessionCmd(ctx context.Context, cmd *model.Ses
 	return dbpkg.DB.Create(cmd).Error
 }
 
+// GetSessionCmds retrieves all commands of a session in execution order
+func (r *sessionRepository) GetSessionCmds(ctx context.Context, sessionId string) ([]*model.SessionCmd, error) {
+	cmds := make([]*model.SessionCmd, 0)
+	err := dbpkg.DB.
+		Where("session_id = ?", sessionId).
+		Order("id ASC").
+		Find(&cmds).
+		Error
+	return cmds, err
+}
+
+// CreateSessionClipboard records a clipboard transfer of a session
+func (r *sessionRepository) CreateSessionClipboard(ctx context.Context, clipboard *model.SessionClipboard) error {
+	return dbpkg.DB.Create(clipboard).Error
+}
+
+// BuildClipboardQuery constructs a query for the clipboard transfers of a session
+func (r *sessionRepository) BuildClipboardQuery(ctx *gin.Context, sessionId string) *gorm.DB {
+	db := dbpkg.DB.Model(&model.SessionClipboard{})
+	db = db.Where("session_id = ?", sessionId)
+
+	if q, ok := ctx.GetQuery("direction"); ok && q != "" {
+		db = db.Where("direction = ?", q)
+	}
+	if q, ok := ctx.GetQuery("search"); ok && q != "" {
+		db = db.Where("content LIKE ?", "%"+q+"%")
+	}
+
+	return db
+}
+
+// CreateSessionWebRequest records a request proxied in a web session
+func (r *sessionRepository) CreateSessionWebRequest(ctx context.Context, req *model.SessionWebRequest) error {
+	return dbpkg.DB.Create(req).Error
+}
+
+// BuildWebRequestQuery constructs a query for the requests of a web session
+func (r *sessionRepository) BuildWebRequestQuery(ctx *gin.Context, sessionId string) *gorm.DB {
+	db := dbpkg.DB.Model(&model.SessionWebRequest{})
+	db = db.Where("session_id = ?", sessionId)
+
+	if q, ok := ctx.GetQuery("method"); ok && q != "" {
+		db = db.Where("method = ?", strings.ToUpper(q))
+	}
+	if q, ok := ctx.GetQuery("status"); ok && q != "" {
+		db = db.Where("status = ?", cast.ToInt(q))
+	}
+	if q, ok := ctx.GetQuery("search"); ok && q != "" {
+		db = db.Where("path LIKE ?", "%"+q+"%")
+	}
+
+	return db
+}
+
+// GetSessionWebRequests retrieves all requests of a web session in the order they were made
+func (r *sessionRepository) GetSessionWebRequests(ctx context.Context, sessionId string) ([]*model.SessionWebRequest, error) {
+	reqs := make([]*model.SessionWebRequest, 0)
+	err := dbpkg.DB.
+		Where("session_id = ?", sessionId).
+		Order("id ASC").
+		Find(&reqs).
+		Error
+	return reqs, err
+}
+
 // GetSessionCmdCounts retrieves command counts for sessions
 func (r *sessionRepository) GetSessionCmdCounts(ctx context.Context, sessionIds []string) (map[string]int64, error) {
 	if len(sessionIds) <= 0 {
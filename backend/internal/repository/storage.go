@@ -7,6 +7,7 @@ import (
 	"github.com/veops/oneterm/internal/model"
 	dbpkg "github.com/veops/oneterm/pkg/db"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // StorageRepository defines interface for storage-related database operations
@@ -37,15 +38,29 @@ type StorageRepository interface {
 	// GetFileMetadata retrieves file metadata
 	GetFileMetadata(ctx context.Context, key string) (*model.FileMetadata, error)
 
+	// GetSessionFileMetadata retrieves the latest file metadata of a session in a category
+	GetSessionFileMetadata(ctx context.Context, sessionId, category string) (*model.FileMetadata, error)
+
 	// CreateFileMetadata creates file metadata record
 	CreateFileMetadata(ctx context.Context, metadata *model.FileMetadata) error
 
+	// UpsertFileMetadata creates file metadata or replaces the record of the same storage key
+	UpsertFileMetadata(ctx context.Context, metadata *model.FileMetadata) error
+
+	// ListUnindexedReplaySessions lists offline sessions after lastId without an indexed replay
+	ListUnindexedReplaySessions(ctx context.Context, lastId, limit int) ([]*model.Session, error)
+
 	// UpdateFileMetadata updates file metadata
 	UpdateFileMetadata(ctx context.Context, metadata *model.FileMetadata) error
+	// SetFileEncryptionKey records the master key an object stored on a storage is encrypted with
+	SetFileEncryptionKey(ctx context.Context, storageName, key, keyId string) error
 
 	// DeleteFileMetadata deletes file metadata
 	DeleteFileMetadata(ctx context.Context, key string) error
 
+	// RenameFileMetadata points the metadata of a moved file to its new key
+	RenameFileMetadata(ctx context.Context, oldKey, newKey string) error
+
 	// ListFileMetadata lists file metadata with pagination
 	ListFileMetadata(ctx context.Context, prefix string, limit, offset int) ([]*model.FileMetadata, int64, error)
 
@@ -143,21 +158,74 @@ func (r *storageRepository) GetFileMetadata(ctx context.Context, key string) (*m
 	return &metadata, nil
 }
 
+// GetSessionFileMetadata retrieves the latest file metadata of a session in a category
+func (r *storageRepository) GetSessionFileMetadata(ctx context.Context, sessionId, category string) (*model.FileMetadata, error) {
+	var metadata model.FileMetadata
+	err := dbpkg.DB.
+		Where("session_id = ? AND category = ?", sessionId, category).
+		Order("id DESC").
+		First(&metadata).
+		Error
+	if err != nil {
+		return nil, err
+	}
+	return &metadata, nil
+}
+
 // CreateFileMetadata creates file metadata record
 func (r *storageRepository) CreateFileMetadata(ctx context.Context, metadata *model.FileMetadata) error {
 	return dbpkg.DB.Create(metadata).Error
 }
 
+// UpsertFileMetadata creates file metadata or replaces the record of the same storage key,
+// including a soft deleted one since the unique index still covers it
+func (r *storageRepository) UpsertFileMetadata(ctx context.Context, metadata *model.FileMetadata) error {
+	return dbpkg.DB.Unscoped().
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "storage_key"}}, UpdateAll: true}).
+		Create(metadata).
+		Error
+}
+
+// ListUnindexedReplaySessions lists offline sessions after lastId without an indexed replay
+func (r *storageRepository) ListUnindexedReplaySessions(ctx context.Context, lastId, limit int) ([]*model.Session, error) {
+	indexed := dbpkg.DB.Model(&model.FileMetadata{}).
+		Select("session_id").
+		Where("category = ?", model.FileCategoryReplay)
+
+	var sessions []*model.Session
+	err := dbpkg.DB.
+		Where("id > ? AND status = ?", lastId, model.SESSIONSTATUS_OFFLINE).
+		Where("session_id NOT IN (?)", indexed).
+		Order("id ASC").
+		Limit(limit).
+		Find(&sessions).
+		Error
+	return sessions, err
+}
+
 // UpdateFileMetadata updates file metadata
 func (r *storageRepository) UpdateFileMetadata(ctx context.Context, metadata *model.FileMetadata) error {
 	return dbpkg.DB.Save(metadata).Error
 }
 
+// SetFileEncryptionKey records the master key an object stored on a storage is encrypted with
+func (r *storageRepository) SetFileEncryptionKey(ctx context.Context, storageName, key, keyId string) error {
+	return dbpkg.DB.Model(&model.FileMetadata{}).
+		Where("storage_key = ? AND storage_name = ?", key, storageName).
+		Update("encryption_key_id", keyId).
+		Error
+}
+
 // DeleteFileMetadata deletes file metadata
 func (r *storageRepository) DeleteFileMetadata(ctx context.Context, key string) error {
 	return dbpkg.DB.Where("storage_key = ?", key).Delete(&model.FileMetadata{}).Error
 }
 
+// RenameFileMetadata points the metadata of a moved file to its new key
+func (r *storageRepository) RenameFileMetadata(ctx context.Context, oldKey, newKey string) error {
+	return dbpkg.DB.Model(&model.FileMetadata{}).Where("storage_key = ?", oldKey).Update("storage_key", newKey).Error
+}
+
 // ListFileMetadata lists file metadata with pagination
 func (r *storageRepository) ListFileMetadata(ctx context.Context, prefix string, limit, offset int) ([]*model.FileMetadata, int64, error) {
 	var metadata []*model.FileMetadata
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm/clause"
+
+	"github.com/veops/oneterm/internal/model"
+	dbpkg "github.com/veops/oneterm/pkg/db"
+)
+
+// StorageReplicationRepository defines the interface for file replicas and storage migrations
+type StorageReplicationRepository interface {
+	// UpsertReplica creates a replica or resets the one of the same key and target
+	UpsertReplica(ctx context.Context, replica *model.FileReplica) error
+	GetReplica(ctx context.Context, key, targetStorage string) (*model.FileReplica, error)
+	GetReplicasByStatus(ctx context.Context, status ...string) ([]*model.FileReplica, error)
+	// GetCompletedReplicas retrieves the verified copies of a file
+	GetCompletedReplicas(ctx context.Context, key string) ([]*model.FileReplica, error)
+	UpdateReplica(ctx context.Context, replica *model.FileReplica) error
+	DeleteReplica(ctx context.Context, key, targetStorage string) error
+
+	CreateMigration(ctx context.Context, migration *model.StorageMigration) error
+	GetMigration(ctx context.Context, id int) (*model.StorageMigration, error)
+	GetMigrations(ctx context.Context) ([]*model.StorageMigration, error)
+	GetMigrationsByStatus(ctx context.Context, status ...string) ([]*model.StorageMigration, error)
+	UpdateMigration(ctx context.Context, migration *model.StorageMigration) error
+
+	// ListFileMetadataAfter lists the files indexed on a storage after lastId, category empty for all
+	ListFileMetadataAfter(ctx context.Context, storageName, category string, lastId, limit int) ([]*model.FileMetadata, error)
+	// CountFileMetadataAfter counts the files indexed on a storage after lastId, category empty for all
+	CountFileMetadataAfter(ctx context.Context, storageName, category string, lastId int) (int64, error)
+}
+
+type storageReplicationRepository struct{}
+
+// NewStorageReplicationRepository creates a new storage replication repository
+func NewStorageReplicationRepository() StorageReplicationRepository {
+	return &storageReplicationRepository{}
+}
+
+// UpsertReplica creates a replica or resets the one of the same key and target
+func (r *storageReplicationRepository) UpsertReplica(ctx context.Context, replica *model.FileReplica) error {
+	return dbpkg.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "storage_key"}, {Name: "target_storage"}},
+		DoUpdates: clause.AssignmentColumns([]string{"source_storage", "category", "file_size", "checksum", "status", "attempts", "error_message", "updated_at"}),
+	}).Create(replica).Error
+}
+
+// GetReplica retrieves the replica of a file on a storage
+func (r *storageReplicationRepository) GetReplica(ctx context.Context, key, targetStorage string) (*model.FileReplica, error) {
+	replica := &model.FileReplica{}
+	if err := dbpkg.DB.Where("storage_key = ? AND target_storage = ?", key, targetStorage).First(replica).Error; err != nil {
+		return nil, err
+	}
+	return replica, nil
+}
+
+// GetReplicasByStatus retrieves replicas in any of the given status, oldest first
+func (r *storageReplicationRepository) GetReplicasByStatus(ctx context.Context, status ...string) ([]*model.FileReplica, error) {
+	var replicas []*model.FileReplica
+	err := dbpkg.DB.
+		Where("status IN ?", status).
+		Order("id ASC").
+		Find(&replicas).
+		Error
+	return replicas, err
+}
+
+// GetCompletedReplicas retrieves the verified copies of a file
+func (r *storageReplicationRepository) GetCompletedReplicas(ctx context.Context, key string) ([]*model.FileReplica, error) {
+	var replicas []*model.FileReplica
+	err := dbpkg.DB.
+		Where("storage_key = ? AND status = ?", key, model.ReplicaStatusCompleted).
+		Order("id ASC").
+		Find(&replicas).
+		Error
+	return replicas, err
+}
+
+// UpdateReplica saves the state of a replica
+func (r *storageReplicationRepository) UpdateReplica(ctx context.Context, replica *model.FileReplica) error {
+	return dbpkg.DB.Save(replica).Error
+}
+
+// DeleteReplica deletes the replica of a file on a storage
+func (r *storageReplicationRepository) DeleteReplica(ctx context.Context, key, targetStorage string) error {
+	return dbpkg.DB.Where("storage_key = ? AND target_storage = ?", key, targetStorage).Delete(&model.FileReplica{}).Error
+}
+
+// CreateMigration creates a storage migration job
+func (r *storageReplicationRepository) CreateMigration(ctx context.Context, migration *model.StorageMigration) error {
+	return dbpkg.DB.Create(migration).Error
+}
+
+// GetMigration retrieves a storage migration job by ID
+func (r *storageReplicationRepository) GetMigration(ctx context.Context, id int) (*model.StorageMigration, error) {
+	migration := &model.StorageMigration{}
+	if err := dbpkg.DB.Where("id = ?", id).First(migration).Error; err != nil {
+		return nil, err
+	}
+	return migration, nil
+}
+
+// GetMigrations retrieves all storage migration jobs, newest first
+func (r *storageReplicationRepository) GetMigrations(ctx context.Context) ([]*model.StorageMigration, error) {
+	var migrations []*model.StorageMigration
+	err := dbpkg.DB.Order("id DESC").Find(&migrations).Error
+	return migrations, err
+}
+
+// GetMigrationsByStatus retrieves storage migration jobs in any of the given status, oldest first
+func (r *storageReplicationRepository) GetMigrationsByStatus(ctx context.Context, status ...string) ([]*model.StorageMigration, error) {
+	var migrations []*model.StorageMigration
+	err := dbpkg.DB.
+		Where("status IN ?", status).
+		Order("id ASC").
+		Find(&migrations).
+		Error
+	return migrations, err
+}
+
+// UpdateMigration saves the state of a storage migration job
+func (r *storageReplicationRepository) UpdateMigration(ctx context.Context, migration *model.StorageMigration) error {
+	return dbpkg.DB.Save(migration).Error
+}
+
+// ListFileMetadataAfter lists the files indexed on a storage after lastId, category empty for all
+func (r *storageReplicationRepository) ListFileMetadataAfter(ctx context.Context, storageName, category string, lastId, limit int) ([]*model.FileMetadata, error) {
+	var metadata []*model.FileMetadata
+	db := dbpkg.DB.Where("storage_name = ? AND id > ?", storageName, lastId)
+	if category != "" {
+		db = db.Where("category = ?", category)
+	}
+	err := db.Order("id ASC").Limit(limit).Find(&metadata).Error
+	return metadata, err
+}
+
+// CountFileMetadataAfter counts the files indexed on a storage after lastId, category empty for all
+func (r *storageReplicationRepository) CountFileMetadataAfter(ctx context.Context, storageName, category string, lastId int) (int64, error) {
+	var count int64
+	db := dbpkg.DB.Model(&model.FileMetadata{}).Where("storage_name = ? AND id > ?", storageName, lastId)
+	if category != "" {
+		db = db.Where("category = ?", category)
+	}
+	err := db.Count(&count).Error
+	return count, err
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 
 	"github.com/gin-gonic/gin"
@@ -28,6 +29,11 @@ func NewAccountService() *AccountService {
 
 // ValidatePublicKey validates the given public key
 func (s *AccountService) ValidatePublicKey(account *model.Account) error {
+	if account.AccountType == model.AUTHMETHOD_CERT {
+		// Client certificate and key are stored together as PEM blocks
+		_, err := tls.X509KeyPair([]byte(account.Pk), []byte(account.Pk))
+		return err
+	}
 	if account.AccountType != model.AUTHMETHOD_PUBLICKEY {
 		return nil
 	}
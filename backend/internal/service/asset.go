@@ -2,7 +2,11 @@ package service
 
 import (
 	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/samber/lo"
@@ -43,6 +47,171 @@ func (s *AssetService) PreprocessAssetData(asset *model.Asset) {
 	s.ensureAuthorizationFormat(asset)
 }
 
+var (
+	rdpSecurityModes = []string{"any", "nla", "nla-ext", "tls", "rdp", "vmconnect"}
+	rdpColorDepths   = []int{8, 16, 24, 32}
+	// Keyboard layouts known by guacd
+	rdpServerLayouts = []string{
+		"failsafe", "da-dk-qwerty", "de-ch-qwertz", "de-de-qwertz", "en-gb-qwerty", "en-us-qwerty",
+		"es-es-qwerty", "es-latam-qwerty", "fr-be-azerty", "fr-ch-qwertz", "fr-fr-azerty", "hu-hu-qwertz",
+		"it-it-qwerty", "ja-jp-qwerty", "no-no-qwerty", "pl-pl-qwerty", "pt-br-qwerty", "pt-pt-qwerty",
+		"ro-ro-qwerty", "sv-se-qwerty", "tr-tr-qwerty",
+	}
+	webProxyMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE"}
+	// Headers the web proxy rewrites itself, assets cannot inject them
+	webProxyReservedHeaders = []string{"Host", "Cookie", "Origin", "Referer", "Content-Length", "Transfer-Encoding", "Connection"}
+)
+
+// ValidateAssetData validates the protocol specific configuration of an asset
+func (s *AssetService) ValidateAssetData(asset *model.Asset) error {
+	switch asset.TerminalBackend {
+	case "", model.TerminalBackendNative, model.TerminalBackendGuacd:
+	default:
+		return fmt.Errorf("unsupported terminal backend %q", asset.TerminalBackend)
+	}
+	if asset.RdpConfig != nil {
+		if err := s.validateRdpConfig(asset.RdpConfig); err != nil {
+			return fmt.Errorf("invalid rdp config: %w", err)
+		}
+	}
+	if asset.WebConfig != nil {
+		if err := s.validateWebAuth(asset.WebConfig); err != nil {
+			return fmt.Errorf("invalid web config: %w", err)
+		}
+	}
+	if asset.WebConfig != nil && asset.WebConfig.ProxySettings != nil {
+		if err := s.validateWebProxySettings(asset.WebConfig.ProxySettings); err != nil {
+			return fmt.Errorf("invalid web proxy settings: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *AssetService) validateWebAuth(cfg *model.WebConfig) error {
+	switch cfg.AuthMode {
+	case "", model.WebAuthModeNone, model.WebAuthModeSmart, model.WebAuthModeManual:
+	case model.WebAuthModeBearer:
+		cfg.BearerToken = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(cfg.BearerToken), "Bearer "))
+		if cfg.BearerToken == "" {
+			return fmt.Errorf("bearer token is required in the %s auth mode", cfg.AuthMode)
+		}
+	case model.WebAuthModeHeader:
+		if len(cfg.InjectHeaders) == 0 {
+			return fmt.Errorf("inject headers are required in the %s auth mode", cfg.AuthMode)
+		}
+	default:
+		return fmt.Errorf("unsupported auth mode %q", cfg.AuthMode)
+	}
+
+	headers := make(map[string]string, len(cfg.InjectHeaders))
+	for k, v := range cfg.InjectHeaders {
+		name := http.CanonicalHeaderKey(strings.TrimSpace(k))
+		if name == "" || strings.ContainsAny(name, " \t\r\n:") || strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("invalid inject header %q", k)
+		}
+		if lo.Contains(webProxyReservedHeaders, name) {
+			return fmt.Errorf("inject header %q is set by the proxy", k)
+		}
+		headers[name] = v
+	}
+	cfg.InjectHeaders = headers
+	return nil
+}
+
+func (s *AssetService) validateWebProxySettings(settings *model.WebProxySettings) error {
+	normalizeMethods := func(methods []string) error {
+		for i, m := range methods {
+			methods[i] = strings.ToUpper(strings.TrimSpace(m))
+			if !lo.Contains(webProxyMethods, methods[i]) {
+				return fmt.Errorf("unsupported method %q", m)
+			}
+		}
+		return nil
+	}
+	if err := normalizeMethods(settings.AllowedMethods); err != nil {
+		return err
+	}
+
+	for i := range settings.PathRules {
+		rule := &settings.PathRules[i]
+		if rule.Action != model.WebPathRuleAllow && rule.Action != model.WebPathRuleDeny {
+			return fmt.Errorf("path rule %d: action should be %s or %s", i+1, model.WebPathRuleAllow, model.WebPathRuleDeny)
+		}
+		if rule.PatternType == "" {
+			rule.PatternType = model.WebPathPatternGlob
+		}
+		if rule.PatternType != model.WebPathPatternGlob && rule.PatternType != model.WebPathPatternRegex {
+			return fmt.Errorf("path rule %d: pattern type should be %s or %s", i+1, model.WebPathPatternGlob, model.WebPathPatternRegex)
+		}
+		if strings.TrimSpace(rule.Pattern) == "" {
+			return fmt.Errorf("path rule %d: pattern is required", i+1)
+		}
+		if _, err := rule.Regexp(); err != nil {
+			return fmt.Errorf("path rule %d: %w", i+1, err)
+		}
+		if err := normalizeMethods(rule.Methods); err != nil {
+			return fmt.Errorf("path rule %d: %w", i+1, err)
+		}
+	}
+
+	if settings.MaxUploadSize < 0 {
+		return fmt.Errorf("max upload size should not be negative")
+	}
+	normalizeExtensions := func(exts []string) []string {
+		return lo.Uniq(lo.FilterMap(exts, func(e string, _ int) (string, bool) {
+			e = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(e), "."))
+			return e, e != ""
+		}))
+	}
+	settings.AllowedUploadExtensions = normalizeExtensions(settings.AllowedUploadExtensions)
+	settings.BlockedUploadExtensions = normalizeExtensions(settings.BlockedUploadExtensions)
+
+	return nil
+}
+
+func (s *AssetService) validateRdpConfig(cfg *model.RdpConfig) error {
+	cfg.Security = strings.ToLower(strings.TrimSpace(cfg.Security))
+	if cfg.Security != "" && !lo.Contains(rdpSecurityModes, cfg.Security) {
+		return fmt.Errorf("unsupported security mode %q, valid modes: %v", cfg.Security, rdpSecurityModes)
+	}
+
+	if cfg.ColorDepth != 0 && !lo.Contains(rdpColorDepths, cfg.ColorDepth) {
+		return fmt.Errorf("unsupported color depth %d, valid depths: %v", cfg.ColorDepth, rdpColorDepths)
+	}
+
+	cfg.ServerLayout = strings.ToLower(strings.TrimSpace(cfg.ServerLayout))
+	if cfg.ServerLayout != "" && !lo.Contains(rdpServerLayouts, cfg.ServerLayout) {
+		return fmt.Errorf("unsupported keyboard layout %q", cfg.ServerLayout)
+	}
+
+	cfg.Timezone = strings.TrimSpace(cfg.Timezone)
+	if cfg.Timezone != "" {
+		if _, err := time.LoadLocation(cfg.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", cfg.Timezone)
+		}
+	}
+
+	// Fingerprints are accepted with or without colons and stored as lowercase hex
+	for i, fp := range cfg.CertFingerprints {
+		fp = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fp), ":", ""))
+		if b, err := hex.DecodeString(fp); err != nil || len(b) != 32 {
+			return fmt.Errorf("certificate fingerprint %q is not a SHA-256 hash", cfg.CertFingerprints[i])
+		}
+		cfg.CertFingerprints[i] = fp
+	}
+	if len(cfg.CertFingerprints) > 0 && !cfg.VerifyCert {
+		return fmt.Errorf("certificate fingerprints require certificate verification")
+	}
+
+	cfg.Domain = strings.TrimSpace(cfg.Domain)
+	cfg.RemoteApp = strings.TrimSpace(cfg.RemoteApp)
+	if cfg.RemoteApp == "" && (cfg.RemoteAppDir != "" || cfg.RemoteAppArgs != "") {
+		return fmt.Errorf("remote app directory and arguments require a remote app program")
+	}
+
+	return nil
+}
+
 // ensureAuthorizationFormat ensures asset.Authorization is in the correct V2 format
 // Handles backward compatibility with old V1 format
 func (s *AssetService) ensureAuthorizationFormat(asset *model.Asset) {
@@ -0,0 +1,486 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/repository"
+	dbpkg "github.com/veops/oneterm/pkg/db"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+const (
+	// auditExportMaxSessions bounds the sessions packed in one bundle, larger selections have to be split
+	auditExportMaxSessions = 1000
+	// auditExportPrefix is the key prefix of the bundles, retention knows them by it
+	auditExportPrefix = "audit_exports/"
+)
+
+// AuditExportRequest selects the sessions of an audit export, by session id or by user, asset and time range
+type AuditExportRequest struct {
+	SessionId string     `json:"session_id"`
+	Uid       int        `json:"uid"`
+	AssetId   int        `json:"asset_id"`
+	Start     *time.Time `json:"start"`
+	End       *time.Time `json:"end"`
+}
+
+// AuditManifest lists every file of an audit bundle with its hash, manifest.sig holds its signature
+type AuditManifest struct {
+	Version      int                  `json:"version"`
+	ExportId     int                  `json:"export_id"`
+	Filter       *AuditExportRequest  `json:"filter"`
+	Sessions     []string             `json:"sessions"`
+	Files        []*AuditManifestFile `json:"files"`
+	Errors       []string             `json:"errors"` // evidence that could not be collected
+	SigningKeyId string               `json:"signing_key_id"`
+	PublicKey    string               `json:"public_key"` // base64 Ed25519 public key verifying manifest.sig
+	CreatedAt    time.Time            `json:"created_at"`
+	CreatorId    int                  `json:"creator_id"`
+}
+
+// AuditManifestFile is a file of an audit bundle
+type AuditManifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+// AuditExportService packs session evidence into signed bundles in a background worker
+type AuditExportService struct {
+	repo        repository.AuditExportRepository
+	sessionRepo repository.SessionRepository
+	authRepo    repository.IAuthorizationV2Repository
+	queue       chan int
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+// NewAuditExportService creates a new audit export service
+func NewAuditExportService() *AuditExportService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &AuditExportService{
+		repo:        repository.NewAuditExportRepository(),
+		sessionRepo: repository.NewSessionRepository(),
+		authRepo:    repository.NewAuthorizationV2Repository(dbpkg.DB),
+		queue:       make(chan int, 256),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Global audit export service instance
+var DefaultAuditExportService *AuditExportService
+
+// InitAuditExportService starts the export worker and requeues unfinished jobs
+func InitAuditExportService() {
+	DefaultAuditExportService = NewAuditExportService()
+	DefaultAuditExportService.Start()
+}
+
+// StopAuditExportService stops the export worker
+func StopAuditExportService() {
+	if DefaultAuditExportService != nil {
+		DefaultAuditExportService.Stop()
+	}
+}
+
+// Start starts the worker, jobs interrupted by a restart are built again
+func (s *AuditExportService) Start() {
+	s.wg.Add(1)
+	go s.work()
+
+	exports, err := s.repo.GetAuditExportsByStatus(s.ctx, model.AuditExportStatusPending, model.AuditExportStatusRunning)
+	if err != nil {
+		logger.L().Error("Failed to load unfinished audit export jobs", zap.Error(err))
+		return
+	}
+	for _, e := range exports {
+		s.enqueue(e.Id)
+	}
+
+	logger.L().Info("Audit export service started", zap.Int("requeued", len(exports)))
+}
+
+// Stop stops the worker, a running export is built again on next start
+func (s *AuditExportService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+	logger.L().Info("Audit export service stopped")
+}
+
+// CreateAuditExport queues the export of the sessions selected by req
+func (s *AuditExportService) CreateAuditExport(ctx context.Context, req *AuditExportRequest, uid int) (*model.AuditExport, error) {
+	if req.SessionId == "" && req.Uid == 0 && req.AssetId == 0 && req.Start == nil && req.End == nil {
+		return nil, fmt.Errorf("a session id or a user, asset or time range filter is required")
+	}
+	if req.Start != nil && req.End != nil && req.End.Before(*req.Start) {
+		return nil, fmt.Errorf("end is before start")
+	}
+	if req.SessionId != "" {
+		if _, err := s.sessionRepo.GetSession(ctx, req.SessionId); err != nil {
+			return nil, fmt.Errorf("session %s: %w", req.SessionId, err)
+		}
+	}
+
+	export := &model.AuditExport{
+		SessionId: req.SessionId,
+		Uid:       req.Uid,
+		AssetId:   req.AssetId,
+		Start:     req.Start,
+		End:       req.End,
+		Status:    model.AuditExportStatusPending,
+		CreatorId: uid,
+	}
+	if err := s.repo.CreateAuditExport(ctx, export); err != nil {
+		return nil, err
+	}
+	s.enqueue(export.Id)
+
+	return export, nil
+}
+
+// GetAuditExport gets an export job
+func (s *AuditExportService) GetAuditExport(ctx context.Context, id int) (*model.AuditExport, error) {
+	return s.repo.GetAuditExport(ctx, id)
+}
+
+// GetAuditExports lists the latest export jobs
+func (s *AuditExportService) GetAuditExports(ctx context.Context) ([]*model.AuditExport, error) {
+	return s.repo.GetAuditExports(ctx, 100)
+}
+
+// OpenAuditExport opens the bundle of a completed export job
+func (s *AuditExportService) OpenAuditExport(ctx context.Context, id int) (io.ReadCloser, *model.AuditExport, error) {
+	export, err := s.repo.GetAuditExport(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if export.Status != model.AuditExportStatusCompleted {
+		return nil, export, fmt.Errorf("audit export %d is %s", id, export.Status)
+	}
+
+	reader, err := DefaultStorageService.DownloadFromStorage(ctx, export.StorageName, export.StorageKey)
+	if err != nil {
+		return nil, export, err
+	}
+	return reader, export, nil
+}
+
+func (s *AuditExportService) enqueue(id int) {
+	// Never block the caller, jobs left in the DB are picked up on the next start
+	select {
+	case s.queue <- id:
+	default:
+		logger.L().Warn("Audit export queue is full", zap.Int("id", id))
+	}
+}
+
+func (s *AuditExportService) work() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case id := <-s.queue:
+			s.process(id)
+		}
+	}
+}
+
+func (s *AuditExportService) process(id int) {
+	export, err := s.repo.GetAuditExport(s.ctx, id)
+	if err != nil {
+		logger.L().Error("Failed to load audit export job", zap.Int("id", id), zap.Error(err))
+		return
+	}
+	if export.Status == model.AuditExportStatusCompleted {
+		return
+	}
+
+	export.Status = model.AuditExportStatusRunning
+	export.StartedAt = lo.ToPtr(time.Now())
+	export.ErrorMessage = ""
+	if err = s.repo.UpdateAuditExport(s.ctx, export); err != nil {
+		logger.L().Error("Failed to update audit export job", zap.Int("id", id), zap.Error(err))
+		return
+	}
+
+	err = s.build(export)
+	if s.ctx.Err() != nil {
+		// Shutting down, leave the job running so it is requeued on next start
+		return
+	}
+
+	export.CompletedAt = lo.ToPtr(time.Now())
+	export.Status = model.AuditExportStatusCompleted
+	if err != nil {
+		export.Status = model.AuditExportStatusFailed
+		export.ErrorMessage = err.Error()
+		logger.L().Error("Audit export failed", zap.Int("id", id), zap.Error(err))
+	}
+	if err = s.repo.UpdateAuditExport(context.Background(), export); err != nil {
+		logger.L().Error("Failed to update audit export job", zap.Int("id", id), zap.Error(err))
+	}
+}
+
+// build writes the bundle of an export to a temporary zip and stores it
+func (s *AuditExportService) build(export *model.AuditExport) error {
+	if DefaultStorageService == nil {
+		return fmt.Errorf("storage service not initialized")
+	}
+	ctx := s.ctx
+
+	var sessions []*model.Session
+	for lastId := 0; ; {
+		batch, err := s.repo.GetExportSessions(ctx, export, lastId, 100)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		sessions = append(sessions, batch...)
+		if len(sessions) > auditExportMaxSessions {
+			return fmt.Errorf("export selects more than %d sessions, narrow the filter", auditExportMaxSessions)
+		}
+		lastId = batch[len(batch)-1].Id
+	}
+	if len(sessions) == 0 {
+		return fmt.Errorf("no closed session matches the export")
+	}
+
+	tmp, err := os.CreateTemp("", "oneterm-audit-export-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	key, keyId := replaySigningKey()
+	bundle := &auditBundle{
+		zip: zip.NewWriter(tmp),
+		manifest: &AuditManifest{
+			Version:  1,
+			ExportId: export.Id,
+			Filter: &AuditExportRequest{
+				SessionId: export.SessionId, Uid: export.Uid, AssetId: export.AssetId, Start: export.Start, End: export.End,
+			},
+			Sessions:     lo.Map(sessions, func(s *model.Session, _ int) string { return s.SessionId }),
+			Files:        []*AuditManifestFile{},
+			Errors:       []string{},
+			SigningKeyId: keyId,
+			PublicKey:    base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+			CreatedAt:    time.Now(),
+			CreatorId:    export.CreatorId,
+		},
+	}
+
+	for _, session := range sessions {
+		if err = s.writeSession(ctx, bundle, session); err != nil {
+			return fmt.Errorf("session %s: %w", session.SessionId, err)
+		}
+	}
+	if err = s.writeRules(ctx, bundle, sessions); err != nil {
+		return fmt.Errorf("authorization rules: %w", err)
+	}
+
+	// The manifest is written last so it covers every other file
+	manifest, err := json.MarshalIndent(bundle.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifest))
+	if err = bundle.writeUnlisted("manifest.json", manifest); err != nil {
+		return err
+	}
+	if err = bundle.writeUnlisted("manifest.sig", []byte(signature)); err != nil {
+		return err
+	}
+	if err = bundle.zip.Close(); err != nil {
+		return err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	metadata := &model.FileMetadata{
+		FileName: fmt.Sprintf("audit_export_%d.zip", export.Id),
+		MimeType: "application/zip",
+		Category: model.FileCategoryAuditExport,
+		UserId:   export.CreatorId,
+	}
+	if err = DefaultStorageService.UploadFile(ctx, auditExportPrefix+metadata.FileName, tmp, size, metadata); err != nil {
+		return err
+	}
+
+	export.SessionCount = len(sessions)
+	export.StorageName = metadata.StorageName
+	export.StorageKey = metadata.StorageKey
+	export.FileSize = metadata.FileSize
+	export.Checksum = metadata.Checksum
+	export.ManifestSignature = signature
+	export.SigningKeyId = keyId
+
+	return nil
+}
+
+// writeSession adds the records and recordings of a session under sessions/<session id>/
+func (s *AuditExportService) writeSession(ctx context.Context, bundle *auditBundle, session *model.Session) error {
+	dir := path.Join("sessions", session.SessionId)
+
+	cmds, err := s.sessionRepo.GetSessionCmds(ctx, session.SessionId)
+	if err != nil {
+		return err
+	}
+	fileHistories, err := s.repo.GetSessionFileHistories(ctx, session)
+	if err != nil {
+		return err
+	}
+	histories, err := s.repo.GetHistories(ctx, session.TableName(), []int{session.Id})
+	if err != nil {
+		return err
+	}
+	files, err := s.repo.GetSessionFiles(ctx, session.SessionId)
+	if err != nil {
+		return err
+	}
+
+	records := []lo.Tuple2[string, any]{
+		{A: "session.json", B: session},
+		{A: "commands.json", B: cmds},
+		{A: "file_history.json", B: fileHistories},
+		{A: "history.json", B: histories},
+		{A: "files.json", B: files}, // stored digests and signatures of the recordings
+	}
+	for _, r := range records {
+		if err = bundle.writeJSON(path.Join(dir, r.A), r.B); err != nil {
+			return err
+		}
+	}
+
+	// Recordings are packed as stored, their digests in files.json can be checked against them
+	for _, f := range files {
+		reader, err := DefaultStorageService.DownloadFromStorage(ctx, f.StorageName, f.StorageKey)
+		if err != nil {
+			bundle.manifest.Errors = append(bundle.manifest.Errors, fmt.Sprintf("%s: %v", f.StorageKey, err))
+			continue
+		}
+		err = bundle.write(path.Join(dir, "recordings", path.Base(f.StorageKey)), reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeRules adds the authorization rules that granted the sessions, with their change history
+func (s *AuditExportService) writeRules(ctx context.Context, bundle *auditBundle, sessions []*model.Session) error {
+	rules, err := s.authRepo.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Sessions record the rule that granted them, older ones are matched again as they were opened
+	granted := lo.SliceToMap(sessions, func(session *model.Session) (int, bool) { return session.AuthRuleId, true })
+	legacy := lo.Filter(sessions, func(session *model.Session, _ int) bool { return session.AuthRuleId == 0 })
+	matcher := &AuthorizationMatcher{repo: s.authRepo}
+	requests := lo.Map(legacy, func(session *model.Session, _ int) *model.AuthRequest {
+		req := &model.AuthRequest{
+			UserId:    session.Uid,
+			AssetId:   session.AssetId,
+			AccountId: session.AccountId,
+			Action:    model.ActionConnect,
+			ClientIP:  session.ClientIp,
+			Timestamp: session.CreatedAt,
+		}
+		if asset, err := matcher.getAssetById(session.AssetId); err == nil {
+			req.NodeId = asset.ParentId
+		}
+		if session.Workload != nil {
+			req.Namespace, req.Container = session.Workload.Namespace, session.Workload.Container
+		}
+		return req
+	})
+	rules = lo.Filter(rules, func(rule *model.AuthorizationV2, _ int) bool {
+		if granted[rule.Id] {
+			return true
+		}
+		return rule.Permissions.HasPermission(model.ActionConnect) && lo.SomeBy(requests, func(req *model.AuthRequest) bool {
+			return matcher.matchRule(ctx, rule, req)
+		})
+	})
+
+	histories, err := s.repo.GetHistories(ctx, model.DefaultAuthorizationV2.TableName(),
+		lo.Map(rules, func(rule *model.AuthorizationV2, _ int) int { return rule.Id }))
+	if err != nil {
+		return err
+	}
+
+	if err = bundle.writeJSON("authorization/rules.json", rules); err != nil {
+		return err
+	}
+	return bundle.writeJSON("authorization/history.json", histories)
+}
+
+// auditBundle writes the files of a bundle and records them in its manifest
+type auditBundle struct {
+	zip      *zip.Writer
+	manifest *AuditManifest
+}
+
+func (b *auditBundle) write(name string, reader io.Reader) error {
+	w, err := b.zip.Create(name)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(w, hash), reader)
+	if err != nil {
+		return err
+	}
+	b.manifest.Files = append(b.manifest.Files, &AuditManifestFile{Path: name, Size: size, Sha256: hex.EncodeToString(hash.Sum(nil))})
+	return nil
+}
+
+func (b *auditBundle) writeJSON(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return b.write(name, bytes.NewReader(data))
+}
+
+// writeUnlisted adds a file left out of the manifest, which are the manifest and its signature
+func (b *auditBundle) writeUnlisted(name string, data []byte) error {
+	w, err := b.zip.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -456,6 +456,13 @@ func (s *AuthorizationService) HasAuthorizationV2(ctx *gin.Context, sess *gsessi
 		ClientIP:  clientIP,
 		Timestamp: time.Now(),
 	}
+	if sess.Workload != nil {
+		baseReq.Namespace = sess.Workload.Namespace
+		// Docker sessions always name a container, pod containers are optional so only namespaces apply there
+		if sess.IsDocker() {
+			baseReq.Container = sess.Workload.Container
+		}
+	}
 
 	// Use V2 matcher with filtered rule scope
 	return s.matcher.MatchBatchWithScope(ctx, baseReq, authV2ResourceIds)
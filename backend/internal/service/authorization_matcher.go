@@ -71,11 +71,12 @@ func (m *AuthorizationMatcher) Match(ctx *gin.Context, req *model.AuthRequest) (
 			// If this rule allows the requested action, grant permission immediately
 			if rule.Permissions.HasPermission(req.Action) {
 				result := &model.AuthResult{
-					Allowed:     true,
-					Permissions: rule.Permissions,
-					Reason:      fmt.Sprintf("Allowed by rule: %s", rule.Name),
-					RuleId:      rule.Id,
-					RuleName:    rule.Name,
+					Allowed:      true,
+					Permissions:  rule.Permissions,
+					Reason:       fmt.Sprintf("Allowed by rule: %s", rule.Name),
+					RuleId:       rule.Id,
+					RuleName:     rule.Name,
+					Restrictions: rule.AccessControl.Restrictions(),
 				}
 
 				// Cache the result
@@ -142,6 +143,14 @@ func (m *AuthorizationMatcher) matchRule(ctx context.Context, rule *model.Author
 		return false
 	}
 
+	// Check namespace and container selectors for container platform workloads
+	if req.Namespace != "" && !m.matchNameSelector(rule.NamespaceSelector, req.Namespace) {
+		return false
+	}
+	if req.Container != "" && !m.matchNameSelector(rule.ContainerSelector, req.Container) {
+		return false
+	}
+
 	// Check access control restrictions
 	if !m.checkAccessControl(rule.AccessControl, req) {
 		return false
@@ -195,6 +204,24 @@ func (m *AuthorizationMatcher) matchSelector(ctx context.Context, selector model
 	}
 }
 
+// matchNameSelector checks if a selector matches a named target that has no id, e.g. a kubernetes namespace
+func (m *AuthorizationMatcher) matchNameSelector(selector model.TargetSelector, name string) bool {
+	switch selector.Type {
+	case "", model.SelectorTypeAll:
+		return true
+
+	case model.SelectorTypeIds:
+		// Names act as identifiers for unmanaged targets
+		return lo.Contains(selector.Values, name)
+
+	case model.SelectorTypeRegex:
+		return m.matchRegexPatterns(selector.Values, name)
+
+	default:
+		return false
+	}
+}
+
 // matchRegexPatterns checks if any regex pattern matches the target name
 func (m *AuthorizationMatcher) matchRegexPatterns(patterns []string, targetName string) bool {
 	for _, pattern := range patterns {
@@ -511,8 +538,8 @@ func (m *AuthorizationMatcher) GetTargetTags(targetType string, targetId int) ([
 
 // getCacheKey generates a cache key for the request
 func (m *AuthorizationMatcher) getCacheKey(req *model.AuthRequest) string {
-	return fmt.Sprintf("auth_v2:%d:%d:%d:%d:%s",
-		req.UserId, req.NodeId, req.AssetId, req.AccountId, req.Action)
+	return fmt.Sprintf("auth_v2:%d:%d:%d:%d:%s:%s:%s",
+		req.UserId, req.NodeId, req.AssetId, req.AccountId, req.Namespace, req.Container, req.Action)
 }
 
 // getCachedResult retrieves cached authorization result
@@ -550,11 +577,12 @@ func (m *AuthorizationMatcher) MatchWithScope(ctx *gin.Context, req *model.AuthR
 			// If this rule allows the requested action, grant permission immediately
 			if rule.Permissions.HasPermission(req.Action) {
 				return &model.AuthResult{
-					Allowed:     true,
-					Permissions: rule.Permissions,
-					Reason:      fmt.Sprintf("Allowed by rule: %s", rule.Name),
-					RuleId:      rule.Id,
-					RuleName:    rule.Name,
+					Allowed:      true,
+					Permissions:  rule.Permissions,
+					Reason:       fmt.Sprintf("Allowed by rule: %s", rule.Name),
+					RuleId:       rule.Id,
+					RuleName:     rule.Name,
+					Restrictions: rule.AccessControl.Restrictions(),
 				}, nil
 			}
 		}
@@ -603,6 +631,8 @@ func (m *AuthorizationMatcher) MatchBatchWithScope(ctx *gin.Context, req *model.
 		NodeId:    req.NodeId,
 		AssetId:   req.AssetId,
 		AccountId: req.AccountId,
+		Namespace: req.Namespace,
+		Container: req.Container,
 		ClientIP:  req.ClientIP,
 		UserAgent: req.UserAgent,
 		Timestamp: req.Timestamp,
@@ -614,11 +644,12 @@ func (m *AuthorizationMatcher) MatchBatchWithScope(ctx *gin.Context, req *model.
 			for _, action := range req.Actions {
 				if rule.Permissions.HasPermission(action) && !results[action].Allowed {
 					results[action] = &model.AuthResult{
-						Allowed:     true,
-						Permissions: rule.Permissions,
-						Reason:      fmt.Sprintf("Allowed by rule: %s", rule.Name),
-						RuleId:      rule.Id,
-						RuleName:    rule.Name,
+						Allowed:      true,
+						Permissions:  rule.Permissions,
+						Reason:       fmt.Sprintf("Allowed by rule: %s", rule.Name),
+						RuleId:       rule.Id,
+						RuleName:     rule.Name,
+						Restrictions: rule.AccessControl.Restrictions(),
 					}
 				}
 			}
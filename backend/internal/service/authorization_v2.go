@@ -63,6 +63,13 @@ func (s *AuthorizationV2Service) ValidateRule(ctx context.Context, rule *model.A
 	if !s.isValidSelectorType(rule.AccountSelector.Type) {
 		return errors.New("invalid account selector type")
 	}
+	// Namespace selector is optional, empty means no restriction
+	if rule.NamespaceSelector.Type != "" && !s.isValidSelectorType(rule.NamespaceSelector.Type) {
+		return errors.New("invalid namespace selector type")
+	}
+	if rule.ContainerSelector.Type != "" && !s.isValidSelectorType(rule.ContainerSelector.Type) {
+		return errors.New("invalid container selector type")
+	}
 	// Note: UserSelector is handled via Rids field for ACL integration
 
 	// Validate regex patterns if type is regex
@@ -81,6 +88,16 @@ func (s *AuthorizationV2Service) ValidateRule(ctx context.Context, rule *model.A
 			return fmt.Errorf("invalid account selector regex: %w", err)
 		}
 	}
+	if rule.NamespaceSelector.Type == model.SelectorTypeRegex {
+		if err := s.validateRegexPatterns(rule.NamespaceSelector.Values); err != nil {
+			return fmt.Errorf("invalid namespace selector regex: %w", err)
+		}
+	}
+	if rule.ContainerSelector.Type == model.SelectorTypeRegex {
+		if err := s.validateRegexPatterns(rule.ContainerSelector.Values); err != nil {
+			return fmt.Errorf("invalid container selector regex: %w", err)
+		}
+	}
 	// Note: User selection is handled via Rids field, no regex validation needed
 
 	// Validate time template reference if present
@@ -923,9 +940,11 @@ func (s *AuthorizationV2Service) CloneRule(ctx context.Context, sourceId int, ne
 		ValidTo:     sourceRule.ValidTo,
 
 		// Copy selectors
-		NodeSelector:    sourceRule.NodeSelector,
-		AssetSelector:   sourceRule.AssetSelector,
-		AccountSelector: sourceRule.AccountSelector,
+		NodeSelector:      sourceRule.NodeSelector,
+		AssetSelector:     sourceRule.AssetSelector,
+		AccountSelector:   sourceRule.AccountSelector,
+		NamespaceSelector: sourceRule.NamespaceSelector,
+		ContainerSelector: sourceRule.ContainerSelector,
 
 		// Copy permissions and access control
 		Permissions:   sourceRule.Permissions,
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/veops/oneterm/internal/docker"
+	"github.com/veops/oneterm/internal/repository"
+	"github.com/veops/oneterm/internal/tunneling"
+)
+
+// DockerService handles container discovery for docker assets
+type DockerService struct{}
+
+// NewDockerService creates a new docker service
+func NewDockerService() *DockerService {
+	return &DockerService{}
+}
+
+// ListContainers returns running containers of the asset engine
+func (s *DockerService) ListContainers(ctx context.Context, assetId, accountId int) ([]*docker.Container, error) {
+	asset, account, gateway, err := repository.GetAAG(assetId, accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	sid := uuid.New().String()
+	ip, port, err := tunneling.Proxy(false, sid, "docker", asset, gateway)
+	if err != nil {
+		return nil, err
+	}
+	defer tunneling.CloseTunnels(sid)
+
+	cli, err := docker.NewClient(ip, port, strings.Split(asset.Ip, ":")[0], asset.DockerConfig, account)
+	if err != nil {
+		return nil, err
+	}
+	return cli.ListContainers(ctx)
+}
@@ -498,7 +498,7 @@ func (s *FileService) BuildFileHistoryQuery(ctx *gin.Context) *gorm.DB {
 	db = dbpkg.FilterSearch(ctx, db, "dir", "filename")
 
 	// Apply exact match filters
-	db = dbpkg.FilterEqual(ctx, db, "status", "uid", "asset_id", "account_id", "action")
+	db = dbpkg.FilterEqual(ctx, db, "status", "uid", "asset_id", "account_id", "action", "session_id")
 
 	// Apply client IP filter
 	if clientIp := ctx.Query("client_ip"); clientIp != "" {
@@ -549,17 +549,15 @@ func (s *FileService) RecordFileHistory(ctx context.Context, operation, dir, fil
 		Dir:       dir,
 		Filename:  filename,
 	}
+	if len(sessionId) > 0 {
+		history.SessionId = sessionId[0]
+	}
 
 	if err := s.AddFileHistory(ctx, history); err != nil {
-		// Log error details including sessionId if provided for debugging
-		sessionIdStr := ""
-		if len(sessionId) > 0 {
-			sessionIdStr = sessionId[0]
-		}
 		logger.L().Error("Failed to record file history",
 			zap.Error(err),
 			zap.String("operation", operation),
-			zap.String("sessionId", sessionIdStr),
+			zap.String("sessionId", history.SessionId),
 			zap.Any("history", history))
 		return err
 	}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/veops/oneterm/internal/kubernetes"
+	"github.com/veops/oneterm/internal/repository"
+	"github.com/veops/oneterm/internal/tunneling"
+)
+
+// KubernetesService handles workload discovery for kubernetes assets
+type KubernetesService struct{}
+
+// NewKubernetesService creates a new kubernetes service
+func NewKubernetesService() *KubernetesService {
+	return &KubernetesService{}
+}
+
+// withClient opens a short-lived tunnel to the cluster API and runs fn against it
+func (s *KubernetesService) withClient(assetId, accountId int, fn func(cli *kubernetes.Client) error) error {
+	asset, account, gateway, err := repository.GetAAG(assetId, accountId)
+	if err != nil {
+		return err
+	}
+
+	sid := uuid.New().String()
+	ip, port, err := tunneling.Proxy(false, sid, "kubernetes", asset, gateway)
+	if err != nil {
+		return err
+	}
+	defer tunneling.CloseTunnels(sid)
+
+	cli, err := kubernetes.NewClient(ip, port, strings.Split(asset.Ip, ":")[0], asset.KubernetesConfig, account)
+	if err != nil {
+		return err
+	}
+	return fn(cli)
+}
+
+// ListNamespaces returns namespaces visible to the asset account
+func (s *KubernetesService) ListNamespaces(ctx context.Context, assetId, accountId int) (namespaces []*kubernetes.Namespace, err error) {
+	err = s.withClient(assetId, accountId, func(cli *kubernetes.Client) error {
+		namespaces, err = cli.ListNamespaces(ctx)
+		return err
+	})
+	return
+}
+
+// ListPods returns pods in the namespace together with their containers
+func (s *KubernetesService) ListPods(ctx context.Context, assetId, accountId int, namespace string) (pods []*kubernetes.Pod, err error) {
+	err = s.withClient(assetId, accountId, func(cli *kubernetes.Client) error {
+		pods, err = cli.ListPods(ctx, namespace)
+		return err
+	})
+	return
+}
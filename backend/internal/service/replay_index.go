@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/veops/oneterm/internal/model"
+	dbpkg "github.com/veops/oneterm/pkg/db"
+	"github.com/veops/oneterm/pkg/logger"
+	"github.com/veops/oneterm/pkg/storage"
+)
+
+var replayIndexBackfillRunning atomic.Bool
+
+// StartReplayIndexBackfill indexes replays written before the replay index existed in the background.
+// It runs once unless force is set, progress is tracked as a migration record.
+func StartReplayIndexBackfill(force bool) (bool, error) {
+	if DefaultStorageService == nil {
+		return false, fmt.Errorf("storage service not initialized")
+	}
+
+	if !force {
+		record, err := GetReplayIndexBackfill(context.Background())
+		if err != nil {
+			return false, err
+		}
+		if record != nil && record.Status == model.MigrationStatusCompleted {
+			return false, nil
+		}
+	}
+
+	if !replayIndexBackfillRunning.CompareAndSwap(false, true) {
+		return false, nil
+	}
+
+	go func() {
+		defer replayIndexBackfillRunning.Store(false)
+
+		ctx := context.Background()
+		markReplayIndexBackfill(ctx, model.MigrationStatusRunning, 0, "")
+
+		count, err := DefaultStorageService.(*storageService).backfillReplayIndex(ctx)
+		if err != nil {
+			logger.L().Error("Replay index backfill failed", zap.Int("indexed", count), zap.Error(err))
+			markReplayIndexBackfill(ctx, model.MigrationStatusFailed, count, err.Error())
+			return
+		}
+
+		logger.L().Info("Replay index backfill completed", zap.Int("indexed", count))
+		markReplayIndexBackfill(ctx, model.MigrationStatusCompleted, count, "")
+	}()
+
+	return true, nil
+}
+
+// GetReplayIndexBackfill gets the state of the replay index backfill, nil if it never ran
+func GetReplayIndexBackfill(ctx context.Context) (*model.MigrationRecord, error) {
+	return getMigrationRecord(ctx, model.MigrationReplayIndexBackfill)
+}
+
+func markReplayIndexBackfill(ctx context.Context, status string, count int, errorMsg string) {
+	markMigrationRecord(ctx, model.MigrationReplayIndexBackfill, status, count, errorMsg)
+}
+
+// getMigrationRecord gets the record of a background migration, nil if it never ran
+func getMigrationRecord(ctx context.Context, name string) (*model.MigrationRecord, error) {
+	record := &model.MigrationRecord{}
+	err := dbpkg.DB.Where("migration_name = ?", name).First(record).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	return record, err
+}
+
+// markMigrationRecord saves the progress of a background migration
+func markMigrationRecord(ctx context.Context, name, status string, count int, errorMsg string) {
+	now := time.Now()
+	record, err := getMigrationRecord(ctx, name)
+	if err != nil {
+		logger.L().Error("Failed to load migration record", zap.String("migration", name), zap.Error(err))
+		return
+	}
+	if record == nil {
+		record = &model.MigrationRecord{MigrationName: name}
+	}
+
+	record.Status = status
+	record.RecordsCount = count
+	record.ErrorMessage = errorMsg
+	if status == model.MigrationStatusRunning {
+		record.StartedAt = &now
+		record.CompletedAt = nil
+	} else {
+		record.CompletedAt = &now
+	}
+
+	if err = dbpkg.DB.Save(record).Error; err != nil {
+		logger.L().Error("Failed to save migration record", zap.String("migration", name), zap.Error(err))
+	}
+}
+
+// backfillReplayIndex probes every provider for the keys earlier versions wrote replays to
+// and indexes the ones found
+func (s *storageService) backfillReplayIndex(ctx context.Context) (int, error) {
+	names := lo.Keys(s.providers)
+	sort.Slice(names, func(i, j int) bool {
+		// Primary first, it is where replays were written to
+		if (names[i] == s.primary) != (names[j] == s.primary) {
+			return names[i] == s.primary
+		}
+		return names[i] < names[j]
+	})
+
+	count, lastId := 0, 0
+	for {
+		sessions, err := s.storageRepo.ListUnindexedReplaySessions(ctx, lastId, 500)
+		if err != nil {
+			return count, err
+		}
+		if len(sessions) == 0 {
+			return count, nil
+		}
+		lastId = sessions[len(sessions)-1].Id
+
+		for _, session := range sessions {
+			for _, name := range names {
+				entry, err := s.probeReplay(ctx, name, s.providers[name], session)
+				if err != nil {
+					logger.L().Warn("Failed to probe replay", zap.String("session_id", session.SessionId), zap.String("storage", name), zap.Error(err))
+					continue
+				}
+				if entry == nil {
+					continue
+				}
+				if err = s.RecordReplay(ctx, entry); err != nil {
+					return count, err
+				}
+				count++
+				break
+			}
+		}
+	}
+}
+
+// probeReplay looks for the replay of a session on a provider, nil if it is not there
+func (s *storageService) probeReplay(ctx context.Context, name string, provider storage.Provider, session *model.Session) (*storage.ReplayEntry, error) {
+	filenames := []string{session.SessionId + ".cast"}
+	for _, encoding := range []string{storage.EncodingGzip, storage.EncodingZstd} {
+		filenames = append(filenames, session.SessionId+".cast"+storage.CompressedExtension(encoding))
+	}
+	if session.IsGuacd() {
+		filenames = []string{session.SessionId + model.GuacRecordingExtension, session.SessionId + model.GuacRecordingExtension + ".gz", session.SessionId}
+	}
+	times := []time.Time{session.CreatedAt, session.UpdatedAt}
+	if session.ClosedAt != nil {
+		times = append(times, *session.ClosedAt)
+	}
+
+	var keys []string
+	for _, filename := range filenames {
+		for _, t := range times {
+			keys = append(keys, storage.GenerateKey(provider, filename, t))
+		}
+		keys = append(keys, filename)
+	}
+
+	for _, key := range lo.Uniq(keys) {
+		exists, err := provider.Exists(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+
+		reader, err := provider.Download(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		// The digest of a replay found here attests its content from now on, not since it was recorded
+		chain := storage.NewHashChain()
+		_, err = io.Copy(chain, reader)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		digest := chain.Sum()
+
+		return &storage.ReplayEntry{
+			SessionID:   session.SessionId,
+			Key:         key,
+			StorageName: name,
+			Size:        digest.Size,
+			Checksum:    digest.Checksum,
+			ChainHash:   digest.ChainHash,
+			Chunks:      digest.Chunks,
+			ChunkHashes: digest.ChunkHashes,
+		}, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/repository"
+	"github.com/veops/oneterm/pkg/config"
+	"github.com/veops/oneterm/pkg/logger"
+	"github.com/veops/oneterm/pkg/storage"
+)
+
+var (
+	signingKeyOnce sync.Once
+	signingKey     ed25519.PrivateKey
+	signingKeyId   string
+	// verifyKeys holds the public keys digests are verified with by key id, the current one and the retired ones
+	verifyKeys map[string]ed25519.PublicKey
+)
+
+// replayKeyId is the hex prefix of the hash of a public key
+func replayKeyId(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// replaySigningKey returns the server key signing file digests and its id
+func replaySigningKey() (ed25519.PrivateKey, string) {
+	signingKeyOnce.Do(func() {
+		seed, err := base64.StdEncoding.DecodeString(config.Cfg.Session.ReplaySigningKey)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			if config.Cfg.Session.ReplaySigningKey != "" {
+				logger.L().Error("Invalid replay signing key, deriving one from secret key", zap.Error(err))
+			}
+			sum := sha256.Sum256([]byte("oneterm-replay-signing:" + config.Cfg.SecretKey))
+			seed = sum[:]
+		}
+		signingKey = ed25519.NewKeyFromSeed(seed)
+		signingKeyId = replayKeyId(signingKey.Public().(ed25519.PublicKey))
+
+		verifyKeys = map[string]ed25519.PublicKey{signingKeyId: signingKey.Public().(ed25519.PublicKey)}
+		for _, encoded := range config.Cfg.Session.ReplayVerifyKeys {
+			key, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil || len(key) != ed25519.PublicKeySize {
+				logger.L().Error("Invalid replay verify key, ignoring it", zap.String("key", encoded), zap.Error(err))
+				continue
+			}
+			verifyKeys[replayKeyId(key)] = key
+		}
+	})
+	return signingKey, signingKeyId
+}
+
+// replayVerifyKey returns the public key of a key id, false when the key is not known
+func replayVerifyKey(keyId string) (ed25519.PublicKey, bool) {
+	replaySigningKey()
+	key, ok := verifyKeys[keyId]
+	return key, ok
+}
+
+// digestPayload is the statement signed for a stored file
+func digestPayload(metadata *model.FileMetadata) []byte {
+	return fmt.Appendf(nil, "oneterm-file-digest-v1\n%s\n%s\n%d\n%s\n%s\n%d",
+		metadata.StorageKey, metadata.SessionId, metadata.FileSize, metadata.Checksum, metadata.ChainHash, metadata.ChunkCount)
+}
+
+// applyDigest sets the digest of the stored bytes on metadata and signs it with the server key
+func applyDigest(metadata *model.FileMetadata, digest *storage.Digest) {
+	metadata.Checksum = digest.Checksum
+	metadata.ChainHash = digest.ChainHash
+	metadata.ChunkCount = digest.Chunks
+	metadata.ChunkHashes = digest.ChunkHashes
+
+	key, keyId := replaySigningKey()
+	metadata.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, digestPayload(metadata)))
+	metadata.SigningKeyId = keyId
+}
+
+// FileVerification reports whether a stored file still matches the digest recorded when it was written
+type FileVerification struct {
+	SessionId      string          `json:"session_id"`
+	StorageName    string          `json:"storage_name"`
+	StorageKey     string          `json:"storage_key"`
+	Recorded       *storage.Digest `json:"recorded"`
+	Actual         *storage.Digest `json:"actual"`
+	ContentValid   bool            `json:"content_valid"`
+	SignatureValid bool            `json:"signature_valid"`
+	SigningKeyId   string          `json:"signing_key_id"`
+	PublicKey      string          `json:"public_key"`    // base64 Ed25519 public key the signature is checked with
+	ChangedChunk   int             `json:"changed_chunk"` // first chunk that differs from the recorded one, -1 when none or unknown
+	Valid          bool            `json:"valid"`
+	Errors         []string        `json:"errors"`
+	VerifiedAt     time.Time       `json:"verified_at"`
+}
+
+// VerifySessionReplay reads back the stored recording of a session and checks it against its signed digest. A
+// replay that is not indexed returns an error wrapping gorm.ErrRecordNotFound, a tampered one a result that is not
+// valid, any other error means the check could not be done.
+func (s *SessionService) VerifySessionReplay(ctx context.Context, sessionId string) (*FileVerification, error) {
+	if DefaultStorageService == nil {
+		return nil, fmt.Errorf("storage service not initialized")
+	}
+
+	metadata, err := repository.NewStorageRepository().GetSessionFileMetadata(ctx, sessionId, model.FileCategoryReplay)
+	if err != nil {
+		return nil, fmt.Errorf("replay of session %s is not indexed: %w", sessionId, err)
+	}
+
+	return verifyFile(ctx, metadata)
+}
+
+func verifyFile(ctx context.Context, metadata *model.FileMetadata) (*FileVerification, error) {
+	result := &FileVerification{
+		SessionId:   metadata.SessionId,
+		StorageName: metadata.StorageName,
+		StorageKey:  metadata.StorageKey,
+		Recorded: &storage.Digest{
+			Size:        metadata.FileSize,
+			Checksum:    metadata.Checksum,
+			ChainHash:   metadata.ChainHash,
+			Chunks:      metadata.ChunkCount,
+			ChunkHashes: metadata.ChunkHashes,
+		},
+		ChangedChunk: -1,
+		SigningKeyId: metadata.SigningKeyId,
+		Errors:       []string{},
+		VerifiedAt:   time.Now(),
+	}
+
+	// Stored bytes that cannot be decrypted were changed, they are reported like a checksum mismatch
+	chain := storage.NewHashChain()
+	var reader io.ReadCloser
+	var err error
+	if metadata.StorageName == storage.LocalFallbackStorage {
+		reader, err = os.Open(filepath.Join(config.Cfg.Session.ReplayDir, filepath.FromSlash(metadata.StorageKey)))
+	} else {
+		reader, err = DefaultStorageService.DownloadFromStorage(ctx, metadata.StorageName, metadata.StorageKey)
+	}
+	if err == nil {
+		_, err = io.Copy(chain, reader)
+		reader.Close()
+	}
+	if err != nil && !errors.Is(err, storage.ErrCorrupt) {
+		return nil, err
+	}
+	result.Actual = chain.Sum()
+
+	switch {
+	case err != nil:
+		result.Errors = append(result.Errors, fmt.Sprintf("content cannot be read back: %v", err))
+	case metadata.Checksum == "":
+		result.Errors = append(result.Errors, "no digest was recorded for this file")
+	case result.Actual.Size != metadata.FileSize:
+		result.Errors = append(result.Errors, fmt.Sprintf("size changed from %d to %d bytes", metadata.FileSize, result.Actual.Size))
+	case result.Actual.Checksum != metadata.Checksum:
+		result.Errors = append(result.Errors, "content checksum does not match")
+	case metadata.ChainHash != "" && result.Actual.ChainHash != metadata.ChainHash:
+		result.Errors = append(result.Errors, "hash chain does not match")
+	default:
+		result.ContentValid = true
+	}
+
+	// The recorded chunk digests locate the change, they count once the chain they make is the signed one
+	if !result.ContentValid && len(metadata.ChunkHashes) > 0 {
+		if head, ok := storage.ChainHead(metadata.ChunkHashes); !ok || head != metadata.ChainHash {
+			result.Errors = append(result.Errors, "recorded chunk digests do not match the hash chain")
+		} else if i := storage.FirstChangedChunk(metadata.ChunkHashes, result.Actual.ChunkHashes); i >= 0 {
+			result.ChangedChunk = i
+			result.Errors = append(result.Errors, fmt.Sprintf("content differs from chunk %d on, at byte %d", i, int64(i)*storage.ChainChunkSize))
+		}
+	}
+
+	key, known := replayVerifyKey(metadata.SigningKeyId)
+	switch {
+	case metadata.Signature == "":
+		result.Errors = append(result.Errors, "digest is not signed")
+	case !known:
+		result.Errors = append(result.Errors, fmt.Sprintf("digest is signed with unknown key %s, add its public key to replayVerifyKeys", metadata.SigningKeyId))
+	default:
+		result.PublicKey = base64.StdEncoding.EncodeToString(key)
+		sig, err := base64.StdEncoding.DecodeString(metadata.Signature)
+		result.SignatureValid = err == nil && ed25519.Verify(key, digestPayload(metadata), sig)
+		if !result.SignatureValid {
+			result.Errors = append(result.Errors, "signature does not match the recorded digest")
+		}
+	}
+
+	result.Valid = result.ContentValid && result.SignatureValid
+	return result, nil
+}
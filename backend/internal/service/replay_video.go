@@ -0,0 +1,334 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/repository"
+	"github.com/veops/oneterm/pkg/config"
+	"github.com/veops/oneterm/pkg/logger"
+	"github.com/veops/oneterm/pkg/storage"
+)
+
+// ffmpeg arguments producing browser playable output per format
+var videoCodecArgs = map[string][]string{
+	model.VideoFormatMp4:  {"-c:v", "libx264", "-pix_fmt", "yuv420p", "-movflags", "+faststart"},
+	model.VideoFormatWebm: {"-c:v", "libvpx-vp9", "-b:v", "0", "-crf", "32"},
+}
+
+// ReplayVideoService converts guacd recordings to video files in background workers
+type ReplayVideoService struct {
+	repo        repository.ReplayVideoRepository
+	sessionRepo repository.SessionRepository
+	queue       chan int
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+// NewReplayVideoService creates a new replay video service
+func NewReplayVideoService() *ReplayVideoService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ReplayVideoService{
+		repo:        repository.NewReplayVideoRepository(),
+		sessionRepo: repository.NewSessionRepository(),
+		queue:       make(chan int, 1024),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Global replay video service instance
+var DefaultReplayVideoService *ReplayVideoService
+
+// InitReplayVideoService starts the conversion workers and requeues unfinished jobs
+func InitReplayVideoService() {
+	DefaultReplayVideoService = NewReplayVideoService()
+	DefaultReplayVideoService.Start()
+}
+
+// StopReplayVideoService stops the conversion workers
+func StopReplayVideoService() {
+	if DefaultReplayVideoService != nil {
+		DefaultReplayVideoService.Stop()
+	}
+}
+
+// Start starts the workers, jobs interrupted by a restart are converted again
+func (s *ReplayVideoService) Start() {
+	workers := max(config.Cfg.Guacenc.Workers, 1)
+	for i := 0; i < workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+
+	videos, err := s.repo.GetReplayVideosByStatus(s.ctx, model.VideoStatusPending, model.VideoStatusRunning)
+	if err != nil {
+		logger.L().Error("Failed to load unfinished replay video jobs", zap.Error(err))
+		return
+	}
+	for _, v := range videos {
+		s.enqueue(v.Id)
+	}
+
+	logger.L().Info("Replay video service started", zap.Int("workers", workers), zap.Int("requeued", len(videos)))
+}
+
+// Stop stops the workers, running conversions are killed and resumed on next start
+func (s *ReplayVideoService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+	logger.L().Info("Replay video service stopped")
+}
+
+// CreateReplayVideo queues the conversion of a session recording, an existing job for the same format is reused
+func (s *ReplayVideoService) CreateReplayVideo(ctx context.Context, sessionId, format string, uid int) (*model.ReplayVideo, error) {
+	if _, ok := videoCodecArgs[format]; !ok {
+		return nil, fmt.Errorf("unsupported video format %q", format)
+	}
+	// guacenc is not part of the image, jobs would only fail later
+	cfg := config.Cfg.Guacenc
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("video conversion is disabled, set guacenc.path to a guacenc binary")
+	}
+	for _, tool := range []string{cfg.Path, cfg.FfmpegPath} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return nil, fmt.Errorf("video conversion unavailable: %w", err)
+		}
+	}
+
+	session, err := s.sessionRepo.GetSession(ctx, sessionId)
+	if err != nil {
+		return nil, err
+	}
+	if !session.IsGuacd() {
+		return nil, fmt.Errorf("session %s is not a graphical session", sessionId)
+	}
+	if session.Status == model.SESSIONSTATUS_ONLINE {
+		return nil, fmt.Errorf("session %s is still online", sessionId)
+	}
+
+	videos, err := s.repo.GetReplayVideos(ctx, sessionId)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := lo.Find(videos, func(v *model.ReplayVideo) bool {
+		return v.Format == format && v.Status != model.VideoStatusFailed
+	}); ok {
+		return v, nil
+	}
+
+	video := &model.ReplayVideo{
+		SessionId: sessionId,
+		Format:    format,
+		Status:    model.VideoStatusPending,
+		CreatorId: uid,
+	}
+	if err = s.repo.CreateReplayVideo(ctx, video); err != nil {
+		return nil, err
+	}
+	s.enqueue(video.Id)
+
+	return video, nil
+}
+
+// GetReplayVideo gets a conversion job of a session
+func (s *ReplayVideoService) GetReplayVideo(ctx context.Context, sessionId string, id int) (*model.ReplayVideo, error) {
+	video, err := s.repo.GetReplayVideo(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if video.SessionId != sessionId {
+		return nil, fmt.Errorf("replay video %d does not belong to session %s", id, sessionId)
+	}
+	return video, nil
+}
+
+// GetReplayVideos lists the conversion jobs of a session
+func (s *ReplayVideoService) GetReplayVideos(ctx context.Context, sessionId string) ([]*model.ReplayVideo, error) {
+	return s.repo.GetReplayVideos(ctx, sessionId)
+}
+
+// OpenReplayVideo opens the converted video of a completed job
+func (s *ReplayVideoService) OpenReplayVideo(ctx context.Context, sessionId string, id int) (io.ReadCloser, *model.ReplayVideo, error) {
+	video, err := s.GetReplayVideo(ctx, sessionId, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if video.Status != model.VideoStatusCompleted {
+		return nil, video, fmt.Errorf("replay video %d is %s", id, video.Status)
+	}
+
+	reader, err := DefaultStorageService.DownloadFromStorage(ctx, video.StorageName, video.StorageKey)
+	if err != nil {
+		return nil, video, err
+	}
+	return reader, video, nil
+}
+
+func (s *ReplayVideoService) enqueue(id int) {
+	// Never block the caller, jobs left in the DB are picked up on the next start
+	select {
+	case s.queue <- id:
+	default:
+		logger.L().Warn("Replay video queue is full", zap.Int("id", id))
+	}
+}
+
+func (s *ReplayVideoService) work() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case id := <-s.queue:
+			s.process(id)
+		}
+	}
+}
+
+func (s *ReplayVideoService) process(id int) {
+	video, err := s.repo.GetReplayVideo(s.ctx, id)
+	if err != nil {
+		logger.L().Error("Failed to load replay video job", zap.Int("id", id), zap.Error(err))
+		return
+	}
+	if video.Status == model.VideoStatusCompleted {
+		return
+	}
+
+	video.Status = model.VideoStatusRunning
+	video.StartedAt = lo.ToPtr(time.Now())
+	video.ErrorMessage = ""
+	if err = s.repo.UpdateReplayVideo(s.ctx, video); err != nil {
+		logger.L().Error("Failed to update replay video job", zap.Int("id", id), zap.Error(err))
+		return
+	}
+
+	err = s.convert(video)
+	if s.ctx.Err() != nil {
+		// Shutting down, leave the job running so it is requeued on next start
+		return
+	}
+
+	video.CompletedAt = lo.ToPtr(time.Now())
+	video.Status = model.VideoStatusCompleted
+	if err != nil {
+		video.Status = model.VideoStatusFailed
+		video.ErrorMessage = err.Error()
+		logger.L().Error("Replay video conversion failed", zap.Int("id", id), zap.String("session_id", video.SessionId), zap.Error(err))
+	}
+	if err = s.repo.UpdateReplayVideo(context.Background(), video); err != nil {
+		logger.L().Error("Failed to update replay video job", zap.Int("id", id), zap.Error(err))
+	}
+}
+
+// convert renders the recording with guacenc, transcodes it with ffmpeg and stores the result
+func (s *ReplayVideoService) convert(video *model.ReplayVideo) error {
+	cfg := config.Cfg.Guacenc
+	ctx := s.ctx
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(cfg.Timeout)*time.Second)
+		defer cancel()
+	}
+
+	session, err := s.sessionRepo.GetSession(ctx, video.SessionId)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "oneterm-guacenc-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	recording := filepath.Join(dir, video.SessionId)
+	if err = s.fetchRecording(ctx, video.SessionId, recording); err != nil {
+		return err
+	}
+
+	// guacenc writes <input>.m4v next to the input
+	if err = runTool(ctx, cfg.Path, "-s", cfg.Size, "-r", fmt.Sprint(cfg.Bitrate), "-f", recording); err != nil {
+		return err
+	}
+
+	output := filepath.Join(dir, video.SessionId+"."+video.Format)
+	args := append([]string{"-y", "-loglevel", "error", "-i", recording + ".m4v"}, videoCodecArgs[video.Format]...)
+	if err = runTool(ctx, cfg.FfmpegPath, append(args, output)...); err != nil {
+		return err
+	}
+
+	f, err := os.Open(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	metadata := &model.FileMetadata{
+		FileName:  filepath.Base(output),
+		MimeType:  model.VideoMimeType(video.Format),
+		Category:  model.FileCategoryReplayVideo,
+		SessionId: session.SessionId,
+		AssetId:   session.AssetId,
+		UserId:    session.Uid,
+	}
+	if err = DefaultStorageService.SaveSessionFile(ctx, session, f, info.Size(), metadata); err != nil {
+		return err
+	}
+
+	video.StorageName = metadata.StorageName
+	video.StorageKey = metadata.StorageKey
+	video.FileSize = metadata.FileSize
+
+	return nil
+}
+
+// fetchRecording copies the raw recording of a session to path, decompressing it if needed
+func (s *ReplayVideoService) fetchRecording(ctx context.Context, sessionId, path string) error {
+	reader, metadata, err := NewSessionService().GetSessionReplay(ctx, sessionId)
+	if err != nil {
+		return err
+	}
+	src, err := storage.Decompress(metadata.Encoding, reader)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, src)
+	return err
+}
+
+func runTool(ctx context.Context, name string, args ...string) error {
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", filepath.Base(name), err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
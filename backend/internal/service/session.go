@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -33,6 +34,40 @@ func NewSessionService() *SessionService {
 	}
 }
 
+// SetLegalHold places a session on legal hold, exempting its artifacts from retention cleanup, or releases it
+func (s *SessionService) SetLegalHold(ctx context.Context, sessionId string, hold bool, uid int) (*model.Session, error) {
+	session, err := s.repo.GetSession(ctx, sessionId)
+	if err != nil {
+		return nil, err
+	}
+	if session.LegalHold == hold {
+		return session, nil
+	}
+
+	if err = s.repo.SetLegalHold(ctx, sessionId, hold); err != nil {
+		return nil, err
+	}
+	session.LegalHold = hold
+
+	history := &model.History{
+		Type:       session.TableName(),
+		TargetId:   session.Id,
+		ActionType: model.ACTION_UPDATE,
+		Old:        model.Map[string, any]{"session_id": sessionId, "legal_hold": !hold},
+		New:        model.Map[string, any]{"session_id": sessionId, "legal_hold": hold},
+		CreatorId:  uid,
+		CreatedAt:  time.Now(),
+	}
+	if ginCtx, ok := ctx.(*gin.Context); ok {
+		history.RemoteIp = ginCtx.ClientIP()
+	}
+	if err = NewHistoryService().CreateHistory(ctx, history); err != nil {
+		logger.L().Warn("Failed to record legal hold change", zap.String("session_id", sessionId), zap.Error(err))
+	}
+
+	return session, nil
+}
+
 // GetOnlineSessionByID retrieves an online session by ID
 func (s *SessionService) GetOnlineSessionByID(ctx context.Context, sessionID string) (*gsession.Session, error) {
 	return s.repo.GetOnlineSessionByID(ctx, sessionID)
@@ -84,6 +119,16 @@ func (s *SessionService) CreateSessionCmd(ctx context.Context, cmd *model.Sessio
 	return s.repo.CreateSessionCmd(ctx, cmd)
 }
 
+// CreateSessionClipboard records a clipboard transfer of a session
+func (s *SessionService) CreateSessionClipboard(ctx context.Context, clipboard *model.SessionClipboard) error {
+	return s.repo.CreateSessionClipboard(ctx, clipboard)
+}
+
+// CreateSessionWebRequest records a request proxied in a web session
+func (s *SessionService) CreateSessionWebRequest(ctx context.Context, req *model.SessionWebRequest) error {
+	return s.repo.CreateSessionWebRequest(ctx, req)
+}
+
 // BuildQuery constructs a query for sessions
 func (s *SessionService) BuildQuery(ctx *gin.Context) (*gorm.DB, error) {
 	currentUser, _ := acl.GetSessionFromCtx(ctx)
@@ -97,6 +142,31 @@ func (s *SessionService) BuildCmdQuery(ctx *gin.Context, sessionId string) *gorm
 	return s.repo.BuildCmdQuery(ctx, sessionId)
 }
 
+// BuildClipboardQuery constructs a query for the clipboard transfers of a session
+func (s *SessionService) BuildClipboardQuery(ctx *gin.Context, sessionId string) *gorm.DB {
+	return s.repo.BuildClipboardQuery(ctx, sessionId)
+}
+
+// BuildWebRequestQuery constructs a query for the requests of a web session
+func (s *SessionService) BuildWebRequestQuery(ctx *gin.Context, sessionId string) *gorm.DB {
+	return s.repo.BuildWebRequestQuery(ctx, sessionId)
+}
+
+// BuildCmdSearchQuery constructs a query for commands across sessions
+func (s *SessionService) BuildCmdSearchQuery(ctx *gin.Context) (*gorm.DB, error) {
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	isAdmin := acl.IsAdmin(currentUser)
+
+	return s.repo.BuildCmdSearchQuery(ctx, isAdmin, currentUser.GetUid())
+}
+
+// AttachReplayOffsets sets the replay position of each hit relative to its session start
+func (s *SessionService) AttachReplayOffsets(hits []*model.SessionCmdHit) {
+	for _, hit := range hits {
+		hit.ReplayOffset = hit.ReplayPosition(hit.SessionCreatedAt)
+	}
+}
+
 // GetSessionOptionAssets retrieves session option assets
 func (s *SessionService) GetSessionOptionAssets(ctx context.Context) ([]*model.SessionOptionAsset, error) {
 	return s.repo.GetSessionOptionAssets(ctx)
@@ -144,7 +214,79 @@ func (s *SessionService) GetSessionReplayFilename(ctx context.Context, sessionId
 	return filename, nil
 }
 
-// GetSessionReplay gets session replay file reader
-func (s *SessionService) GetSessionReplay(ctx context.Context, sessionId string) (io.ReadCloser, error) {
-	return gsession.GetReplay(sessionId)
+// GetReplayTimeline lists the commands of a session with their position in the recording
+func (s *SessionService) GetReplayTimeline(ctx context.Context, sessionId string) (*model.ReplayTimeline, error) {
+	session, err := s.repo.GetSession(ctx, sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	cmds, err := s.repo.GetSessionCmds(ctx, sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	timeline := &model.ReplayTimeline{
+		SessionId: sessionId,
+		Protocol:  session.Protocol,
+		Items: lo.Map(cmds, func(c *model.SessionCmd, _ int) *model.TimelineCommand {
+			return &model.TimelineCommand{
+				Id:     c.Id,
+				Cmd:    c.Cmd,
+				Level:  c.Level,
+				Offset: c.ReplayPosition(session.CreatedAt),
+			}
+		}),
+	}
+	sort.SliceStable(timeline.Items, func(i, j int) bool { return timeline.Items[i].Offset < timeline.Items[j].Offset })
+
+	return timeline, nil
+}
+
+// GetWebRequestTimeline lists the requests of a web session in the order they were made
+func (s *SessionService) GetWebRequestTimeline(ctx context.Context, sessionId string) (*model.WebRequestTimeline, error) {
+	session, err := s.repo.GetSession(ctx, sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	reqs, err := s.repo.GetSessionWebRequests(ctx, sessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.WebRequestTimeline{
+		SessionId: sessionId,
+		AssetInfo: session.AssetInfo,
+		StartedAt: session.CreatedAt,
+		Items:     reqs,
+	}, nil
+}
+
+// GetSessionReplay gets session replay file reader together with the metadata describing its content
+func (s *SessionService) GetSessionReplay(ctx context.Context, sessionId string) (io.ReadCloser, *model.FileMetadata, error) {
+	// Indexed recordings first, they know their provider, content type and encoding
+	if DefaultStorageService != nil {
+		if reader, metadata, err := DefaultStorageService.GetIndexedSessionReplay(ctx, sessionId); err == nil {
+			return reader, metadata, nil
+		}
+	}
+
+	reader, err := gsession.GetReplay(sessionId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadata := &model.FileMetadata{
+		FileName:  sessionId + ".cast",
+		MimeType:  model.MimeTypeAsciicast,
+		Category:  model.FileCategoryReplay,
+		SessionId: sessionId,
+	}
+	if session, err := s.repo.GetSession(ctx, sessionId); err == nil && session.IsGuacd() {
+		metadata.FileName = sessionId
+		metadata.MimeType = model.MimeTypeGuacRecording
+	}
+
+	return reader, metadata, nil
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -12,6 +14,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
 	"github.com/veops/oneterm/internal/model"
 	"github.com/veops/oneterm/internal/repository"
 	"github.com/veops/oneterm/pkg/config"
@@ -49,6 +52,15 @@ type StorageService interface {
 	GetSessionReplay(ctx context.Context, sessionId string) (io.ReadCloser, error)
 	DeleteSessionReplay(ctx context.Context, sessionId string) error
 
+	// SaveGuacdRecording uploads the finished recording guacd wrote for a session and indexes it
+	SaveGuacdRecording(ctx context.Context, session *model.Session) error
+	// GetIndexedSessionReplay opens a session recording through its FileMetadata index entry
+	GetIndexedSessionReplay(ctx context.Context, sessionId string) (io.ReadCloser, *model.FileMetadata, error)
+	// SaveSessionFile stores a file belonging to a session under the session date, metadata.FileName names the object
+	SaveSessionFile(ctx context.Context, session *model.Session, reader io.Reader, size int64, metadata *model.FileMetadata) error
+	// DownloadFromStorage reads an object from the named storage, falling back to the available provider
+	DownloadFromStorage(ctx context.Context, storageName, key string) (io.ReadCloser, error)
+
 	SaveRDPFile(ctx context.Context, assetId int, remotePath string, reader io.Reader, size int64) error
 	GetRDPFile(ctx context.Context, assetId int, remotePath string) (io.ReadCloser, error)
 	DeleteRDPFile(ctx context.Context, assetId int, remotePath string) error
@@ -77,6 +89,7 @@ type StorageService interface {
 type storageService struct {
 	BaseService
 	storageRepo repository.StorageRepository
+	replicaRepo repository.StorageReplicationRepository
 	providers   map[string]storage.Provider
 	primary     string
 }
@@ -86,6 +99,7 @@ func NewStorageService() StorageService {
 	return &storageService{
 		BaseService: NewBaseService(),
 		storageRepo: repository.NewStorageRepository(),
+		replicaRepo: repository.NewStorageReplicationRepository(),
 		providers:   make(map[string]storage.Provider),
 	}
 }
@@ -186,13 +200,19 @@ func (s *storageService) DeleteStorageConfig(ctx context.Context, name string) e
 // File Operations combining storage provider and database metadata
 
 func (s *storageService) UploadFile(ctx context.Context, key string, reader io.Reader, size int64, metadata *model.FileMetadata) error {
-	provider, err := s.GetAvailableProvider(ctx)
+	name, provider, err := s.availableProvider(ctx)
 	if err != nil {
 		return fmt.Errorf("no available storage provider: %w", err)
 	}
 
+	return s.uploadTo(ctx, name, provider, key, reader, size, metadata)
+}
+
+// uploadTo uploads to the given provider and records metadata for it
+func (s *storageService) uploadTo(ctx context.Context, name string, provider storage.Provider, key string, reader io.Reader, size int64, metadata *model.FileMetadata) error {
 	// Upload to storage backend
-	if err := provider.Upload(ctx, key, reader, size); err != nil {
+	chain := storage.NewHashChain()
+	if err := provider.Upload(ctx, key, io.TeeReader(reader, chain), size); err != nil {
 		return fmt.Errorf("failed to upload file: %w", err)
 	}
 
@@ -201,11 +221,16 @@ func (s *storageService) UploadFile(ctx context.Context, key string, reader io.R
 		metadata.StorageKey = key
 		metadata.FileSize = size
 		metadata.StorageType = model.StorageType(provider.Type())
+		metadata.StorageName = name
+		metadata.EncryptionKeyId = encryptionKeyId(provider)
+		applyDigest(metadata, chain.Sum())
 
-		if err := s.storageRepo.CreateFileMetadata(ctx, metadata); err != nil {
+		if err := s.storageRepo.UpsertFileMetadata(ctx, metadata); err != nil {
 			logger.L().Warn("Failed to save file metadata",
 				zap.String("key", key),
 				zap.Error(err))
+		} else {
+			replicateFile(ctx, metadata)
 		}
 	}
 
@@ -272,28 +297,266 @@ func (s *storageService) ListFiles(ctx context.Context, prefix string, limit, of
 // Business-specific operations
 
 func (s *storageService) SaveSessionReplay(ctx context.Context, sessionId string, reader io.Reader, size int64) error {
-	key := fmt.Sprintf("%s.cast", sessionId)
+	session := &model.Session{SessionId: sessionId, CreatedAt: time.Now()}
+	if sess, err := repository.NewSessionRepository().GetSession(ctx, sessionId); err == nil {
+		session = sess
+	}
 
 	metadata := &model.FileMetadata{
 		FileName:  fmt.Sprintf("%s.cast", sessionId),
-		Category:  "replay",
+		Category:  model.FileCategoryReplay,
 		SessionId: sessionId,
-		MimeType:  "application/octet-stream",
+		AssetId:   session.AssetId,
+		UserId:    session.Uid,
+		MimeType:  model.MimeTypeAsciicast,
 	}
 
 	logger.L().Info("SaveReplay called", zap.String("session_id", sessionId))
-	return s.UploadFile(ctx, key, reader, size, metadata)
+	return s.SaveSessionFile(ctx, session, reader, size, metadata)
 }
 
+// GetSessionReplay opens the recording of a session, decompressed if it is stored compressed
 func (s *storageService) GetSessionReplay(ctx context.Context, sessionId string) (io.ReadCloser, error) {
-	key := fmt.Sprintf("%s.cast", sessionId)
-	reader, _, err := s.DownloadFile(ctx, key)
-	return reader, err
+	reader, metadata, err := s.GetIndexedSessionReplay(ctx, sessionId)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Decompress(metadata.Encoding, reader)
 }
 
 func (s *storageService) DeleteSessionReplay(ctx context.Context, sessionId string) error {
-	key := fmt.Sprintf("%s.cast", sessionId)
-	return s.DeleteFile(ctx, key)
+	entry, provider, err := s.LookupReplay(ctx, sessionId)
+	if err != nil {
+		return err
+	}
+
+	if err := provider.Delete(ctx, entry.Key); err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	return s.ForgetReplay(ctx, entry)
+}
+
+// Replay index on top of FileMetadata, used by the session replay adapter
+
+func (s *storageService) RecordReplay(ctx context.Context, entry *storage.ReplayEntry) error {
+	metadata := &model.FileMetadata{
+		StorageKey:  entry.Key,
+		FileName:    path.Base(entry.Key),
+		FileSize:    entry.Size,
+		MimeType:    replayMimeType(entry.Key),
+		StorageName: entry.StorageName,
+		Category:    model.FileCategoryReplay,
+		SessionId:   entry.SessionID,
+	}
+	applyDigest(metadata, &storage.Digest{Size: entry.Size, Checksum: entry.Checksum, ChainHash: entry.ChainHash, Chunks: entry.Chunks, ChunkHashes: entry.ChunkHashes})
+	metadata.Encoding = lo.CoalesceOrEmpty(entry.Encoding, storage.EncodingFromKey(entry.Key))
+	if provider, ok := s.providers[entry.StorageName]; ok {
+		metadata.StorageType = model.StorageType(provider.Type())
+		metadata.EncryptionKeyId = encryptionKeyId(provider)
+	} else if entry.StorageName == storage.LocalFallbackStorage {
+		metadata.StorageType = model.StorageTypeLocal
+	}
+	if session, err := repository.NewSessionRepository().GetSession(ctx, entry.SessionID); err == nil {
+		metadata.AssetId = session.AssetId
+		metadata.UserId = session.Uid
+	}
+
+	if err := s.storageRepo.UpsertFileMetadata(ctx, metadata); err != nil {
+		return err
+	}
+	replicateFile(ctx, metadata)
+
+	return nil
+}
+
+func (s *storageService) LookupReplay(ctx context.Context, sessionId string) (*storage.ReplayEntry, storage.Provider, error) {
+	metadata, err := s.storageRepo.GetSessionFileMetadata(ctx, sessionId, model.FileCategoryReplay)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider, ok := s.providers[metadata.StorageName]
+	if !ok {
+		// Read a mirrored copy while the storage the replay was written to is gone
+		replicas, _ := s.replicaRepo.GetCompletedReplicas(ctx, metadata.StorageKey)
+		replica, found := lo.Find(replicas, func(r *model.FileReplica) bool { return s.providers[r.TargetStorage] != nil })
+		if !found {
+			return nil, nil, fmt.Errorf("storage %s of replay %s is not available", metadata.StorageName, sessionId)
+		}
+		metadata.StorageName, provider = replica.TargetStorage, s.providers[replica.TargetStorage]
+	}
+
+	return &storage.ReplayEntry{
+		SessionID:   sessionId,
+		Key:         metadata.StorageKey,
+		StorageName: metadata.StorageName,
+		Size:        metadata.FileSize,
+		Checksum:    metadata.Checksum,
+		Encoding:    metadata.Encoding,
+	}, provider, nil
+}
+
+func (s *storageService) ForgetReplay(ctx context.Context, entry *storage.ReplayEntry) error {
+	return s.storageRepo.DeleteFileMetadata(ctx, entry.Key)
+}
+
+// replayMimeType tells asciicast recordings from guacd ones by their key
+func replayMimeType(key string) string {
+	if strings.HasSuffix(storage.TrimCompressedExtension(key), ".cast") {
+		return model.MimeTypeAsciicast
+	}
+	return model.MimeTypeGuacRecording
+}
+
+// initReplayAdapter points the session replay adapter at the primary provider and indexes its writes
+func initReplayAdapter(s *storageService, provider storage.Provider) {
+	storage.InitializeAdapter(provider)
+	storage.DefaultSessionReplayAdapter.SetIndex(s.primary, s)
+	if err := storage.DefaultSessionReplayAdapter.SetCompression(config.Cfg.Session.ReplayCompression); err != nil {
+		logger.L().Error("Replays are saved uncompressed", zap.Error(err))
+	}
+}
+
+func (s *storageService) SaveGuacdRecording(ctx context.Context, session *model.Session) error {
+	dir := lo.CoalesceOrEmpty(config.Cfg.Session.GuacdRecordingDir, config.Cfg.Session.ReplayDir)
+	// guacd names recordings after the session id, see guacd recording-name
+	rawPath := filepath.Join(dir, session.SessionId)
+
+	f, err := os.Open(rawPath)
+	if err != nil {
+		return fmt.Errorf("open guacd recording: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	metadata := &model.FileMetadata{
+		FileName:  session.SessionId + model.GuacRecordingExtension,
+		MimeType:  model.MimeTypeGuacRecording,
+		Category:  model.FileCategoryReplay,
+		SessionId: session.SessionId,
+		AssetId:   session.AssetId,
+		UserId:    session.Uid,
+	}
+
+	var (
+		reader io.Reader = f
+		size             = info.Size()
+	)
+	if config.Cfg.Session.CompressGuacdRecording {
+		// Spooled to a temporary file and streamed from there, recordings can be far larger than memory
+		compressed, compressedSize, err := storage.CompressToTemp(storage.EncodingGzip, f)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			compressed.Close()
+			os.Remove(compressed.Name())
+		}()
+		reader, size = compressed, compressedSize
+		metadata.FileName += storage.CompressedExtension(storage.EncodingGzip)
+		metadata.Encoding = model.ContentEncodingGzip
+	}
+
+	if err = s.SaveSessionFile(ctx, session, reader, size, metadata); err != nil {
+		return err
+	}
+
+	// Same file when the local provider shares the recording directory and keeps the raw name. A recording that
+	// changed while it was stored is kept, the stored copy may be missing its end.
+	if filepath.Clean(rawPath) != filepath.Clean(filepath.Join(dir, metadata.StorageKey)) {
+		f.Close()
+		if after, err := os.Stat(rawPath); err != nil || after.Size() != info.Size() || !after.ModTime().Equal(info.ModTime()) {
+			logger.L().Error("Guacd recording changed while stored, raw file kept",
+				zap.String("session_id", session.SessionId), zap.String("path", rawPath), zap.Error(err))
+		} else if err := os.Remove(rawPath); err != nil {
+			logger.L().Warn("Failed to remove ingested guacd recording", zap.String("path", rawPath), zap.Error(err))
+		}
+	}
+
+	logger.L().Info("Guacd recording saved to storage",
+		zap.String("session_id", session.SessionId),
+		zap.String("storage", metadata.StorageName),
+		zap.String("key", metadata.StorageKey),
+		zap.Int64("size", size))
+
+	return nil
+}
+
+func (s *storageService) SaveSessionFile(ctx context.Context, session *model.Session, reader io.Reader, size int64, metadata *model.FileMetadata) error {
+	name, provider, err := s.availableProvider(ctx)
+	if err != nil {
+		return fmt.Errorf("no available storage provider: %w", err)
+	}
+
+	key := storage.GenerateKey(provider, metadata.FileName, session.CreatedAt)
+	return s.uploadTo(ctx, name, provider, key, reader, size, metadata)
+}
+
+func (s *storageService) DownloadFromStorage(ctx context.Context, storageName, key string) (io.ReadCloser, error) {
+	// The storage asked for, where the index says the file is now after a migration, then its mirrors
+	names := []string{storageName}
+	if metadata, err := s.storageRepo.GetFileMetadata(ctx, key); err == nil {
+		names = append(names, metadata.StorageName)
+	}
+	if replicas, err := s.replicaRepo.GetCompletedReplicas(ctx, key); err == nil {
+		names = append(names, lo.Map(replicas, func(r *model.FileReplica, _ int) string { return r.TargetStorage })...)
+	}
+
+	var lastErr error
+	for _, name := range lo.Uniq(names) {
+		provider, ok := s.providers[name]
+		if !ok {
+			continue
+		}
+		reader, err := provider.Download(ctx, key)
+		if err == nil {
+			return reader, nil
+		}
+		lastErr = err
+	}
+
+	if lastErr == nil {
+		provider, err := s.GetAvailableProvider(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("no available storage provider: %w", err)
+		}
+		reader, err := provider.Download(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download file: %w", err)
+		}
+		return reader, nil
+	}
+
+	return nil, fmt.Errorf("failed to download file: %w", lastErr)
+}
+
+// getProvider returns the provider of a configured storage
+func (s *storageService) getProvider(name string) (storage.Provider, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("storage %s is not available", name)
+	}
+	return provider, nil
+}
+
+func (s *storageService) GetIndexedSessionReplay(ctx context.Context, sessionId string) (io.ReadCloser, *model.FileMetadata, error) {
+	metadata, err := s.storageRepo.GetSessionFileMetadata(ctx, sessionId, model.FileCategoryReplay)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Read from the provider the file was written to
+	reader, err := s.DownloadFromStorage(ctx, metadata.StorageName, metadata.StorageKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return reader, metadata, nil
 }
 
 func (s *storageService) SaveRDPFile(ctx context.Context, assetId int, remotePath string, reader io.Reader, size int64) error {
@@ -393,10 +656,36 @@ func (s *storageService) validateConfig(config *model.StorageConfig) error {
 		return fmt.Errorf("storage type is required")
 	}
 
+	for key, target := range config.Config {
+		if strings.HasPrefix(key, "mirror.") && target == config.Name {
+			return fmt.Errorf("storage %s cannot mirror to itself", config.Name)
+		}
+	}
+
+	if encryptionEnabled(config) {
+		if _, err := storageKeyring(); err != nil {
+			return fmt.Errorf("storage encryption: %w", err)
+		}
+	}
+
 	return nil
 }
 
+// CreateProvider creates the provider of a storage config, wrapped with envelope encryption when it is enabled
 func (s *storageService) CreateProvider(config *model.StorageConfig) (storage.Provider, error) {
+	provider, err := newProvider(config)
+	if err != nil || !encryptionEnabled(config) {
+		return provider, err
+	}
+
+	keyring, err := storageKeyring()
+	if err != nil {
+		return nil, fmt.Errorf("storage %s has encryption enabled: %w", config.Name, err)
+	}
+	return storage.NewEncryptedProvider(provider, keyring, encryptionRequired(config)), nil
+}
+
+func newProvider(config *model.StorageConfig) (storage.Provider, error) {
 	switch config.Type {
 	case model.StorageTypeLocal:
 		localConfig := providers.LocalConfig{
@@ -489,11 +778,17 @@ func (s *storageService) CreateProvider(config *model.StorageConfig) (storage.Pr
 // GetAvailableProvider returns an available storage provider with fallback logic
 // Priority: Primary storage first, then by priority (lower number = higher priority)
 func (s *storageService) GetAvailableProvider(ctx context.Context) (storage.Provider, error) {
+	_, provider, err := s.availableProvider(ctx)
+	return provider, err
+}
+
+// availableProvider is GetAvailableProvider also returning the storage config name of the provider
+func (s *storageService) availableProvider(ctx context.Context) (string, storage.Provider, error) {
 	// 1. Try primary storage first
 	if s.primary != "" {
 		if provider, exists := s.providers[s.primary]; exists {
 			if healthErr := provider.HealthCheck(ctx); healthErr == nil {
-				return provider, nil
+				return s.primary, provider, nil
 			} else {
 				logger.L().Warn("Primary storage provider health check failed, trying fallback",
 					zap.String("primary", s.primary),
@@ -505,7 +800,7 @@ func (s *storageService) GetAvailableProvider(ctx context.Context) (storage.Prov
 	// 2. Get all enabled storage configs sorted by priority
 	configs, err := s.GetStorageConfigs(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get storage configs: %w", err)
+		return "", nil, fmt.Errorf("failed to get storage configs: %w", err)
 	}
 
 	// Filter enabled configs and sort by priority (lower number = higher priority)
@@ -528,7 +823,7 @@ func (s *storageService) GetAvailableProvider(ctx context.Context) (storage.Prov
 				logger.L().Info("Using fallback storage provider",
 					zap.String("name", config.Name),
 					zap.Int("priority", config.Priority))
-				return provider, nil
+				return config.Name, provider, nil
 			} else {
 				logger.L().Warn("Storage provider health check failed",
 					zap.String("name", config.Name),
@@ -537,7 +832,7 @@ func (s *storageService) GetAvailableProvider(ctx context.Context) (storage.Prov
 		}
 	}
 
-	return nil, fmt.Errorf("no available storage provider found")
+	return "", nil, fmt.Errorf("no available storage provider found")
 }
 
 // Global storage service instance
@@ -584,7 +879,7 @@ func InitStorageService() {
 		logger.L().Error("Failed to get primary provider for session replay adapter", zap.Error(err))
 		return
 	}
-	storage.InitializeAdapter(provider)
+	initReplayAdapter(storageImpl, provider)
 
 	logger.L().Info("Storage service initialization completed",
 		zap.Int("total_configs", len(configs)),
@@ -841,7 +1136,7 @@ func (s *storageService) RefreshProviders(ctx context.Context) error {
 	successCount := initializeStorageProviders(ctx, s, configs)
 
 	if provider, err := s.GetPrimaryProvider(); err == nil {
-		storage.InitializeAdapter(provider)
+		initReplayAdapter(s, provider)
 		logger.L().Info("Session replay adapter re-initialized with new primary provider",
 			zap.String("provider_type", provider.Type()))
 	} else {
@@ -910,6 +1205,12 @@ func (s *storageService) RefreshStorageMetrics(ctx context.Context) error {
 			continue
 		}
 
+		// Keep one row per storage
+		if existing, err := s.storageRepo.GetStorageMetricsByName(ctx, config.Name); err == nil {
+			metric.Id = existing.Id
+			metric.CreatedAt = existing.CreatedAt
+		}
+
 		// Upsert metrics
 		if err := s.storageRepo.UpsertStorageMetrics(ctx, metric); err != nil {
 			logger.L().Warn("Failed to save storage metrics",
@@ -939,9 +1240,18 @@ func (s *storageService) CalculateStorageMetrics(ctx context.Context, storageNam
 		metric.ErrorMessage = "Provider not initialized"
 	}
 
-	// Calculate file counts and sizes efficiently using database aggregation
-	// Use storage_name field from file_metadata table
-	if err := s.calculateFileStats(ctx, storageName, metric); err != nil {
+	// Count what is actually stored, falling back to the file metadata index if the provider can't be listed
+	provider, exists := s.providers[storageName]
+	if !exists || !metric.IsHealthy {
+		if err := s.calculateFileStats(ctx, storageName, metric); err != nil {
+			logger.L().Warn("Failed to calculate file stats",
+				zap.String("storage", storageName),
+				zap.Error(err))
+		}
+		return metric, nil
+	}
+
+	if err := s.calculateProviderStats(ctx, provider, metric); err != nil {
 		logger.L().Warn("Failed to calculate file stats",
 			zap.String("storage", storageName),
 			zap.Error(err))
@@ -951,6 +1261,35 @@ func (s *storageService) CalculateStorageMetrics(ctx context.Context, storageNam
 	return metric, nil
 }
 
+// calculateProviderStats counts files and sizes by listing the provider
+func (s *storageService) calculateProviderStats(ctx context.Context, provider storage.Provider, metric *model.StorageMetrics) error {
+	var stats model.StorageMetrics
+	err := storage.Walk(ctx, provider, "", func(f storage.FileInfo) error {
+		stats.FileCount++
+		stats.TotalSize += f.Size
+
+		name := storage.TrimCompressedExtension(path.Base(f.Key))
+		switch {
+		case strings.HasPrefix(f.Key, "rdp_files/"):
+			stats.RdpFileCount++
+			stats.RdpFileSize += f.Size
+		case strings.HasSuffix(name, ".cast"), strings.HasSuffix(name, model.GuacRecordingExtension):
+			stats.ReplayCount++
+			stats.ReplaySize += f.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list files: %w", err)
+	}
+
+	metric.FileCount, metric.TotalSize = stats.FileCount, stats.TotalSize
+	metric.ReplayCount, metric.ReplaySize = stats.ReplayCount, stats.ReplaySize
+	metric.RdpFileCount, metric.RdpFileSize = stats.RdpFileCount, stats.RdpFileSize
+
+	return nil
+}
+
 // Helper method to calculate file statistics efficiently
 func (s *storageService) calculateFileStats(ctx context.Context, storageName string, metric *model.StorageMetrics) error {
 
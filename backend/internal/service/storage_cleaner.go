@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/repository"
 	"github.com/veops/oneterm/pkg/logger"
 	"github.com/veops/oneterm/pkg/storage"
 	"go.uber.org/zap"
@@ -16,6 +18,11 @@ import (
 // StorageCleanerService handles storage cleanup and archival tasks
 type StorageCleanerService struct {
 	storageService StorageService
+	storageRepo    repository.StorageRepository
+	sessionRepo    repository.SessionRepository
+	replicaRepo    repository.StorageReplicationRepository
+	exportRepo     repository.AuditExportRepository
+	historyService *HistoryService
 	ticker         *time.Ticker
 	stopChan       chan struct{}
 }
@@ -24,6 +31,11 @@ type StorageCleanerService struct {
 func NewStorageCleanerService(storageService StorageService) *StorageCleanerService {
 	return &StorageCleanerService{
 		storageService: storageService,
+		storageRepo:    repository.NewStorageRepository(),
+		sessionRepo:    repository.NewSessionRepository(),
+		replicaRepo:    repository.NewStorageReplicationRepository(),
+		exportRepo:     repository.NewAuditExportRepository(),
+		historyService: NewHistoryService(),
 		stopChan:       make(chan struct{}),
 	}
 }
@@ -100,48 +112,28 @@ func (s *StorageCleanerService) runCleanup() {
 
 // cleanupStorage performs cleanup for a specific storage provider
 func (s *StorageCleanerService) cleanupStorage(config *model.StorageConfig, provider storage.Provider) {
-	// Only handle local storage for now
-	if config.Type != model.StorageTypeLocal {
-		return
-	}
-
+	policy := ParseRetentionPolicy(config)
 	basePath := config.Config["base_path"]
-	if basePath == "" {
-		return
-	}
-
-	// Parse retention config
-	retentionDays := 30 // default
-	archiveDays := 7    // default
-	cleanupEnabled := true
-	archiveEnabled := true
-
-	if val, exists := config.Config["retention_days"]; exists {
-		if days, err := parseIntConfig(val); err == nil {
-			retentionDays = days
-		}
-	}
-	if val, exists := config.Config["archive_days"]; exists {
-		if days, err := parseIntConfig(val); err == nil {
-			archiveDays = days
-		}
-	}
-	if val, exists := config.Config["cleanup_enabled"]; exists {
-		cleanupEnabled = val == "true"
-	}
-	if val, exists := config.Config["archive_enabled"]; exists {
-		archiveEnabled = val == "true"
-	}
 
 	logger.L().Info("Processing storage cleanup",
 		zap.String("storage", config.Name),
-		zap.String("base_path", basePath),
-		zap.Int("retention_days", retentionDays),
-		zap.Int("archive_days", archiveDays),
-		zap.Bool("cleanup_enabled", cleanupEnabled),
-		zap.Bool("archive_enabled", archiveEnabled))
+		zap.String("type", string(config.Type)),
+		zap.Int("retention_days", policy.RetentionDays),
+		zap.Any("category_retention_days", policy.Categories),
+		zap.Int("archive_days", policy.ArchiveDays),
+		zap.Bool("cleanup_enabled", policy.CleanupEnabled),
+		zap.Bool("archive_enabled", policy.ArchiveEnabled))
+
+	// Delete files older than the retention of their category, on every backend
+	if policy.CleanupEnabled {
+		s.applyRetention(context.Background(), config, provider)
+	}
+
+	// Archival moves date directories aside, only meaningful on a filesystem
+	if config.Type != model.StorageTypeLocal || basePath == "" {
+		return
+	}
 
-	// Get all date directories
 	entries, err := os.ReadDir(basePath)
 	if err != nil {
 		logger.L().Error("Failed to read base directory",
@@ -149,10 +141,7 @@ func (s *StorageCleanerService) cleanupStorage(config *model.StorageConfig, prov
 		return
 	}
 
-	now := time.Now()
-	retentionCutoff := now.AddDate(0, 0, -retentionDays)
-	archiveCutoff := now.AddDate(0, 0, -archiveDays)
-
+	archiveCutoff := time.Now().AddDate(0, 0, -policy.ArchiveDays)
 	for _, entry := range entries {
 		if !entry.IsDir() {
 			continue
@@ -171,29 +160,52 @@ func (s *StorageCleanerService) cleanupStorage(config *model.StorageConfig, prov
 
 		dirPath := filepath.Join(basePath, dirName)
 
-		// Delete directories older than retention period
-		if cleanupEnabled && dirDate.Before(retentionCutoff) {
-			logger.L().Info("Deleting expired directory",
-				zap.String("path", dirPath),
-				zap.Time("date", dirDate))
-
-			if err := os.RemoveAll(dirPath); err != nil {
-				logger.L().Error("Failed to delete directory",
-					zap.String("path", dirPath), zap.Error(err))
-			} else {
-				logger.L().Info("Successfully deleted expired directory",
-					zap.String("path", dirPath))
-			}
+		// Remove directories emptied by the cleanup above
+		if files, err := os.ReadDir(dirPath); err == nil && len(files) == 0 {
+			os.Remove(dirPath)
 			continue
 		}
 
 		// Archive directories older than archive period
-		if archiveEnabled && dirDate.Before(archiveCutoff) {
+		if policy.ArchiveEnabled && dirDate.Before(archiveCutoff) {
 			s.archiveDirectory(basePath, dirPath, dirDate)
 		}
 	}
 }
 
+// deleteFile deletes a file from a provider together with its metadata
+func (s *StorageCleanerService) deleteFile(storageName string, provider storage.Provider, key string) error {
+	ctx := context.Background()
+	if err := provider.Delete(ctx, key); err != nil {
+		return err
+	}
+	// A mirror only drops its replica record, the index entry belongs to the storage holding the primary copy
+	if err := s.replicaRepo.DeleteReplica(ctx, key, storageName); err != nil {
+		logger.L().Warn("Failed to delete replica",
+			zap.String("storage", storageName), zap.String("key", key), zap.Error(err))
+	}
+	if metadata, err := s.storageRepo.GetFileMetadata(ctx, key); err == nil && metadata.StorageName != "" && metadata.StorageName != storageName {
+		return nil
+	}
+	if err := s.storageRepo.DeleteFileMetadata(ctx, key); err != nil {
+		logger.L().Warn("Failed to delete file metadata",
+			zap.String("storage", storageName), zap.String("key", key), zap.Error(err))
+	}
+	return nil
+}
+
+// fileDate returns the date a file belongs to, taken from its date directory
+// (YYYY-MM-DD/... or archived/YYYY-MM-DD_archived/...) and falling back to its modification time
+func fileDate(f storage.FileInfo) time.Time {
+	parts := strings.Split(strings.TrimPrefix(f.Key, "archived/"), "/")
+	if len(parts) > 1 && len(parts[0]) >= 10 {
+		if t, err := time.ParseInLocation("2006-01-02", parts[0][:10], time.Local); err == nil {
+			return t
+		}
+	}
+	return f.LastModified
+}
+
 // archiveDirectory archives a directory to archived folder
 func (s *StorageCleanerService) archiveDirectory(basePath, dirPath string, dirDate time.Time) {
 	archiveDir := filepath.Join(basePath, "archived")
@@ -217,17 +229,40 @@ func (s *StorageCleanerService) archiveDirectory(basePath, dirPath string, dirDa
 		zap.String("source", dirPath),
 		zap.String("archive", archivedDirPath))
 
+	// Keys of the files moved along, their metadata has to follow
+	var keys []string
+	filepath.WalkDir(dirPath, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if rel, err := filepath.Rel(dirPath, path); err == nil {
+				keys = append(keys, filepath.ToSlash(rel))
+			}
+		}
+		return nil
+	})
+
 	// Move directory to archived folder
 	if err := os.Rename(dirPath, archivedDirPath); err != nil {
 		logger.L().Error("Failed to archive directory",
 			zap.String("source", dirPath),
 			zap.String("dest", archivedDirPath),
 			zap.Error(err))
-	} else {
-		logger.L().Info("Successfully archived directory",
-			zap.String("source", dirPath),
-			zap.String("dest", archivedDirPath))
+		return
+	}
+
+	ctx := context.Background()
+	for _, key := range keys {
+		oldKey := filepath.Base(dirPath) + "/" + key
+		newKey := "archived/" + archivedDirName + "/" + key
+		if err := s.storageRepo.RenameFileMetadata(ctx, oldKey, newKey); err != nil {
+			logger.L().Warn("Failed to update metadata of archived file",
+				zap.String("key", oldKey), zap.Error(err))
+		}
 	}
+
+	logger.L().Info("Successfully archived directory",
+		zap.String("source", dirPath),
+		zap.String("dest", archivedDirPath),
+		zap.Int("files", len(keys)))
 }
 
 // parseIntConfig parses integer from string config
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/pkg/config"
+	"github.com/veops/oneterm/pkg/logger"
+	"github.com/veops/oneterm/pkg/storage"
+)
+
+var (
+	keyringOnce sync.Once
+	keyring     *storage.Keyring
+	keyringErr  error
+
+	keyRotations sync.Map // storage name of running key rotations
+)
+
+// storageKeyring loads the master keys of storage encryption from the config
+func storageKeyring() (*storage.Keyring, error) {
+	keyringOnce.Do(func() {
+		cfg := config.Cfg.StorageEncryption
+		if len(cfg.Keys) == 0 {
+			keyringErr = fmt.Errorf("no storage encryption key is configured")
+			return
+		}
+
+		// Viper lowercases map keys, so key ids are case insensitive
+		keys := make(map[string][]byte, len(cfg.Keys))
+		for id, encoded := range cfg.Keys {
+			key, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				keyringErr = fmt.Errorf("storage encryption key %s: %w", id, err)
+				return
+			}
+			keys[strings.ToLower(id)] = key
+		}
+		keyring, keyringErr = storage.NewKeyring(strings.ToLower(cfg.CurrentKey), keys)
+	})
+	return keyring, keyringErr
+}
+
+// encryptionEnabled tells whether a storage config encrypts the objects it stores
+func encryptionEnabled(config *model.StorageConfig) bool {
+	return config.Config["encryption_enabled"] == "true"
+}
+
+// encryptionRequired tells whether an encrypted storage refuses to read plaintext objects, set it once a key
+// rotation encrypted the objects stored before encryption was enabled
+func encryptionRequired(config *model.StorageConfig) bool {
+	return encryptionEnabled(config) && config.Config["encryption_required"] == "true"
+}
+
+// encryptionKeyId returns the master key new objects of a provider are encrypted with, empty when it does not encrypt
+func encryptionKeyId(provider storage.Provider) string {
+	if enc, ok := provider.(*storage.EncryptedProvider); ok {
+		return enc.Keyring().CurrentKeyId()
+	}
+	return ""
+}
+
+func encryptionRotationName(storageName string) string {
+	return model.MigrationStorageKeyRotation + ":" + storageName
+}
+
+// StartEncryptionRotation encrypts again every object of an encrypted storage that is not under the current master key,
+// objects stored before encryption was enabled get encrypted too. It returns false when a rotation of the storage is running.
+func StartEncryptionRotation(storageName string) (bool, error) {
+	if DefaultStorageService == nil {
+		return false, fmt.Errorf("storage service not initialized")
+	}
+
+	s := DefaultStorageService.(*storageService)
+	provider, err := s.getProvider(storageName)
+	if err != nil {
+		return false, err
+	}
+	enc, ok := provider.(*storage.EncryptedProvider)
+	if !ok {
+		return false, fmt.Errorf("storage %s is not encrypted", storageName)
+	}
+
+	if _, running := keyRotations.LoadOrStore(storageName, true); running {
+		return false, nil
+	}
+
+	go func() {
+		defer keyRotations.Delete(storageName)
+
+		ctx := context.Background()
+		name := encryptionRotationName(storageName)
+		markMigrationRecord(ctx, name, model.MigrationStatusRunning, 0, "")
+
+		count, err := s.rotateEncryption(ctx, storageName, enc)
+		if err != nil {
+			logger.L().Error("Storage key rotation failed", zap.String("storage", storageName), zap.Int("rotated", count), zap.Error(err))
+			markMigrationRecord(ctx, name, model.MigrationStatusFailed, count, err.Error())
+			return
+		}
+
+		logger.L().Info("Storage key rotation completed", zap.String("storage", storageName), zap.Int("rotated", count))
+		markMigrationRecord(ctx, name, model.MigrationStatusCompleted, count, "")
+	}()
+
+	return true, nil
+}
+
+// GetEncryptionRotation gets the state of the key rotation of a storage, nil if it never ran
+func GetEncryptionRotation(ctx context.Context, storageName string) (*model.MigrationRecord, error) {
+	return getMigrationRecord(ctx, encryptionRotationName(storageName))
+}
+
+// rotateEncryption rekeys the objects of a storage one by one, a failed object does not stop the rotation
+func (s *storageService) rotateEncryption(ctx context.Context, storageName string, enc *storage.EncryptedProvider) (int, error) {
+	count, failed := 0, 0
+	keyId := enc.Keyring().CurrentKeyId()
+
+	err := storage.Walk(ctx, enc, "", func(f storage.FileInfo) error {
+		rewritten, err := enc.Rekey(ctx, f.Key)
+		if err != nil {
+			logger.L().Warn("Failed to rekey object", zap.String("storage", storageName), zap.String("key", f.Key), zap.Error(err))
+			failed++
+			return nil
+		}
+		if !rewritten {
+			return nil
+		}
+
+		count++
+		if err = s.storageRepo.SetFileEncryptionKey(ctx, storageName, f.Key, keyId); err != nil {
+			logger.L().Warn("Failed to record object encryption key", zap.String("key", f.Key), zap.Error(err))
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	if failed > 0 {
+		return count, fmt.Errorf("%d objects could not be rekeyed", failed)
+	}
+
+	return count, nil
+}
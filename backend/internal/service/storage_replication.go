@@ -0,0 +1,515 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/repository"
+	"github.com/veops/oneterm/pkg/logger"
+	"github.com/veops/oneterm/pkg/storage"
+)
+
+const (
+	maxReplicaAttempts = 3
+	migrationBatchSize = 100
+)
+
+// ParseMirrorTargets reads the mirror of each category from a storage config, set as mirror.<category>: <storage name>
+func ParseMirrorTargets(config *model.StorageConfig) map[string]string {
+	targets := map[string]string{}
+	for _, category := range RetentionCategories {
+		if target := strings.TrimSpace(config.Config["mirror."+category]); target != "" && target != config.Name {
+			targets[category] = target
+		}
+	}
+	return targets
+}
+
+// replicaRef identifies a replica in the queue
+type replicaRef struct {
+	key    string
+	target string
+}
+
+// StorageReplicationService copies stored files to the mirror of their category in the background
+// and runs the migrations between storages
+type StorageReplicationService struct {
+	repo        repository.StorageReplicationRepository
+	storageRepo repository.StorageRepository
+	queue       chan replicaRef
+	migrations  sync.Map // ids of the migrations running in this process
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+// NewStorageReplicationService creates a new storage replication service
+func NewStorageReplicationService() *StorageReplicationService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &StorageReplicationService{
+		repo:        repository.NewStorageReplicationRepository(),
+		storageRepo: repository.NewStorageRepository(),
+		queue:       make(chan replicaRef, 1024),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Global storage replication service instance
+var DefaultStorageReplicationService *StorageReplicationService
+
+// InitStorageReplicationService starts the replication worker and resumes unfinished replicas and migrations
+func InitStorageReplicationService() {
+	if DefaultStorageService == nil {
+		logger.L().Warn("Storage service not initialized, skipping replication initialization")
+		return
+	}
+
+	DefaultStorageReplicationService = NewStorageReplicationService()
+	DefaultStorageReplicationService.Start()
+}
+
+// StopStorageReplicationService stops the replication worker and running migrations
+func StopStorageReplicationService() {
+	if DefaultStorageReplicationService != nil {
+		DefaultStorageReplicationService.Stop()
+	}
+}
+
+// Start starts the worker, replicas and migrations interrupted by a restart are picked up again
+func (s *StorageReplicationService) Start() {
+	s.wg.Add(1)
+	go s.work()
+
+	replicas, err := s.repo.GetReplicasByStatus(s.ctx, model.ReplicaStatusPending, model.ReplicaStatusRunning)
+	if err != nil {
+		logger.L().Error("Failed to load unfinished replicas", zap.Error(err))
+	}
+	for _, r := range replicas {
+		s.enqueue(replicaRef{key: r.StorageKey, target: r.TargetStorage})
+	}
+
+	migrations, err := s.repo.GetMigrationsByStatus(s.ctx, model.MigrationStatusPending, model.MigrationStatusRunning)
+	if err != nil {
+		logger.L().Error("Failed to load unfinished storage migrations", zap.Error(err))
+	}
+	for _, m := range migrations {
+		s.launchMigration(m.Id)
+	}
+
+	logger.L().Info("Storage replication service started",
+		zap.Int("requeued_replicas", len(replicas)),
+		zap.Int("resumed_migrations", len(migrations)))
+}
+
+// Stop stops the worker and running migrations, they resume from their last state on next start
+func (s *StorageReplicationService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+	logger.L().Info("Storage replication service stopped")
+}
+
+// replicateFile queues the copy of a newly stored file to the mirror of its category, if any
+func replicateFile(ctx context.Context, metadata *model.FileMetadata) {
+	if DefaultStorageReplicationService != nil {
+		DefaultStorageReplicationService.Replicate(ctx, metadata)
+	}
+}
+
+// Replicate queues the copy of a stored file to the mirror its storage config sets for the file category
+func (s *StorageReplicationService) Replicate(ctx context.Context, metadata *model.FileMetadata) {
+	config, err := s.storageRepo.GetStorageConfigByName(ctx, metadata.StorageName)
+	if err != nil {
+		return
+	}
+
+	category := lo.CoalesceOrEmpty(fileCategory(metadata.StorageKey), metadata.Category)
+	target := ParseMirrorTargets(config)[category]
+	if target == "" {
+		return
+	}
+
+	replica := &model.FileReplica{
+		StorageKey:    metadata.StorageKey,
+		TargetStorage: target,
+		SourceStorage: metadata.StorageName,
+		Category:      category,
+		FileSize:      metadata.FileSize,
+		Checksum:      metadata.Checksum,
+		Status:        model.ReplicaStatusPending,
+	}
+	if err := s.repo.UpsertReplica(ctx, replica); err != nil {
+		logger.L().Warn("Failed to create replica",
+			zap.String("key", metadata.StorageKey), zap.String("target", target), zap.Error(err))
+		return
+	}
+	s.enqueue(replicaRef{key: replica.StorageKey, target: target})
+}
+
+func (s *StorageReplicationService) enqueue(ref replicaRef) {
+	// Never block the caller, replicas left in the DB are picked up on the next start
+	select {
+	case s.queue <- ref:
+	default:
+		logger.L().Warn("Replication queue is full", zap.String("key", ref.key), zap.String("target", ref.target))
+	}
+}
+
+func (s *StorageReplicationService) work() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case ref := <-s.queue:
+			s.processReplica(ref)
+		}
+	}
+}
+
+func (s *StorageReplicationService) processReplica(ref replicaRef) {
+	replica, err := s.repo.GetReplica(s.ctx, ref.key, ref.target)
+	if err != nil || replica.Status == model.ReplicaStatusCompleted {
+		return
+	}
+
+	replica.Status = model.ReplicaStatusRunning
+	replica.Attempts++
+	if err = s.repo.UpdateReplica(s.ctx, replica); err != nil {
+		logger.L().Error("Failed to update replica", zap.String("key", ref.key), zap.Error(err))
+		return
+	}
+
+	size, checksum, err := s.copy(s.ctx, replica.SourceStorage, replica.TargetStorage, replica.StorageKey)
+	if s.ctx.Err() != nil {
+		// Shutting down, leave the replica running so it is requeued on next start
+		return
+	}
+	if err == nil && replica.Checksum != "" && replica.Checksum != checksum {
+		err = fmt.Errorf("checksum mismatch, indexed %s, copied %s", replica.Checksum, checksum)
+	}
+
+	if err != nil {
+		replica.Status = model.ReplicaStatusFailed
+		replica.ErrorMessage = err.Error()
+		if replica.Attempts < maxReplicaAttempts {
+			replica.Status = model.ReplicaStatusPending
+			time.AfterFunc(time.Duration(replica.Attempts)*time.Minute, func() { s.enqueue(ref) })
+		}
+		logger.L().Warn("Replication failed",
+			zap.String("key", ref.key), zap.String("target", ref.target),
+			zap.Int("attempts", replica.Attempts), zap.Error(err))
+	} else {
+		replica.Status = model.ReplicaStatusCompleted
+		replica.ErrorMessage = ""
+		replica.FileSize = size
+		replica.Checksum = checksum
+	}
+
+	if err = s.repo.UpdateReplica(context.Background(), replica); err != nil {
+		logger.L().Error("Failed to update replica", zap.String("key", ref.key), zap.Error(err))
+	}
+}
+
+// copy copies a file between two configured storages
+func (s *StorageReplicationService) copy(ctx context.Context, sourceName, targetName, key string) (int64, string, error) {
+	source, err := DefaultStorageService.(*storageService).getProvider(sourceName)
+	if err != nil {
+		return 0, "", err
+	}
+	target, err := DefaultStorageService.(*storageService).getProvider(targetName)
+	if err != nil {
+		return 0, "", err
+	}
+	return copyFile(ctx, source, target, key)
+}
+
+// copyFile copies a file to another provider under the same key and reads the copy back to verify it,
+// it returns the size and SHA-256 of the file
+func copyFile(ctx context.Context, source, target storage.Provider, key string) (int64, string, error) {
+	size, err := source.GetSize(ctx, key)
+	if err != nil {
+		return 0, "", err
+	}
+
+	reader, err := source.Download(ctx, key)
+	if err != nil {
+		return 0, "", err
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	if err = target.Upload(ctx, key, io.TeeReader(reader, hash), size); err != nil {
+		return 0, "", fmt.Errorf("upload copy: %w", err)
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+
+	copied, err := target.Download(ctx, key)
+	if err != nil {
+		return 0, "", fmt.Errorf("read back copy: %w", err)
+	}
+	defer copied.Close()
+
+	verify := sha256.New()
+	n, err := io.Copy(verify, copied)
+	if err != nil {
+		return 0, "", fmt.Errorf("read back copy: %w", err)
+	}
+	if n != size || hex.EncodeToString(verify.Sum(nil)) != checksum {
+		return 0, "", fmt.Errorf("verification of %s failed, copied %d of %d bytes", key, n, size)
+	}
+
+	return size, checksum, nil
+}
+
+// StartMigration creates a job copying the files of a category from one storage to another, category empty for all
+func (s *StorageReplicationService) StartMigration(ctx context.Context, source, target, category string, deleteSource bool, uid int) (*model.StorageMigration, error) {
+	if source == target {
+		return nil, fmt.Errorf("source and target storage are the same")
+	}
+	for _, name := range []string{source, target} {
+		if _, err := DefaultStorageService.(*storageService).getProvider(name); err != nil {
+			return nil, err
+		}
+	}
+
+	active, err := s.repo.GetMigrationsByStatus(ctx, model.MigrationStatusPending, model.MigrationStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+	if lo.ContainsBy(active, func(m *model.StorageMigration) bool { return m.SourceStorage == source }) {
+		return nil, fmt.Errorf("storage %s already has a running migration", source)
+	}
+
+	total, err := s.repo.CountFileMetadataAfter(ctx, source, category, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	migration := &model.StorageMigration{
+		SourceStorage: source,
+		TargetStorage: target,
+		Category:      category,
+		DeleteSource:  deleteSource,
+		Status:        model.MigrationStatusPending,
+		TotalCount:    int(total),
+		CreatorId:     uid,
+	}
+	if err = s.repo.CreateMigration(ctx, migration); err != nil {
+		return nil, err
+	}
+	s.launchMigration(migration.Id)
+
+	return migration, nil
+}
+
+// ResumeMigration restarts a failed migration, files already moved are not listed on the source anymore
+// so it rescans from the start and only retries what is left
+func (s *StorageReplicationService) ResumeMigration(ctx context.Context, id int) (*model.StorageMigration, error) {
+	migration, err := s.repo.GetMigration(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, running := s.migrations.Load(id); running {
+		return migration, nil
+	}
+	if migration.Status == model.MigrationStatusCompleted {
+		return nil, fmt.Errorf("storage migration %d is already completed", id)
+	}
+
+	if migration.Status == model.MigrationStatusFailed {
+		remaining, err := s.repo.CountFileMetadataAfter(ctx, migration.SourceStorage, migration.Category, 0)
+		if err != nil {
+			return nil, err
+		}
+		migration.LastId = 0
+		migration.FailedCount = 0
+		migration.SkippedCount = 0
+		migration.TotalCount = migration.CopiedCount + int(remaining)
+	}
+	migration.Status = model.MigrationStatusPending
+	migration.ErrorMessage = ""
+	if err = s.repo.UpdateMigration(ctx, migration); err != nil {
+		return nil, err
+	}
+	s.launchMigration(id)
+
+	return migration, nil
+}
+
+// GetMigration gets a storage migration job
+func (s *StorageReplicationService) GetMigration(ctx context.Context, id int) (*model.StorageMigration, error) {
+	return s.repo.GetMigration(ctx, id)
+}
+
+// GetMigrations lists the storage migration jobs
+func (s *StorageReplicationService) GetMigrations(ctx context.Context) ([]*model.StorageMigration, error) {
+	return s.repo.GetMigrations(ctx)
+}
+
+func (s *StorageReplicationService) launchMigration(id int) {
+	if _, loaded := s.migrations.LoadOrStore(id, true); loaded {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer s.migrations.Delete(id)
+		s.runMigration(id)
+	}()
+}
+
+func (s *StorageReplicationService) runMigration(id int) {
+	migration, err := s.repo.GetMigration(s.ctx, id)
+	if err != nil {
+		logger.L().Error("Failed to load storage migration", zap.Int("id", id), zap.Error(err))
+		return
+	}
+
+	migration.Status = model.MigrationStatusRunning
+	migration.StartedAt = lo.CoalesceOrEmpty(migration.StartedAt, lo.ToPtr(time.Now()))
+	migration.CompletedAt = nil
+	s.saveMigration(migration)
+
+	source, err := DefaultStorageService.(*storageService).getProvider(migration.SourceStorage)
+	if err != nil {
+		s.finishMigration(migration, err)
+		return
+	}
+	target, err := DefaultStorageService.(*storageService).getProvider(migration.TargetStorage)
+	if err != nil {
+		s.finishMigration(migration, err)
+		return
+	}
+
+	for {
+		files, err := s.repo.ListFileMetadataAfter(s.ctx, migration.SourceStorage, migration.Category, migration.LastId, migrationBatchSize)
+		if s.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.finishMigration(migration, err)
+			return
+		}
+		if len(files) == 0 {
+			break
+		}
+
+		for _, f := range files {
+			copied, err := s.migrateFile(s.ctx, migration, source, target, f)
+			if s.ctx.Err() != nil {
+				// Shutting down, the job stays running and resumes from the cursor on next start
+				s.saveMigration(migration)
+				return
+			}
+			switch {
+			case err != nil:
+				migration.FailedCount++
+				logger.L().Warn("Failed to migrate file",
+					zap.Int("migration", migration.Id), zap.String("key", f.StorageKey), zap.Error(err))
+			case !copied:
+				migration.SkippedCount++
+			default:
+				migration.CopiedCount++
+				migration.CopiedBytes += f.FileSize
+			}
+			migration.LastId = f.Id
+		}
+		s.saveMigration(migration)
+	}
+
+	if migration.FailedCount > 0 {
+		s.finishMigration(migration, fmt.Errorf("%d files failed to migrate", migration.FailedCount))
+		return
+	}
+	s.finishMigration(migration, nil)
+}
+
+// migrateFile copies a file to the target and points its index entry there.
+// It returns false when the file is gone from the source and there is nothing to copy.
+func (s *StorageReplicationService) migrateFile(ctx context.Context, migration *model.StorageMigration, source, target storage.Provider, f *model.FileMetadata) (bool, error) {
+	exists, err := source.Exists(ctx, f.StorageKey)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, nil
+	}
+
+	size, checksum, err := copyFile(ctx, source, target, f.StorageKey)
+	if err != nil {
+		return false, err
+	}
+	if f.Checksum != "" && f.Checksum != checksum {
+		return false, fmt.Errorf("checksum mismatch, indexed %s, copied %s", f.Checksum, checksum)
+	}
+
+	f.StorageName = migration.TargetStorage
+	f.StorageType = model.StorageType(target.Type())
+	f.EncryptionKeyId = encryptionKeyId(target)
+	f.FileSize = size
+	f.Checksum = checksum
+	if err = s.storageRepo.UpdateFileMetadata(ctx, f); err != nil {
+		return false, err
+	}
+
+	// The target holds the primary copy now, what is left on the source becomes a replica of it
+	if err = s.repo.DeleteReplica(ctx, f.StorageKey, migration.TargetStorage); err != nil {
+		logger.L().Warn("Failed to delete replica", zap.String("key", f.StorageKey), zap.Error(err))
+	}
+	if migration.DeleteSource {
+		if err = source.Delete(ctx, f.StorageKey); err != nil {
+			logger.L().Warn("Failed to delete migrated file from source",
+				zap.String("storage", migration.SourceStorage), zap.String("key", f.StorageKey), zap.Error(err))
+		}
+		return true, nil
+	}
+
+	replica := &model.FileReplica{
+		StorageKey:    f.StorageKey,
+		TargetStorage: migration.SourceStorage,
+		SourceStorage: migration.TargetStorage,
+		Category:      f.Category,
+		FileSize:      size,
+		Checksum:      checksum,
+		Status:        model.ReplicaStatusCompleted,
+	}
+	if err = s.repo.UpsertReplica(ctx, replica); err != nil {
+		logger.L().Warn("Failed to record source copy as replica", zap.String("key", f.StorageKey), zap.Error(err))
+	}
+
+	return true, nil
+}
+
+func (s *StorageReplicationService) finishMigration(migration *model.StorageMigration, err error) {
+	migration.CompletedAt = lo.ToPtr(time.Now())
+	migration.Status = model.MigrationStatusCompleted
+	if err != nil {
+		migration.Status = model.MigrationStatusFailed
+		migration.ErrorMessage = err.Error()
+	}
+	s.saveMigration(migration)
+
+	logger.L().Info("Storage migration finished",
+		zap.Int("id", migration.Id),
+		zap.String("status", migration.Status),
+		zap.Int("copied", migration.CopiedCount),
+		zap.Int("skipped", migration.SkippedCount),
+		zap.Int("failed", migration.FailedCount))
+}
+
+func (s *StorageReplicationService) saveMigration(migration *model.StorageMigration) {
+	if err := s.repo.UpdateMigration(context.Background(), migration); err != nil {
+		logger.L().Error("Failed to save storage migration", zap.Int("id", migration.Id), zap.Error(err))
+	}
+}
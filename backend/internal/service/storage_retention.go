@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/pkg/logger"
+	"github.com/veops/oneterm/pkg/storage"
+)
+
+// RetentionCategories are the file categories a storage config can set its own retention for
+var RetentionCategories = []string{
+	model.FileCategoryReplay,
+	model.FileCategoryRdpFile,
+	model.FileCategoryGuacdRecording,
+	model.FileCategoryReplayVideo,
+	model.FileCategoryAuditExport,
+}
+
+// defaultRetentionCategories are the session recordings retention_days applies to, the other categories are only
+// expired by a retention_days.<category> of their own
+var defaultRetentionCategories = []string{
+	model.FileCategoryReplay,
+	model.FileCategoryGuacdRecording,
+	model.FileCategoryReplayVideo,
+}
+
+// RetentionPolicy is the lifecycle of the files of a storage config, read from its config map.
+// retention_days applies to the session recordings unless overridden by retention_days.<category>,
+// 0 or less keeps the files of a category forever.
+type RetentionPolicy struct {
+	CleanupEnabled bool           `json:"cleanup_enabled"`
+	ArchiveEnabled bool           `json:"archive_enabled"`
+	RetentionDays  int            `json:"retention_days"`
+	ArchiveDays    int            `json:"archive_days"`
+	Categories     map[string]int `json:"categories"`
+}
+
+// ParseRetentionPolicy reads the retention policy of a storage config
+func ParseRetentionPolicy(config *model.StorageConfig) *RetentionPolicy {
+	policy := &RetentionPolicy{
+		CleanupEnabled: true,
+		ArchiveEnabled: true,
+		RetentionDays:  30,
+		ArchiveDays:    7,
+		Categories:     map[string]int{},
+	}
+
+	if val, exists := config.Config["retention_days"]; exists {
+		if days, err := parseIntConfig(val); err == nil {
+			policy.RetentionDays = days
+		}
+	}
+	if val, exists := config.Config["archive_days"]; exists {
+		if days, err := parseIntConfig(val); err == nil {
+			policy.ArchiveDays = days
+		}
+	}
+	if val, exists := config.Config["cleanup_enabled"]; exists {
+		policy.CleanupEnabled = val == "true"
+	}
+	if val, exists := config.Config["archive_enabled"]; exists {
+		policy.ArchiveEnabled = val == "true"
+	}
+	for _, category := range RetentionCategories {
+		if val, exists := config.Config["retention_days."+category]; exists {
+			if days, err := parseIntConfig(val); err == nil {
+				policy.Categories[category] = days
+			}
+		}
+	}
+
+	return policy
+}
+
+// Days returns the retention of a category in days, 0 keeps the files forever. Categories the admin did not set,
+// such as the drive files of RDP sessions which are user data, are kept unless they are session recordings.
+func (p *RetentionPolicy) Days(category string) int {
+	if days, ok := p.Categories[category]; ok {
+		return days
+	}
+	if lo.Contains(defaultRetentionCategories, category) {
+		return p.RetentionDays
+	}
+	return 0
+}
+
+// RetentionFile is a stored file past its retention
+type RetentionFile struct {
+	StorageName string    `json:"storage_name"`
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	Category    string    `json:"category"`
+	SessionId   string    `json:"session_id"`
+	MetadataId  int       `json:"metadata_id"`
+	Date        time.Time `json:"date"`
+	ExpiredAt   time.Time `json:"expired_at"`
+}
+
+// RetentionReport lists the files a cleanup run deletes from a storage
+type RetentionReport struct {
+	StorageName string           `json:"storage_name"`
+	Policy      *RetentionPolicy `json:"policy"`
+	Expired     []*RetentionFile `json:"expired"`
+	ExpiredSize int64            `json:"expired_size"`
+	Held        []*RetentionFile `json:"held"` // Expired but kept by a legal hold on their session
+	GeneratedAt time.Time        `json:"generated_at"`
+}
+
+// GetRetentionReport evaluates the retention policy of a storage config without deleting anything
+func (s *StorageCleanerService) GetRetentionReport(ctx context.Context, config *model.StorageConfig) (*RetentionReport, error) {
+	provider, err := s.storageService.CreateProvider(config)
+	if err != nil {
+		return nil, err
+	}
+	return s.planRetention(ctx, config, provider)
+}
+
+// planRetention walks a provider and collects the files past the retention of their category.
+// The report is returned with the files found so far when listing fails halfway.
+func (s *StorageCleanerService) planRetention(ctx context.Context, config *model.StorageConfig, provider storage.Provider) (*RetentionReport, error) {
+	policy := ParseRetentionPolicy(config)
+	report := &RetentionReport{
+		StorageName: config.Name,
+		Policy:      policy,
+		Expired:     []*RetentionFile{},
+		Held:        []*RetentionFile{},
+		GeneratedAt: time.Now(),
+	}
+	if !policy.CleanupEnabled {
+		return report, nil
+	}
+
+	heldIds, err := s.sessionRepo.GetLegalHoldSessionIds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	held := lo.SliceToMap(heldIds, func(id string) (string, bool) { return id, true })
+
+	// Recordings are stored at the root or in date directories, the whole provider is walked but only the files of a
+	// known category are considered, raw guacd recordings and anything else in the bucket are left alone
+	err = storage.Walk(ctx, provider, "", func(f storage.FileInfo) error {
+		category := fileCategory(f.Key)
+		if category == "" {
+			return nil
+		}
+		days := policy.Days(category)
+		if days <= 0 {
+			return nil
+		}
+		date := fileDate(f)
+		expiredAt := date.AddDate(0, 0, days)
+		if expiredAt.After(report.GeneratedAt) {
+			return nil
+		}
+
+		file := &RetentionFile{
+			StorageName: config.Name,
+			Key:         f.Key,
+			Size:        f.Size,
+			Category:    category,
+			SessionId:   fileSessionId(category, f.Key),
+			Date:        date,
+			ExpiredAt:   expiredAt,
+		}
+		// The metadata knows the session of files whose key does not tell
+		if metadata, err := s.storageRepo.GetFileMetadata(ctx, f.Key); err == nil {
+			file.MetadataId = metadata.Id
+			file.SessionId = lo.CoalesceOrEmpty(metadata.SessionId, file.SessionId)
+		}
+
+		if file.SessionId != "" && held[file.SessionId] {
+			report.Held = append(report.Held, file)
+			return nil
+		}
+		// A bundle holding any session on legal hold is kept with it
+		if category == model.FileCategoryAuditExport && s.exportHeld(ctx, config.Name, f.Key, held) {
+			report.Held = append(report.Held, file)
+			return nil
+		}
+		report.Expired = append(report.Expired, file)
+		report.ExpiredSize += f.Size
+		return nil
+	})
+
+	return report, err
+}
+
+// applyRetention deletes the files past their retention and records every deletion in the history
+func (s *StorageCleanerService) applyRetention(ctx context.Context, config *model.StorageConfig, provider storage.Provider) {
+	report, err := s.planRetention(ctx, config, provider)
+	if err != nil {
+		logger.L().Error("Failed to list storage for cleanup",
+			zap.String("storage", config.Name), zap.Error(err))
+		if report == nil {
+			return
+		}
+	}
+
+	deleted, failed := 0, 0
+	for _, file := range report.Expired {
+		if err := s.deleteFile(config.Name, provider, file.Key); err != nil {
+			logger.L().Error("Failed to delete expired file",
+				zap.String("storage", config.Name), zap.String("key", file.Key), zap.Error(err))
+			failed++
+			continue
+		}
+		s.recordDeletion(ctx, file)
+		if file.Category == model.FileCategoryAuditExport {
+			s.expireAuditExport(ctx, config.Name, file.Key)
+		}
+		deleted++
+	}
+
+	logger.L().Info("Expired files deleted",
+		zap.String("storage", config.Name),
+		zap.Int("deleted", deleted),
+		zap.Int("failed", failed),
+		zap.Int("held", len(report.Held)))
+}
+
+// exportHeld tells whether an audit export bundle contains a session on legal hold, bundles that cannot be checked
+// are kept
+func (s *StorageCleanerService) exportHeld(ctx context.Context, storageName, key string, held map[string]bool) bool {
+	export, err := s.exportRepo.GetAuditExportByKey(ctx, storageName, key)
+	if err != nil {
+		// A bundle of no export is a leftover, nothing to hold
+		return !errors.Is(err, gorm.ErrRecordNotFound)
+	}
+	if len(held) == 0 {
+		return false
+	}
+
+	const pageSize = 500
+	for lastId := 0; ; {
+		sessions, err := s.exportRepo.GetExportSessions(ctx, export, lastId, pageSize)
+		if err != nil {
+			logger.L().Warn("Failed to check legal hold of audit export, kept",
+				zap.Int("exportId", export.Id), zap.Error(err))
+			return true
+		}
+		if lo.ContainsBy(sessions, func(sess *model.Session) bool { return held[sess.SessionId] }) {
+			return true
+		}
+		if len(sessions) < pageSize {
+			return false
+		}
+		lastId = sessions[len(sessions)-1].Id
+	}
+}
+
+// expireAuditExport marks the export of a deleted bundle expired, it can no longer be downloaded
+func (s *StorageCleanerService) expireAuditExport(ctx context.Context, storageName, key string) {
+	export, err := s.exportRepo.GetAuditExportByKey(ctx, storageName, key)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.L().Warn("Failed to load expired audit export", zap.String("key", key), zap.Error(err))
+		}
+		return
+	}
+	export.Status = model.AuditExportStatusExpired
+	if err = s.exportRepo.UpdateAuditExport(ctx, export); err != nil {
+		logger.L().Warn("Failed to mark audit export expired", zap.Int("exportId", export.Id), zap.Error(err))
+	}
+}
+
+// recordDeletion writes the deletion of an expired file to the history, attributed to no user
+func (s *StorageCleanerService) recordDeletion(ctx context.Context, file *RetentionFile) {
+	history := &model.History{
+		Type:       model.DefaultFileMetadata.TableName(),
+		TargetId:   file.MetadataId,
+		ActionType: model.ACTION_DELETE,
+		Old:        toMap(file),
+		New:        model.Map[string, any]{},
+		CreatedAt:  time.Now(),
+	}
+	if err := s.historyService.CreateHistory(ctx, history); err != nil {
+		logger.L().Warn("Failed to record file deletion",
+			zap.String("storage", file.StorageName), zap.String("key", file.Key), zap.Error(err))
+	}
+}
+
+// fileCategory tells the retention category of a file from its key, empty if unknown
+func fileCategory(key string) string {
+	name := storage.TrimCompressedExtension(path.Base(key))
+	switch {
+	case strings.HasPrefix(key, "rdp/"), strings.HasPrefix(key, "rdp_files/"):
+		return model.FileCategoryRdpFile
+	case strings.HasPrefix(key, auditExportPrefix):
+		return model.FileCategoryAuditExport
+	case strings.HasSuffix(name, ".cast"):
+		return model.FileCategoryReplay
+	case strings.HasSuffix(name, model.GuacRecordingExtension):
+		return model.FileCategoryGuacdRecording
+	case strings.HasSuffix(name, "."+model.VideoFormatMp4), strings.HasSuffix(name, "."+model.VideoFormatWebm):
+		return model.FileCategoryReplayVideo
+	}
+	return ""
+}
+
+// fileSessionId tells the session of a recording from its key, session recordings are named after the session
+func fileSessionId(category, key string) string {
+	switch category {
+	case model.FileCategoryReplay, model.FileCategoryGuacdRecording, model.FileCategoryReplayVideo:
+		name := storage.TrimCompressedExtension(path.Base(key))
+		return strings.TrimSuffix(name, path.Ext(name))
+	}
+	return ""
+}
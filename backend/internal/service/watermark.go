@@ -0,0 +1,85 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/veops/oneterm/internal/guacd"
+	"github.com/veops/oneterm/internal/model"
+)
+
+const (
+	// DefaultWatermarkTemplate is used when a watermark is enabled without a template
+	DefaultWatermarkTemplate = "{user} {client_ip} {time}"
+
+	watermarkTimePlaceholder = "{time}"
+	// Watermarks are refreshed every minute, seconds would always be stale
+	watermarkTimeFormat = "2006-01-02 15:04"
+)
+
+// WatermarkData holds the values of the watermark placeholders
+type WatermarkData struct {
+	User      string
+	Uid       int
+	ClientIp  string
+	SessionId string
+	Asset     string
+	AssetId   int
+}
+
+// Drawable returns the data of a watermark drawn by guacd, names its font cannot draw are replaced by their id so
+// the watermark still tells who is connected
+func (d WatermarkData) Drawable() WatermarkData {
+	if !guacd.CanDrawWatermark(d.User) {
+		d.User = fmt.Sprintf("uid %d", d.Uid)
+	}
+	if !guacd.CanDrawWatermark(d.Asset) {
+		d.Asset = fmt.Sprintf("asset %d", d.AssetId)
+	}
+	return d
+}
+
+// ResolveWatermark returns the watermark that applies to a session, the rule that allowed the connection overrides
+// the global config
+func ResolveWatermark(result *model.AuthResult) model.WatermarkConfig {
+	if result != nil {
+		if wm, ok := result.Restrictions[model.RestrictionWatermark].(model.WatermarkConfig); ok {
+			return wm
+		}
+	}
+	if cfg := model.GlobalConfig.Load(); cfg != nil {
+		return cfg.Watermark
+	}
+	return model.WatermarkConfig{}
+}
+
+// RenderWatermark returns the watermark of a session, empty when it has no watermark. {time} is kept, WatermarkAt
+// fills it in whenever the watermark is drawn.
+func RenderWatermark(result *model.AuthResult, data WatermarkData) string {
+	wm := ResolveWatermark(result)
+	if !wm.Enabled {
+		return ""
+	}
+
+	template := strings.TrimSpace(wm.Template)
+	if template == "" {
+		template = DefaultWatermarkTemplate
+	}
+	return strings.NewReplacer(
+		"{user}", data.User,
+		"{client_ip}", data.ClientIp,
+		"{session_id}", data.SessionId,
+		"{asset}", data.Asset,
+	).Replace(template)
+}
+
+// WatermarkAt returns the text of a watermark at t
+func WatermarkAt(watermark string, t time.Time) string {
+	return strings.ReplaceAll(watermark, watermarkTimePlaceholder, t.Format(watermarkTimeFormat))
+}
+
+// WatermarkChanges tells whether the text of a watermark follows the clock and has to be drawn again
+func WatermarkChanges(watermark string) bool {
+	return strings.Contains(watermark, watermarkTimePlaceholder)
+}
@@ -0,0 +1,186 @@
+package web_proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/service"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+const (
+	redactedValue = "[REDACTED]"
+
+	// Bodies above this size are proxied without capturing their fields
+	maxRecordedBody = 1 << 20
+	// Recorded values are cut to this many characters
+	maxRecordedValue = 256
+)
+
+var (
+	// Headers always redacted, compared case insensitively
+	defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Auth-Token", "X-Csrf-Token", "X-Xsrf-Token"}
+	// Query parameters and form fields containing any of these are always redacted, compared case insensitively
+	defaultRedactFields = []string{"password", "passwd", "pwd", "secret", "token", "api_key", "apikey", "credential"}
+)
+
+// RecordingEnabled tells whether the requests of a session are recorded
+func RecordingEnabled(session *WebProxySession) bool {
+	return session != nil && session.WebConfig != nil && session.WebConfig.ProxySettings != nil && session.WebConfig.ProxySettings.RecordingEnabled
+}
+
+// CaptureRequestFields reads the fields of a form or JSON request body for the recording and puts the body back for
+// the proxy, other bodies are left alone
+func CaptureRequestFields(session *WebProxySession, req *http.Request) map[string]string {
+	if !RecordingEnabled(session) || req.Body == nil || req.ContentLength > maxRecordedBody {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" && mediaType != "application/json" {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxRecordedBody+1))
+	req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+	if err != nil || len(body) > maxRecordedBody {
+		return nil
+	}
+
+	redactor := newRedactor(session)
+	fields := make(map[string]string)
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil
+		}
+		for k, v := range redactor.values(values) {
+			fields[k] = truncateValue(strings.Join(v, ","))
+		}
+	case "application/json":
+		var obj map[string]any
+		if err := json.Unmarshal(body, &obj); err != nil {
+			return nil
+		}
+		for k, v := range redactor.json(obj).(map[string]any) {
+			if s, ok := v.(string); ok {
+				fields[k] = truncateValue(s)
+				continue
+			}
+			out, _ := json.Marshal(v)
+			fields[k] = truncateValue(string(out))
+		}
+	}
+	return fields
+}
+
+// RecordWebActivity records a request once its response was written, with the fields captured before it was proxied
+func RecordWebActivity(session *WebProxySession, ctx *gin.Context, startedAt time.Time, fields map[string]string) {
+	if !RecordingEnabled(session) {
+		return
+	}
+
+	redactor := newRedactor(session)
+	req := ctx.Request
+	headers := make(map[string]string, len(req.Header))
+	for k, v := range req.Header {
+		headers[k] = lo.Ternary(redactor.header(k), redactedValue, truncateValue(strings.Join(v, ",")))
+	}
+	query := req.URL.Query()
+	query.Del("session_id")
+
+	record := &model.SessionWebRequest{
+		SessionId:      session.SessionId,
+		Method:         req.Method,
+		Host:           session.CurrentHost,
+		Path:           req.URL.Path,
+		Query:          redactor.values(query).Encode(),
+		RequestHeaders: headers,
+		FormFields:     fields,
+		Status:         ctx.Writer.Status(),
+		ResponseSize:   int64(max(ctx.Writer.Size(), 0)),
+		ContentType:    ctx.Writer.Header().Get("Content-Type"),
+		Duration:       time.Since(startedAt).Milliseconds(),
+		Offset:         startedAt.Sub(session.CreatedAt).Seconds(),
+		CreatedAt:      startedAt,
+	}
+	if err := service.NewSessionService().CreateSessionWebRequest(context.Background(), record); err != nil {
+		logger.L().Error("Failed to record web request", zap.String("sessionId", session.SessionId), zap.Error(err))
+	}
+}
+
+// redactor hides the credentials of a request, the asset may redact more than the built-in names
+type redactor struct {
+	headers []string
+	fields  []string
+}
+
+func newRedactor(session *WebProxySession) *redactor {
+	r := &redactor{
+		headers: defaultRedactHeaders,
+		fields:  defaultRedactFields,
+	}
+	if RecordingEnabled(session) {
+		settings := session.WebConfig.ProxySettings
+		r.headers = append(append([]string{}, r.headers...), settings.RedactHeaders...)
+		r.fields = append(append([]string{}, r.fields...), settings.RedactFields...)
+	}
+	return r
+}
+
+func (r *redactor) header(name string) bool {
+	return lo.ContainsBy(r.headers, func(h string) bool { return strings.EqualFold(h, name) })
+}
+
+func (r *redactor) field(name string) bool {
+	name = strings.ToLower(name)
+	return lo.ContainsBy(r.fields, func(f string) bool { return f != "" && strings.Contains(name, strings.ToLower(f)) })
+}
+
+func (r *redactor) values(values url.Values) url.Values {
+	for k := range values {
+		if r.field(k) {
+			values[k] = []string{redactedValue}
+		}
+	}
+	return values
+}
+
+// json redacts the fields of nested objects too
+func (r *redactor) json(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			if r.field(k) {
+				v[k] = redactedValue
+				continue
+			}
+			v[k] = r.json(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = r.json(item)
+		}
+	}
+	return v
+}
+
+func truncateValue(s string) string {
+	if runes := []rune(s); len(runes) > maxRecordedValue {
+		return fmt.Sprintf("%s...(%d chars)", string(runes[:maxRecordedValue]), len(runes))
+	}
+	return s
+}
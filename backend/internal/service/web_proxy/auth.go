@@ -72,6 +72,7 @@ type AuthResult struct {
 	Success     bool
 	Message     string
 	Cookies     []*http.Cookie
+	Headers     map[string]string // Headers to send on the following requests
 	RedirectURL string
 	SessionData map[string]interface{}
 }
@@ -342,6 +343,7 @@ func (s *HTTPBasicAuthStrategy) Authenticate(ctx context.Context, credentials *C
 		Success: success,
 		Message: fmt.Sprintf("HTTP Basic auth %s", map[bool]string{true: "succeeded", false: "failed"}[success]),
 		Cookies: resp.Cookies(),
+		Headers: map[string]string{"Authorization": req.Header.Get("Authorization")},
 	}, nil
 }
 
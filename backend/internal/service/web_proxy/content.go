@@ -4,12 +4,16 @@ import (
 	"bytes"
 	"compress/gzip"
 	"fmt"
+	"html"
 	"io"
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/samber/lo"
+
+	"github.com/veops/oneterm/internal/service"
 )
 
 // RewriteHTMLContent rewrites HTML content to redirect external links through proxy
@@ -183,8 +187,11 @@ func ProcessHTMLResponse(resp *http.Response, assetID int, scheme, proxyHost str
 		})
 	}
 
-	// Step 2: Add watermark if enabled
-	if session.WebConfig != nil && session.WebConfig.ProxySettings != nil && session.WebConfig.ProxySettings.WatermarkEnabled {
+	// Step 2: Add watermark if enabled by the asset or by the global config and authorization rules
+	assetWatermark := session.WebConfig != nil && session.WebConfig.ProxySettings != nil && session.WebConfig.ProxySettings.WatermarkEnabled
+	if assetWatermark || session.Watermark != "" {
+		watermarkText := html.EscapeString(lo.CoalesceOrEmpty(service.WatermarkAt(session.Watermark, time.Now()), "OneTerm"))
+		watermarkStep := max(300, len([]rune(watermarkText))*20)
 		watermarkCSS := `
 		<style>
 		.oneterm-watermark-container {
@@ -209,14 +216,14 @@ func ProcessHTMLResponse(resp *http.Response, assetID int, scheme, proxyHost str
 		}
 		</style>`
 
-		// Generate watermark HTML with multiple OneTerm texts
+		// Generate watermark HTML with multiple watermark texts
 		var watermarkTexts []string
 		for row := 0; row < 30; row++ {
 			for col := 0; col < 15; col++ {
 				top := row * 100
-				left := col * 300
+				left := col * watermarkStep
 				watermarkTexts = append(watermarkTexts,
-					fmt.Sprintf(`<div class="oneterm-watermark-text" style="top: %dpx; left: %dpx;">OneTerm</div>`, top, left))
+					fmt.Sprintf(`<div class="oneterm-watermark-text" style="top: %dpx; left: %dpx;">%s</div>`, top, left, watermarkText))
 			}
 		}
 
@@ -436,11 +443,6 @@ func ProcessHTMLResponse(resp *http.Response, assetID int, scheme, proxyHost str
 		content = content + sessionJS + urlInterceptorJS
 	}
 
-	// Step 3: Record activity if enabled
-	if session.WebConfig != nil && session.WebConfig.ProxySettings != nil && session.WebConfig.ProxySettings.RecordingEnabled {
-		// Activity recording is handled elsewhere to avoid accessing ctx.Request here
-	}
-
 	// Update response
 	newBody := bytes.NewReader([]byte(content))
 	resp.Body = io.NopCloser(newBody)
@@ -0,0 +1,213 @@
+package web_proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+const (
+	// sessionCookieName is the cookie of the proxy session, the target never receives it
+	sessionCookieName = "oneterm_session_id"
+
+	upstreamLoginTimeout = 30 * time.Second
+	// upstreamLoginWait is how long the session start waits for the upstream login, a slower login goes on in the
+	// background and the first pages may show the login form of the target
+	upstreamLoginWait = 5 * time.Second
+)
+
+// UsesCookieJar tells whether the cookies of the target are kept on the server instead of the browser
+func UsesCookieJar(session *WebProxySession) bool {
+	return session != nil && session.WebConfig != nil &&
+		(session.WebConfig.CookieJar || session.WebConfig.AuthMode == model.WebAuthModeSmart)
+}
+
+// InjectCredentials adds the credentials of the asset, the headers of the upstream login and the cookies of the jar
+// to an upstream request
+func InjectCredentials(session *WebProxySession, req *http.Request) {
+	if session == nil {
+		return
+	}
+
+	if cfg := session.WebConfig; cfg != nil {
+		switch cfg.AuthMode {
+		case model.WebAuthModeBearer:
+			req.Header.Set("Authorization", "Bearer "+cfg.BearerToken)
+		case model.WebAuthModeHeader:
+			for k, v := range cfg.InjectHeaders {
+				req.Header.Set(k, v)
+			}
+		}
+	}
+	for k, v := range session.UpstreamHeaders {
+		req.Header.Set(k, v)
+	}
+
+	cookies := lo.Filter(req.Cookies(), func(c *http.Cookie, _ int) bool { return c.Name != sessionCookieName })
+	if UsesCookieJar(session) {
+		host := hostname(req.URL.Host)
+		now := time.Now()
+		jar := lo.Filter(session.UpstreamCookies, func(c *http.Cookie, _ int) bool {
+			return !cookieExpired(c, now) && cookieDomainMatch(c, host) && cookiePathMatch(c, req.URL.Path)
+		})
+		// Cookies of the jar win over the ones the browser set by script
+		cookies = lo.Filter(cookies, func(c *http.Cookie, _ int) bool {
+			return !lo.ContainsBy(jar, func(j *http.Cookie) bool { return j.Name == c.Name })
+		})
+		cookies = append(cookies, jar...)
+	}
+
+	req.Header.Del("Cookie")
+	for _, c := range cookies {
+		req.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+	}
+}
+
+// StoreUpstreamCookies moves the cookies set by the target into the jar of the session, the browser does not
+// receive them
+func StoreUpstreamCookies(session *WebProxySession, resp *http.Response) {
+	if !UsesCookieJar(session) {
+		return
+	}
+	cookies := resp.Cookies()
+	resp.Header.Del("Set-Cookie")
+	if len(cookies) == 0 {
+		return
+	}
+
+	if resp.Request != nil {
+		scopeCookies(cookies, hostname(resp.Request.URL.Host))
+	}
+
+	updated := sessionStore.Update(session.SessionId, func(s *WebProxySession) {
+		s.UpstreamCookies = mergeCookies(s.UpstreamCookies, cookies, time.Now())
+	})
+	if !updated {
+		logger.L().Warn("Failed to store upstream cookies, session not found", zap.String("sessionId", session.SessionId))
+	}
+}
+
+// StartUpstreamLogin logs in to the target for a stored session without holding the session start longer than
+// upstreamLoginWait
+func StartUpstreamLogin(session *WebProxySession, targetURL string) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		LoginUpstream(context.Background(), session, targetURL)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(upstreamLoginWait):
+		logger.L().Info("Upstream login still running, session started without it", zap.String("sessionId", session.SessionId))
+	}
+}
+
+// LoginUpstream logs in to the target with the active login accounts of the asset, the default one first. The
+// cookies and headers of the login are kept in the stored session.
+func LoginUpstream(ctx context.Context, session *WebProxySession, targetURL string) {
+	if session.WebConfig == nil {
+		return
+	}
+	accounts := lo.Filter(session.WebConfig.LoginAccounts, func(a model.WebLoginAccount, _ int) bool {
+		return a.Username != "" && a.Status != "inactive"
+	})
+	if len(accounts) == 0 {
+		logger.L().Warn("No login account for the smart auth mode", zap.Int("assetId", session.AssetId))
+		return
+	}
+	sort.SliceStable(accounts, func(i, j int) bool { return accounts[i].IsDefault && !accounts[j].IsDefault })
+
+	ctx, cancel := context.WithTimeout(ctx, upstreamLoginTimeout)
+	defer cancel()
+
+	authService := NewAuthService()
+	siteInfo, err := authService.AnalyzeSite(ctx, targetURL)
+	if err != nil {
+		logger.L().Warn("Failed to analyze web asset for login", zap.Int("assetId", session.AssetId), zap.Error(err))
+		return
+	}
+	result, err := authService.AuthenticateWithRetry(ctx, lo.Map(accounts, func(a model.WebLoginAccount, _ int) Credentials {
+		return Credentials{Username: a.Username, Password: a.Password}
+	}), siteInfo)
+	if err != nil || !result.Success {
+		logger.L().Warn("Upstream login failed, the user has to log in",
+			zap.String("sessionId", session.SessionId),
+			zap.Int("assetId", session.AssetId),
+			zap.String("reason", lo.TernaryF(err != nil, func() string { return err.Error() }, func() string { return result.Message })))
+		return
+	}
+
+	if u, err := url.Parse(targetURL); err == nil {
+		scopeCookies(result.Cookies, hostname(u.Host))
+	}
+	updated := sessionStore.Update(session.SessionId, func(s *WebProxySession) {
+		s.UpstreamCookies = mergeCookies(s.UpstreamCookies, result.Cookies, time.Now())
+		s.UpstreamHeaders = result.Headers
+	})
+	if !updated {
+		logger.L().Warn("Failed to store upstream login, session not found", zap.String("sessionId", session.SessionId))
+		return
+	}
+	logger.L().Info("Upstream login succeeded", zap.String("sessionId", session.SessionId), zap.Int("cookies", len(result.Cookies)))
+}
+
+// scopeCookies limits the cookies without a domain to the host that set them, as browsers do
+func scopeCookies(cookies []*http.Cookie, host string) {
+	for _, c := range cookies {
+		c.Domain = lo.CoalesceOrEmpty(c.Domain, host)
+		c.Path = lo.CoalesceOrEmpty(c.Path, "/")
+	}
+}
+
+// mergeCookies replaces the cookies of the jar with the same name, domain and path, deleted and expired ones are
+// dropped
+func mergeCookies(jar, cookies []*http.Cookie, now time.Time) []*http.Cookie {
+	key := func(c *http.Cookie) string {
+		return c.Name + ";" + strings.TrimPrefix(strings.ToLower(c.Domain), ".") + ";" + c.Path
+	}
+	for _, c := range cookies {
+		if c.MaxAge > 0 && c.Expires.IsZero() {
+			c.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		}
+		jar = lo.Reject(jar, func(j *http.Cookie, _ int) bool { return key(j) == key(c) })
+		if c.MaxAge >= 0 && !cookieExpired(c, now) {
+			jar = append(jar, c)
+		}
+	}
+	return lo.Reject(jar, func(c *http.Cookie, _ int) bool { return cookieExpired(c, now) })
+}
+
+func cookieExpired(c *http.Cookie, now time.Time) bool {
+	return !c.Expires.IsZero() && c.Expires.Before(now)
+}
+
+func cookieDomainMatch(c *http.Cookie, host string) bool {
+	domain := strings.TrimPrefix(strings.ToLower(c.Domain), ".")
+	return domain == "" || host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+func cookiePathMatch(c *http.Cookie, path string) bool {
+	if c.Path == "" || c.Path == "/" || path == c.Path {
+		return true
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(c.Path, "/")+"/")
+}
+
+// hostname strips the port of a host
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
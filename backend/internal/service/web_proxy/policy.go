@@ -0,0 +1,155 @@
+package web_proxy
+
+import (
+	"fmt"
+	"net/url"
+	gopath "path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+// AccessDeniedError is a request refused by the web access policy of the asset
+type AccessDeniedError struct {
+	Reason  string
+	Details string
+}
+
+func (e *AccessDeniedError) Error() string {
+	return e.Reason
+}
+
+// Compiled path rule patterns, keyed by pattern type and pattern
+var pathPatterns sync.Map
+
+// CheckWebAccessPolicy applies the allowed methods and the path rules of the asset to a request. Path rules are
+// matched against the decoded path, and paths the target could resolve to another one than the policy sees are
+// refused while the asset has path rules.
+func CheckWebAccessPolicy(session *WebProxySession, method string, u *url.URL) error {
+	if session.WebConfig == nil || session.WebConfig.ProxySettings == nil {
+		return nil
+	}
+	settings := session.WebConfig.ProxySettings
+	method = strings.ToUpper(method)
+	path := u.Path
+
+	err := func() error {
+		if len(settings.AllowedMethods) > 0 && !lo.ContainsBy(settings.AllowedMethods, func(m string) bool { return strings.EqualFold(m, method) }) {
+			return &AccessDeniedError{
+				Reason:  fmt.Sprintf("%s method not allowed", method),
+				Details: fmt.Sprintf("Allowed methods: %s", strings.Join(settings.AllowedMethods, ", ")),
+			}
+		}
+
+		if len(settings.BlockedPaths) == 0 && len(settings.PathRules) == 0 {
+			return nil
+		}
+		var err error
+		if path, err = policyPath(u); err != nil {
+			return err
+		}
+
+		// Legacy blocked paths match anywhere in the path
+		for _, blockedPath := range settings.BlockedPaths {
+			if blockedPath != "" && strings.Contains(path, blockedPath) {
+				return &AccessDeniedError{
+					Reason:  fmt.Sprintf("access to path '%s' is blocked", path),
+					Details: "The path is blocked by the web access policy of this asset.",
+				}
+			}
+		}
+
+		rules := lo.Filter(settings.PathRules, func(r model.WebPathRule, _ int) bool { return r.AppliesTo(method, session.AuthRuleId) })
+		for i := range rules {
+			if rules[i].Action == model.WebPathRuleDeny && matchPathRule(&rules[i], path) {
+				return &AccessDeniedError{
+					Reason:  fmt.Sprintf("access to path '%s' is denied", path),
+					Details: fmt.Sprintf("The path matches the deny rule %q of this asset.", rules[i].Pattern),
+				}
+			}
+		}
+		allows := lo.Filter(rules, func(r model.WebPathRule, _ int) bool { return r.Action == model.WebPathRuleAllow })
+		if len(allows) > 0 && !lo.SomeBy(allows, func(r model.WebPathRule) bool { return matchPathRule(&r, path) }) {
+			return &AccessDeniedError{
+				Reason:  fmt.Sprintf("access to path '%s' is not allowed", path),
+				Details: "The path matches none of the allow rules of this asset.",
+			}
+		}
+		return nil
+	}()
+
+	if err != nil {
+		logger.L().Warn("Web request denied by access policy",
+			zap.String("sessionId", session.SessionId),
+			zap.Int("assetId", session.AssetId),
+			zap.String("method", method),
+			zap.String("path", path),
+			zap.String("reason", err.Error()))
+		return err
+	}
+	logger.L().Debug("Web request allowed by access policy",
+		zap.String("sessionId", session.SessionId),
+		zap.String("method", method),
+		zap.String("path", path))
+	return nil
+}
+
+// policyPath returns the path rules are matched against. Encoded separators, dot segments and empty segments are
+// refused, servers resolve them differently. Path parameters (;jsessionid=...) are dropped, servers ignore them.
+func policyPath(u *url.URL) (string, error) {
+	escaped := strings.ToLower(u.EscapedPath())
+	decoded := strings.ToLower(u.Path)
+	switch {
+	case strings.Contains(escaped, "%2f"), strings.Contains(escaped, "%5c"), strings.Contains(decoded, `\`):
+		return "", &AccessDeniedError{
+			Reason:  "encoded path separator",
+			Details: "Paths with encoded slashes or backslashes are refused by the web access policy of this asset.",
+		}
+	case strings.Contains(decoded, "%2e"), strings.Contains(decoded, "%2f"), strings.Contains(decoded, "%5c"):
+		return "", &AccessDeniedError{
+			Reason:  "double encoded path",
+			Details: "Paths encoded twice are refused by the web access policy of this asset.",
+		}
+	}
+
+	segments := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
+	for i, segment := range segments {
+		segments[i], _, _ = strings.Cut(segment, ";")
+	}
+	p := "/" + strings.Join(segments, "/")
+
+	// Clean drops the trailing slash, which is a different resource
+	cleaned := gopath.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	if cleaned != p {
+		return "", &AccessDeniedError{
+			Reason:  fmt.Sprintf("path '%s' is not canonical", u.Path),
+			Details: "Paths with '.', '..' or empty segments are refused by the web access policy of this asset.",
+		}
+	}
+	return cleaned, nil
+}
+
+// matchPathRule tells whether a path matches a rule, rules with invalid patterns never match
+func matchPathRule(rule *model.WebPathRule, path string) bool {
+	key := rule.PatternType + ":" + rule.Pattern
+	if v, ok := pathPatterns.Load(key); ok {
+		re, _ := v.(*regexp.Regexp)
+		return re != nil && re.MatchString(path)
+	}
+
+	re, err := rule.Regexp()
+	if err != nil {
+		logger.L().Warn("Invalid web path rule pattern", zap.String("pattern", rule.Pattern), zap.Error(err))
+	}
+	pathPatterns.Store(key, re)
+	return re != nil && re.MatchString(path)
+}
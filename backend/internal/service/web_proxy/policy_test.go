@@ -0,0 +1,143 @@
+package web_proxy
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/veops/oneterm/internal/model"
+)
+
+func TestPolicyPath(t *testing.T) {
+	tests := []struct {
+		name       string
+		rawURL     string
+		want       string
+		wantReason string
+	}{
+		{name: "root", rawURL: "http://asset/", want: "/"},
+		{name: "plain", rawURL: "http://asset/admin/users?id=1", want: "/admin/users"},
+		{name: "trailing slash kept", rawURL: "http://asset/admin/", want: "/admin/"},
+		{name: "encoded letters decoded", rawURL: "http://asset/%61dmin", want: "/admin"},
+		{name: "path parameters dropped", rawURL: "http://asset/app;jsessionid=ABC/page;v=1", want: "/app/page"},
+		{name: "path parameter on the last segment", rawURL: "http://asset/login;jsessionid=ABC", want: "/login"},
+		{name: "encoded slash", rawURL: "http://asset/admin%2fusers", wantReason: "encoded path separator"},
+		{name: "encoded slash upper case", rawURL: "http://asset/admin%2Fusers", wantReason: "encoded path separator"},
+		{name: "encoded backslash", rawURL: "http://asset/admin%5Cusers", wantReason: "encoded path separator"},
+		{name: "backslash", rawURL: `http://asset/admin\users`, wantReason: "encoded path separator"},
+		{name: "double encoded slash", rawURL: "http://asset/admin%252fusers", wantReason: "double encoded path"},
+		{name: "double encoded dot", rawURL: "http://asset/public/%252e%252e/admin", wantReason: "double encoded path"},
+		{name: "double encoded backslash", rawURL: "http://asset/admin%255Cusers", wantReason: "double encoded path"},
+		{name: "dot dot", rawURL: "http://asset/public/../admin", wantReason: "path '/public/../admin' is not canonical"},
+		{name: "encoded dot dot", rawURL: "http://asset/public/%2e%2e/admin", wantReason: "path '/public/../admin' is not canonical"},
+		{name: "dot", rawURL: "http://asset/./admin", wantReason: "path '/./admin' is not canonical"},
+		{name: "dot dot behind a path parameter", rawURL: "http://asset/public/..;x=1/admin", wantReason: "path '/public/..;x=1/admin' is not canonical"},
+		{name: "empty segment", rawURL: "http://asset/public//admin", wantReason: "path '/public//admin' is not canonical"},
+		{name: "double trailing slash", rawURL: "http://asset/admin//", wantReason: "path '/admin//' is not canonical"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.rawURL)
+			if err != nil {
+				t.Fatalf("url.Parse(%q) error = %v", tt.rawURL, err)
+			}
+			got, err := policyPath(u)
+			if tt.wantReason != "" {
+				var denied *AccessDeniedError
+				if !errors.As(err, &denied) || denied.Reason != tt.wantReason {
+					t.Fatalf("policyPath() = %q, %v, want reason %q", got, err, tt.wantReason)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("policyPath() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchPathRule(t *testing.T) {
+	tests := []struct {
+		name string
+		rule model.WebPathRule
+		path string
+		want bool
+	}{
+		{name: "glob exact", rule: model.WebPathRule{Pattern: "/admin"}, path: "/admin", want: true},
+		{name: "glob anchored at the start", rule: model.WebPathRule{Pattern: "/admin"}, path: "/public/admin", want: false},
+		{name: "glob anchored at the end", rule: model.WebPathRule{Pattern: "/admin"}, path: "/admin/users", want: false},
+		{name: "glob trailing slash is a different path", rule: model.WebPathRule{Pattern: "/admin"}, path: "/admin/", want: false},
+		{name: "glob star in one segment", rule: model.WebPathRule{Pattern: "/admin/*"}, path: "/admin/users", want: true},
+		{name: "glob star stops at a slash", rule: model.WebPathRule{Pattern: "/admin/*"}, path: "/admin/users/1", want: false},
+		{name: "glob star matches empty", rule: model.WebPathRule{Pattern: "/admin/*"}, path: "/admin/", want: true},
+		{name: "glob double star", rule: model.WebPathRule{Pattern: "/admin/**"}, path: "/admin/users/1", want: true},
+		{name: "glob question mark", rule: model.WebPathRule{Pattern: "/v?/api"}, path: "/v2/api", want: true},
+		{name: "glob question mark is not a slash", rule: model.WebPathRule{Pattern: "/v?api"}, path: "/v/api", want: false},
+		{name: "glob meta characters are literal", rule: model.WebPathRule{Pattern: "/a.b(c)"}, path: "/a.b(c)", want: true},
+		{name: "glob dot is not any character", rule: model.WebPathRule{Pattern: "/a.b"}, path: "/axb", want: false},
+		{name: "regex anchored at the start", rule: model.WebPathRule{Pattern: "/admin.*", PatternType: model.WebPathPatternRegex}, path: "/public/admin", want: false},
+		{name: "regex anchored at the end", rule: model.WebPathRule{Pattern: "/admin", PatternType: model.WebPathPatternRegex}, path: "/admin/users", want: false},
+		{name: "regex whole path", rule: model.WebPathRule{Pattern: "/admin(/.*)?", PatternType: model.WebPathPatternRegex}, path: "/admin/users", want: true},
+		{name: "regex alternation anchored", rule: model.WebPathRule{Pattern: "/a|/b", PatternType: model.WebPathPatternRegex}, path: "/b/c", want: false},
+		{name: "regex invalid never matches", rule: model.WebPathRule{Pattern: "/admin(", PatternType: model.WebPathPatternRegex}, path: "/admin(", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Twice, the second time from the compiled pattern cache
+			for i := 0; i < 2; i++ {
+				if got := matchPathRule(&tt.rule, tt.path); got != tt.want {
+					t.Errorf("matchPathRule(%q, %q) = %v, want %v", tt.rule.Pattern, tt.path, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckWebAccessPolicy(t *testing.T) {
+	session := &WebProxySession{
+		SessionId:  "test",
+		AuthRuleId: 2,
+		WebConfig: &model.WebConfig{ProxySettings: &model.WebProxySettings{
+			AllowedMethods: []string{"GET", "POST"},
+			PathRules: []model.WebPathRule{
+				{Action: model.WebPathRuleDeny, Pattern: "/app/admin/**"},
+				{Action: model.WebPathRuleDeny, Pattern: "/app/reports", Methods: []string{"POST"}},
+				{Action: model.WebPathRuleDeny, Pattern: "/app/billing/**", AuthRuleIds: []int{1}},
+				{Action: model.WebPathRuleAllow, Pattern: "/app/**"},
+			},
+		}},
+	}
+	tests := []struct {
+		name    string
+		method  string
+		rawURL  string
+		allowed bool
+	}{
+		{name: "allowed", method: "GET", rawURL: "http://asset/app/home", allowed: true},
+		{name: "method not allowed", method: "DELETE", rawURL: "http://asset/app/home", allowed: false},
+		{name: "denied", method: "GET", rawURL: "http://asset/app/admin/users", allowed: false},
+		{name: "denied behind a path parameter", method: "GET", rawURL: "http://asset/app;jsessionid=1/admin/users", allowed: false},
+		{name: "denied behind an encoded slash", method: "GET", rawURL: "http://asset/app/admin%2fusers", allowed: false},
+		{name: "denied behind a dot segment", method: "GET", rawURL: "http://asset/app/home/../admin/users", allowed: false},
+		{name: "deny rule of another method", method: "GET", rawURL: "http://asset/app/reports", allowed: true},
+		{name: "deny rule of the method", method: "POST", rawURL: "http://asset/app/reports", allowed: false},
+		{name: "deny rule of another authorization rule", method: "GET", rawURL: "http://asset/app/billing/1", allowed: true},
+		{name: "outside the allow rules", method: "GET", rawURL: "http://asset/other", allowed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.rawURL)
+			if err != nil {
+				t.Fatalf("url.Parse(%q) error = %v", tt.rawURL, err)
+			}
+			err = CheckWebAccessPolicy(session, tt.method, u)
+			var denied *AccessDeniedError
+			if tt.allowed && err != nil {
+				t.Errorf("CheckWebAccessPolicy() error = %v, want allowed", err)
+			}
+			if !tt.allowed && !errors.As(err, &denied) {
+				t.Errorf("CheckWebAccessPolicy() error = %v, want AccessDeniedError", err)
+			}
+		})
+	}
+}
@@ -115,10 +115,28 @@ func StartWebSession(ctx *gin.Context, req StartWebSessionRequest) (*StartWebSes
 	// Get initial target host from asset
 	initialHost := GetAssetHost(asset)
 
+	// Path rules may be limited to the sessions allowed by some authorization rules
+	authRuleId := 0
+	if connectResult := result.GetResult(model.ActionConnect); connectResult != nil {
+		authRuleId = connectResult.RuleId
+	}
+
+	currentUser, _ := acl.GetSessionFromCtx(ctx)
+	watermark := service.RenderWatermark(result.GetResult(model.ActionConnect), service.WatermarkData{
+		User:      currentUser.GetUserName(),
+		Uid:       currentUser.GetUid(),
+		ClientIp:  ctx.ClientIP(),
+		SessionId: sessionId,
+		Asset:     asset.Name,
+		AssetId:   asset.Id,
+	})
+
 	webSession := &WebProxySession{
 		SessionId:     sessionId,
 		AssetId:       asset.Id,
 		AccountId:     req.AccountId,
+		Uid:           currentUser.GetUid(),
+		UserName:      currentUser.GetUserName(),
 		Asset:         asset,
 		CreatedAt:     now,
 		LastActivity:  now,
@@ -127,8 +145,14 @@ func StartWebSession(ctx *gin.Context, req StartWebSessionRequest) (*StartWebSes
 		CurrentHost:   initialHost,
 		Permissions:   permissions,
 		WebConfig:     asset.WebConfig,
+		Watermark:     watermark,
+		AuthRuleId:    authRuleId,
 	}
 	StoreSession(sessionId, webSession)
+	// The proxy logs in for the user, the login accounts never reach the browser
+	if asset.WebConfig != nil && asset.WebConfig.AuthMode == model.WebAuthModeSmart {
+		StartUpstreamLogin(webSession, BuildTargetURL(asset))
+	}
 
 	// Generate subdomain-based proxy URL
 	baseDomain := strings.Split(ctx.Request.Host, ":")[0]
@@ -152,8 +176,6 @@ func StartWebSession(ctx *gin.Context, req StartWebSessionRequest) (*StartWebSes
 	proxyURL := fmt.Sprintf("%s://%s/?session_id=%s", scheme, subdomainHost, sessionId)
 
 	// Create database session record for history (same as other protocols)
-	currentUser, _ := acl.GetSessionFromCtx(ctx)
-
 	// Get actual protocol from asset
 	protocol, port := asset.GetWebProtocol()
 	if protocol == "" {
@@ -178,6 +200,7 @@ func StartWebSession(ctx *gin.Context, req StartWebSessionRequest) (*StartWebSes
 		ClientIp:    ctx.ClientIP(),
 		Protocol:    protocolStr, // Now shows "http:80" or "https:443" etc.
 		Status:      model.SESSIONSTATUS_ONLINE,
+		AuthRuleId:  authRuleId,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
@@ -320,24 +343,25 @@ func CheckWebAccessControls(ctx *gin.Context, session *WebProxySession) error {
 	if session.WebConfig != nil && session.WebConfig.AccessPolicy == "read_only" {
 		method := strings.ToUpper(ctx.Request.Method)
 		if method != "GET" && method != "HEAD" && method != "OPTIONS" {
-			return fmt.Errorf("read-only access mode - %s method not allowed", method)
+			return &AccessDeniedError{
+				Reason:  fmt.Sprintf("read-only access mode - %s method not allowed", method),
+				Details: "This asset is configured for read-only access.",
+			}
 		}
 	}
 
-	// Check blocked paths
-	if session.WebConfig != nil && session.WebConfig.ProxySettings != nil && len(session.WebConfig.ProxySettings.BlockedPaths) > 0 {
-		requestPath := ctx.Request.URL.Path
-		for _, blockedPath := range session.WebConfig.ProxySettings.BlockedPaths {
-			if strings.Contains(requestPath, blockedPath) {
-				return fmt.Errorf("access to path '%s' is blocked", requestPath)
-			}
-		}
+	// Check allowed methods and path rules
+	if err := CheckWebAccessPolicy(session, ctx.Request.Method, ctx.Request.URL); err != nil {
+		return err
 	}
 
 	// Check file download permissions
 	if session.Permissions != nil && !session.Permissions.FileDownload {
 		if IsDownloadRequest(ctx) {
-			return fmt.Errorf("file download not permitted")
+			return &AccessDeniedError{
+				Reason:  "file download not permitted",
+				Details: "Your user permissions do not allow file downloads through the web proxy.",
+			}
 		}
 	}
 
@@ -384,12 +408,6 @@ func IsDownloadRequest(ctx *gin.Context) bool {
 	return false
 }
 
-// RecordWebActivity records web session activity for auditing
-func RecordWebActivity(sessionId string, ctx *gin.Context) {
-	// Activity recording logic would go here
-	// This is a placeholder to maintain API compatibility
-}
-
 // ProxyRequestContext holds the context for a proxy request
 type ProxyRequestContext struct {
 	SessionID        string
@@ -523,7 +541,9 @@ func ValidateSessionAndPermissions(ctx *gin.Context, proxyCtx *ProxyRequestConte
 
 	// Only update LastActivity for real user operations (not static resources)
 	if !proxyCtx.IsStaticResource {
-		UpdateSessionActivity(proxyCtx.SessionID)
+		if now.Sub(session.LastActivity) > activityInterval {
+			UpdateSessionActivity(proxyCtx.SessionID)
+		}
 
 		// Auto-renew cookie for user operations
 		cookieMaxAge := int(model.GlobalConfig.Load().Timeout)
@@ -545,7 +565,7 @@ func ValidateSessionAndPermissions(ctx *gin.Context, proxyCtx *ProxyRequestConte
 }
 
 // SetupReverseProxy creates and configures a reverse proxy
-func SetupReverseProxy(ctx *gin.Context, proxyCtx *ProxyRequestContext, buildTargetURLWithHost func(*model.Asset, string) string, processHTMLResponse func(*http.Response, int, string, string, *WebProxySession), recordWebActivity func(*WebProxySession, *http.Request), isSameDomainOrSubdomain func(string, string) bool) (*httputil.ReverseProxy, error) {
+func SetupReverseProxy(ctx *gin.Context, proxyCtx *ProxyRequestContext, buildTargetURLWithHost func(*model.Asset, string) string, processHTMLResponse func(*http.Response, int, string, string, *WebProxySession), isSameDomainOrSubdomain func(string, string) bool) (*httputil.ReverseProxy, error) {
 	targetURL := buildTargetURLWithHost(proxyCtx.Session.Asset, proxyCtx.Session.CurrentHost)
 	target, err := url.Parse(targetURL)
 	if err != nil {
@@ -580,10 +600,14 @@ func SetupReverseProxy(ctx *gin.Context, proxyCtx *ProxyRequestContext, buildTar
 		q := req.URL.Query()
 		q.Del("session_id")
 		req.URL.RawQuery = q.Encode()
+
+		InjectCredentials(proxyCtx.Session, req)
 	}
 
 	// Redirect interception for bastion control
 	proxy.ModifyResponse = func(resp *http.Response) error {
+		StoreUpstreamCookies(proxyCtx.Session, resp)
+
 		// Check file download permissions based on response headers
 		contentDisposition := resp.Header.Get("Content-Disposition")
 		contentType := resp.Header.Get("Content-Type")
@@ -618,11 +642,6 @@ func SetupReverseProxy(ctx *gin.Context, proxyCtx *ProxyRequestContext, buildTar
 			processHTMLResponse(resp, proxyCtx.AssetID, currentScheme, proxyCtx.Host, proxyCtx.Session)
 		}
 
-		// Record activity if enabled
-		if proxyCtx.Session.WebConfig != nil && proxyCtx.Session.WebConfig.ProxySettings != nil && proxyCtx.Session.WebConfig.ProxySettings.RecordingEnabled {
-			recordWebActivity(proxyCtx.Session, ctx.Request)
-		}
-
 		if resp.StatusCode >= 300 && resp.StatusCode < 400 {
 			location := resp.Header.Get("Location")
 			if location != "" {
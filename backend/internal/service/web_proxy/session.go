@@ -2,6 +2,7 @@ package web_proxy
 
 import (
 	"context"
+	"net/http"
 	"sync"
 	"time"
 
@@ -13,8 +14,9 @@ import (
 	"github.com/veops/oneterm/pkg/logger"
 )
 
-// Global session storage
-var webProxySessions = make(map[string]*WebProxySession)
+// activityInterval is how stale LastActivity gets before a request refreshes it, every write is a transaction
+// with the redis store
+const activityInterval = 10 * time.Second
 
 // Global cleanup context
 var (
@@ -28,14 +30,22 @@ type WebProxySession struct {
 	SessionId     string
 	AssetId       int
 	AccountId     int
-	Asset         *model.Asset
+	Uid           int
+	UserName      string
+	Asset         *model.Asset `json:"-"` // Resolved from the asset by the redis store, its credentials are never stored
 	CreatedAt     time.Time
 	LastActivity  time.Time
 	LastHeartbeat time.Time // Track heartbeat separately
 	IsActive      bool      // Active for concurrent control (heartbeat-based)
 	CurrentHost   string
 	Permissions   *model.AuthPermissions // User permissions for this asset
-	WebConfig     *model.WebConfig       // Web-specific configuration
+	WebConfig     *model.WebConfig       `json:"-"` // Web-specific configuration, resolved with the asset
+	Watermark     string                 // Watermark of the user with {time} left to fill in, empty when disabled
+	AuthRuleId    int                    // Authorization rule that allowed the session, 0 for admins and shares
+
+	// Cookie jar and headers of the upstream login, kept on the server and encrypted by the redis store
+	UpstreamCookies []*http.Cookie    `json:"-"`
+	UpstreamHeaders map[string]string `json:"-"`
 }
 
 // cleanupExpiredSessions implements layered timeout mechanism
@@ -49,25 +59,20 @@ func cleanupExpiredSessions(maxInactiveTime time.Duration) {
 
 	// Layer 2: Session expiry timeout (slow, system config)
 
-	for sessionID, session := range webProxySessions {
+	for _, session := range sessionStore.List() {
 		// Layer 1: Check heartbeat for concurrent control
 		if session.IsActive && !session.LastHeartbeat.IsZero() &&
 			now.Sub(session.LastHeartbeat) > heartbeatTimeout {
 			// Deactivate session (release concurrent slot AND mark as offline)
-			session.IsActive = false
-			UpdateWebSessionStatus(sessionID, model.SESSIONSTATUS_OFFLINE)
+			sessionStore.Update(session.SessionId, func(s *WebProxySession) { s.IsActive = false })
+			UpdateWebSessionStatus(session.SessionId, model.SESSIONSTATUS_OFFLINE)
 			deactivatedCount++
 		}
 
 		// Layer 2: Check session expiry for final cleanup
-		shouldDelete := false
 		if now.Sub(session.LastActivity) > maxInactiveTime {
-			shouldDelete = true
-		}
-
-		if shouldDelete {
 			// No need to update status again - already done in Layer 1
-			delete(webProxySessions, sessionID)
+			sessionStore.Delete(session.SessionId)
 			cleanedCount++
 		}
 	}
@@ -81,6 +86,8 @@ func cleanupExpiredSessions(maxInactiveTime time.Duration) {
 
 // StartSessionCleanupRoutine starts background cleanup routine for web sessions
 func StartSessionCleanupRoutine() {
+	InitSessionStore()
+
 	// Initialize cleanup context
 	cleanupCtx, cleanupCancel = context.WithCancel(context.Background())
 	
@@ -114,52 +121,53 @@ func StopSessionCleanupRoutine() {
 	}
 }
 
-// GetSession retrieves a session by ID
+// GetSession retrieves a copy of a session by ID
 func GetSession(sessionID string) (*WebProxySession, bool) {
-	session, exists := webProxySessions[sessionID]
-	return session, exists
+	return sessionStore.Get(sessionID)
 }
 
-// StoreSession stores a session in the session map
+// StoreSession stores a session in the session store
 func StoreSession(sessionID string, session *WebProxySession) {
-	webProxySessions[sessionID] = session
+	session.SessionId = sessionID
+	sessionStore.Set(session)
 }
 
-// DeleteSession removes a session from the session map
+// DeleteSession removes a session from the session store
 func DeleteSession(sessionID string) {
-	delete(webProxySessions, sessionID)
+	sessionStore.Delete(sessionID)
 }
 
 // UpdateSessionActivity updates the last activity time for a session
 func UpdateSessionActivity(sessionID string) {
-	if session, exists := webProxySessions[sessionID]; exists {
+	sessionStore.Update(sessionID, func(session *WebProxySession) {
 		session.LastActivity = time.Now()
-	}
+	})
 }
 
 // UpdateSessionHeartbeat updates the last heartbeat time for a session
 func UpdateSessionHeartbeat(sessionID string) {
-	if session, exists := webProxySessions[sessionID]; exists {
+	wasInactive := false
+	exists := sessionStore.Update(sessionID, func(session *WebProxySession) {
 		now := time.Now()
-		wasInactive := !session.IsActive
+		wasInactive = !session.IsActive
 
 		session.LastHeartbeat = now
 		session.IsActive = true // Re-activate session on heartbeat
 		// Heartbeat also counts as activity (user is still viewing the page)
 		session.LastActivity = now
+	})
 
-		// If session was previously inactive, mark it as online again
-		if wasInactive {
-			UpdateWebSessionStatus(sessionID, model.SESSIONSTATUS_ONLINE)
-		}
+	// If session was previously inactive, mark it as online again
+	if exists && wasInactive {
+		UpdateWebSessionStatus(sessionID, model.SESSIONSTATUS_ONLINE)
 	}
 }
 
 // UpdateSessionHost updates the current host for a session
 func UpdateSessionHost(sessionID string, host string) {
-	if session, exists := webProxySessions[sessionID]; exists {
+	sessionStore.Update(sessionID, func(session *WebProxySession) {
 		session.CurrentHost = host
-	}
+	})
 }
 
 // GetActiveSessionsForAsset returns the number of active sessions for an asset
@@ -169,7 +177,7 @@ func GetActiveSessionsForAsset(assetID int) int {
 	cleanupExpiredSessions(systemTimeout)
 
 	count := 0
-	for _, session := range webProxySessions {
+	for _, session := range sessionStore.List() {
 		if session.AssetId == assetID && session.IsActive {
 			count++
 		}
@@ -177,19 +185,23 @@ func GetActiveSessionsForAsset(assetID int) int {
 	return count
 }
 
-// GetAllSessions returns all active sessions
+// GetAllSessions returns copies of all sessions by ID
 func GetAllSessions() map[string]*WebProxySession {
-	return webProxySessions
+	sessions := make(map[string]*WebProxySession)
+	for _, session := range sessionStore.List() {
+		sessions[session.SessionId] = session
+	}
+	return sessions
 }
 
 // CountActiveSessions returns the total number of active sessions
 func CountActiveSessions() int {
-	return len(webProxySessions)
+	return len(sessionStore.List())
 }
 
 // CloseWebSession closes and removes a session
 func CloseWebSession(sessionID string) {
-	if session, exists := webProxySessions[sessionID]; exists {
+	if session, exists := sessionStore.Get(sessionID); exists {
 		logger.L().Info("Closing web session",
 			zap.String("sessionID", sessionID),
 			zap.Int("assetID", session.AssetId),
@@ -198,7 +210,7 @@ func CloseWebSession(sessionID string) {
 		// Update database session record to offline status
 		UpdateWebSessionStatus(sessionID, model.SESSIONSTATUS_OFFLINE)
 
-		delete(webProxySessions, sessionID)
+		sessionStore.Delete(sessionID)
 	}
 }
 
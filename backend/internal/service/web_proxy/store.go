@@ -0,0 +1,321 @@
+package web_proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/internal/service"
+	"github.com/veops/oneterm/pkg/cache"
+	"github.com/veops/oneterm/pkg/config"
+	"github.com/veops/oneterm/pkg/logger"
+	"github.com/veops/oneterm/pkg/utils"
+)
+
+// Session store types of the session.webProxyStore config
+const (
+	SessionStoreMemory = "memory"
+	SessionStoreRedis  = "redis"
+)
+
+// SessionStore keeps the web proxy sessions. Sessions are handed out as copies, changes go through Update so
+// concurrent handlers and the cleanup routine never share a session.
+type SessionStore interface {
+	Get(sessionID string) (*WebProxySession, bool)
+	Set(session *WebProxySession)
+	Delete(sessionID string)
+	// Update applies fn to the stored session, false when the session does not exist. The asset of the session
+	// may be unset in fn.
+	Update(sessionID string, fn func(*WebProxySession)) bool
+	// List returns the sessions for bookkeeping, their asset may be unset
+	List() []*WebProxySession
+}
+
+var sessionStore SessionStore = NewMemorySessionStore()
+
+// InitSessionStore selects the session store of the config, redis lets several replicas serve the same sessions
+// and keeps them across restarts
+func InitSessionStore() {
+	switch config.Cfg.Session.WebProxyStore {
+	case SessionStoreRedis:
+		sessionStore = NewRedisSessionStore()
+	default:
+		sessionStore = NewMemorySessionStore()
+	}
+	logger.L().Info("Web proxy session store initialized", zap.String("store", lo.CoalesceOrEmpty(config.Cfg.Session.WebProxyStore, SessionStoreMemory)))
+}
+
+// MemorySessionStore keeps the sessions of a single process
+type MemorySessionStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*WebProxySession
+}
+
+// NewMemorySessionStore creates an empty in-memory store
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]*WebProxySession),
+	}
+}
+
+func (s *MemorySessionStore) Get(sessionID string) (*WebProxySession, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		return nil, false
+	}
+	cp := *session
+	return &cp, true
+}
+
+func (s *MemorySessionStore) Set(session *WebProxySession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cp := *session
+	s.sessions[session.SessionId] = &cp
+}
+
+func (s *MemorySessionStore) Delete(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, sessionID)
+}
+
+func (s *MemorySessionStore) Update(sessionID string, fn func(*WebProxySession)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionID]
+	if ok {
+		fn(session)
+	}
+	return ok
+}
+
+func (s *MemorySessionStore) List() []*WebProxySession {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := make([]*WebProxySession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		cp := *session
+		sessions = append(sessions, &cp)
+	}
+	return sessions
+}
+
+const (
+	redisSessionKeyPrefix = "oneterm:web_proxy:session:"
+	redisSessionIndexKey  = "oneterm:web_proxy:sessions"
+	redisUpdateRetries    = 5
+)
+
+// RedisSessionStore keeps the sessions in redis, a set indexes them for listing. The asset and its web config are
+// not stored, their credentials never reach redis, Get resolves them from the asset.
+type RedisSessionStore struct{}
+
+// NewRedisSessionStore creates a store on the redis of pkg/cache
+func NewRedisSessionStore() *RedisSessionStore {
+	return &RedisSessionStore{}
+}
+
+func (s *RedisSessionStore) key(sessionID string) string {
+	return redisSessionKeyPrefix + sessionID
+}
+
+// ttl outlives the inactivity timeout so the cleanup routine sees sessions expire, redis drops the ones it missed
+func (s *RedisSessionStore) ttl() time.Duration {
+	timeout := time.Hour
+	if cfg := model.GlobalConfig.Load(); cfg != nil && cfg.Timeout > 0 {
+		timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	return timeout * 2
+}
+
+func (s *RedisSessionStore) Get(sessionID string) (*WebProxySession, bool) {
+	ctx := context.Background()
+	session, err := s.get(ctx, sessionID)
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			logger.L().Error("Failed to get web session", zap.String("sessionID", sessionID), zap.Error(err))
+		}
+		return nil, false
+	}
+
+	asset, err := service.NewAssetService().GetById(ctx, session.AssetId)
+	if err != nil {
+		logger.L().Error("Failed to get asset of web session", zap.String("sessionID", sessionID), zap.Int("assetID", session.AssetId), zap.Error(err))
+		return nil, false
+	}
+	session.Asset, session.WebConfig = asset, asset.WebConfig
+	return session, true
+}
+
+func (s *RedisSessionStore) get(ctx context.Context, sessionID string) (*WebProxySession, error) {
+	stored := &redisSession{}
+	if err := cache.Get(ctx, s.key(sessionID), stored); err != nil {
+		return nil, err
+	}
+	return stored.session()
+}
+
+func (s *RedisSessionStore) Set(session *WebProxySession) {
+	ctx := context.Background()
+	stored, err := newRedisSession(session)
+	if err == nil {
+		err = cache.SetEx(ctx, s.key(session.SessionId), stored, s.ttl())
+	}
+	if err != nil {
+		logger.L().Error("Failed to store web session", zap.String("sessionID", session.SessionId), zap.Error(err))
+		return
+	}
+	if err := cache.RC.SAdd(ctx, redisSessionIndexKey, session.SessionId).Err(); err != nil {
+		logger.L().Error("Failed to index web session", zap.String("sessionID", session.SessionId), zap.Error(err))
+	}
+}
+
+func (s *RedisSessionStore) Delete(sessionID string) {
+	ctx := context.Background()
+	if err := cache.RC.Del(ctx, s.key(sessionID)).Err(); err != nil {
+		logger.L().Error("Failed to delete web session", zap.String("sessionID", sessionID), zap.Error(err))
+	}
+	if err := cache.RC.SRem(ctx, redisSessionIndexKey, sessionID).Err(); err != nil {
+		logger.L().Error("Failed to unindex web session", zap.String("sessionID", sessionID), zap.Error(err))
+	}
+}
+
+// Update reads, changes and writes the session in a transaction watching its key, retried when another replica
+// changed it in between
+func (s *RedisSessionStore) Update(sessionID string, fn func(*WebProxySession)) bool {
+	ctx := context.Background()
+	key := s.key(sessionID)
+
+	for i := 0; i < redisUpdateRetries; i++ {
+		found := false
+		err := cache.RC.Watch(ctx, func(tx *redis.Tx) error {
+			bs, err := tx.Get(ctx, key).Bytes()
+			if errors.Is(err, redis.Nil) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			stored := &redisSession{}
+			if err = json.Unmarshal(bs, stored); err != nil {
+				return err
+			}
+			session, err := stored.session()
+			if err != nil {
+				return err
+			}
+			found = true
+			fn(session)
+			if stored, err = newRedisSession(session); err != nil {
+				return err
+			}
+			if bs, err = json.Marshal(stored); err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.SetEx(ctx, key, bs, s.ttl())
+				return nil
+			})
+			return err
+		}, key)
+		if errors.Is(err, redis.TxFailedErr) {
+			continue
+		}
+		if err != nil {
+			logger.L().Error("Failed to update web session", zap.String("sessionID", sessionID), zap.Error(err))
+			return false
+		}
+		return found
+	}
+
+	logger.L().Warn("Web session kept changing, update given up", zap.String("sessionID", sessionID))
+	return false
+}
+
+func (s *RedisSessionStore) List() []*WebProxySession {
+	ctx := context.Background()
+	ids, err := cache.RC.SMembers(ctx, redisSessionIndexKey).Result()
+	if err != nil {
+		logger.L().Error("Failed to list web sessions", zap.Error(err))
+		return nil
+	}
+
+	sessions := make([]*WebProxySession, 0, len(ids))
+	for _, id := range ids {
+		session, err := s.get(ctx, id)
+		if errors.Is(err, redis.Nil) {
+			// Expired in redis without going through the cleanup
+			if err = cache.RC.SRem(ctx, redisSessionIndexKey, id).Err(); err != nil {
+				logger.L().Error("Failed to unindex web session", zap.String("sessionID", id), zap.Error(err))
+			}
+			continue
+		}
+		if err != nil {
+			logger.L().Error("Failed to get web session", zap.String("sessionID", id), zap.Error(err))
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// redisSession is the stored form of a session, the cookies and headers of the upstream login are encrypted
+type redisSession struct {
+	WebProxySession
+	Upstream string `json:",omitempty"`
+}
+
+type upstreamLogin struct {
+	Cookies []*http.Cookie
+	Headers map[string]string
+}
+
+func newRedisSession(session *WebProxySession) (*redisSession, error) {
+	stored := &redisSession{WebProxySession: *session}
+	if len(session.UpstreamCookies) == 0 && len(session.UpstreamHeaders) == 0 {
+		return stored, nil
+	}
+	bs, err := json.Marshal(upstreamLogin{Cookies: session.UpstreamCookies, Headers: session.UpstreamHeaders})
+	if err != nil {
+		return nil, err
+	}
+	stored.Upstream = utils.EncryptAES(string(bs))
+	return stored, nil
+}
+
+func (r *redisSession) session() (session *WebProxySession, err error) {
+	session = &r.WebProxySession
+	if r.Upstream == "" {
+		return session, nil
+	}
+
+	// DecryptAES panics on a ciphertext it did not write
+	defer func() {
+		if e := recover(); e != nil {
+			session, err = nil, fmt.Errorf("failed to decrypt upstream login: %v", e)
+		}
+	}()
+	login := upstreamLogin{}
+	if err = json.Unmarshal([]byte(utils.DecryptAES(r.Upstream)), &login); err != nil {
+		return nil, fmt.Errorf("failed to decrypt upstream login: %w", err)
+	}
+	session.UpstreamCookies, session.UpstreamHeaders = login.Cookies, login.Headers
+	return session, nil
+}
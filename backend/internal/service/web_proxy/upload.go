@@ -0,0 +1,291 @@
+package web_proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+
+	"github.com/veops/oneterm/internal/model"
+	fileservice "github.com/veops/oneterm/internal/service/file"
+	"github.com/veops/oneterm/pkg/config"
+	"github.com/veops/oneterm/pkg/logger"
+)
+
+const (
+	// defaultUploadBodyLimit caps a multipart body when session.webUploadBodyLimit is unset
+	defaultUploadBodyLimit = 1 << 30
+	// maxUploadField caps a form field of a multipart body that is not a file
+	maxUploadField = 10 << 20
+)
+
+var (
+	// filenameParam finds a filename parameter in a Content-Disposition, RFC 2231 forms included
+	filenameParam = regexp.MustCompile(`(?i);\s*filename(\*[0-9]*\*?)?\s*=`)
+	// filenameCharset finds the charset of an RFC 2231 encoded filename, continuations included
+	filenameCharset = regexp.MustCompile(`(?i);\s*filename\*(?:0\*|\*)\s*=\s*"?([^']*)'`)
+)
+
+// UploadedFile is a file of a multipart request
+type UploadedFile struct {
+	Field    string
+	Filename string
+	Size     int64
+	Hash     string
+}
+
+// IsUploadRequest tells whether a request carries a multipart body. A file sent as the raw body of a request is
+// not an upload to the proxy, the upload permission and limits do not apply to it.
+func IsUploadRequest(req *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return strings.HasPrefix(mediaType, "multipart/")
+}
+
+// InspectUpload checks the upload permission and the upload limits of the asset against the files of a multipart
+// request. The body is spooled to a temporary file while it is read, and put back for the proxy once every file
+// passed, cleanup removes the file after the request. Only multipart bodies are inspected, see IsUploadRequest.
+func InspectUpload(session *WebProxySession, req *http.Request) (files []UploadedFile, cleanup func(), err error) {
+	cleanup = func() {}
+	if !IsUploadRequest(req) || req.Body == nil {
+		return nil, cleanup, nil
+	}
+	if session.Permissions != nil && !session.Permissions.FileUpload {
+		return nil, cleanup, &AccessDeniedError{
+			Reason:  "file upload not permitted",
+			Details: "Your user permissions do not allow file uploads through the web proxy.",
+		}
+	}
+
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return nil, cleanup, &AccessDeniedError{
+			Reason:  "malformed upload",
+			Details: "The upload has no multipart boundary and cannot be inspected.",
+		}
+	}
+
+	limit := lo.Ternary(config.Cfg.Session.WebUploadBodyLimit > 0, config.Cfg.Session.WebUploadBodyLimit, defaultUploadBodyLimit)
+	if req.ContentLength > limit {
+		return nil, cleanup, &AccessDeniedError{
+			Reason:  "upload is too large",
+			Details: fmt.Sprintf("Uploads through the web proxy are limited to %d bytes.", limit),
+		}
+	}
+
+	spool, err := os.CreateTemp("", "oneterm-web-upload-*")
+	if err != nil {
+		return nil, cleanup, fmt.Errorf("failed to spool upload: %w", err)
+	}
+	cleanup = func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+
+	body := io.TeeReader(io.LimitReader(req.Body, limit+1), spool)
+	files, err = inspectParts(session, multipart.NewReader(body, params["boundary"]))
+	if err == nil {
+		// The epilogue after the last part goes to the target too
+		_, err = io.Copy(io.Discard, body)
+	}
+	// A body over the limit is cut short, whatever the parts made of it
+	size, seekErr := spool.Seek(0, io.SeekCurrent)
+	if err == nil {
+		err = seekErr
+	}
+	if seekErr == nil && size > limit {
+		err = &AccessDeniedError{
+			Reason:  "upload is too large",
+			Details: fmt.Sprintf("Uploads through the web proxy are limited to %d bytes.", limit),
+		}
+	}
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		var denied *AccessDeniedError
+		if errors.As(err, &denied) {
+			logger.L().Warn("Web upload denied",
+				zap.String("sessionId", session.SessionId),
+				zap.Int("assetId", session.AssetId),
+				zap.String("path", req.URL.Path),
+				zap.String("reason", denied.Reason))
+			return nil, func() {}, err
+		}
+		return nil, func() {}, fmt.Errorf("failed to inspect upload: %w", err)
+	}
+
+	req.Body.Close()
+	req.Body = io.NopCloser(spool)
+	req.ContentLength = size
+	req.TransferEncoding = nil
+	req.Header.Set("Content-Length", strconv.FormatInt(size, 10))
+	return files, cleanup, nil
+}
+
+// inspectParts hashes the files of a multipart body, a file over the limits or a part the target may read another
+// way than the proxy ends the inspection
+func inspectParts(session *WebProxySession, reader *multipart.Reader) ([]UploadedFile, error) {
+	var settings model.WebProxySettings
+	if session.WebConfig != nil && session.WebConfig.ProxySettings != nil {
+		settings = *session.WebConfig.ProxySettings
+	}
+
+	files := make([]UploadedFile, 0)
+	for {
+		// Raw parts keep the bytes the target receives, the hash matches the stored file
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		filename, isFile, err := partFilename(part)
+		if err != nil {
+			return nil, err
+		}
+		if !isFile {
+			n, err := io.Copy(io.Discard, io.LimitReader(part, maxUploadField+1))
+			if err != nil {
+				return nil, err
+			}
+			if n > maxUploadField {
+				return nil, &AccessDeniedError{
+					Reason:  fmt.Sprintf("form field '%s' is too large", part.FormName()),
+					Details: fmt.Sprintf("Form fields of uploads are limited to %d bytes.", maxUploadField),
+				}
+			}
+			continue
+		}
+
+		file := UploadedFile{
+			Field:    part.FormName(),
+			Filename: filename,
+		}
+
+		h := sha256.New()
+		src := io.Reader(part)
+		if settings.MaxUploadSize > 0 {
+			src = io.LimitReader(part, settings.MaxUploadSize+1)
+		}
+		if file.Size, err = io.Copy(h, src); err != nil {
+			return nil, err
+		}
+		if settings.MaxUploadSize > 0 && file.Size > settings.MaxUploadSize {
+			return nil, &AccessDeniedError{
+				Reason:  fmt.Sprintf("file '%s' is too large", file.Filename),
+				Details: fmt.Sprintf("Files uploaded to this asset are limited to %d bytes.", settings.MaxUploadSize),
+			}
+		}
+		// An empty file input of a form
+		if file.Filename == "" && file.Size == 0 {
+			continue
+		}
+		if err = checkUploadExtension(&settings, file.Filename); err != nil {
+			return nil, err
+		}
+		file.Hash = hex.EncodeToString(h.Sum(nil))
+		files = append(files, file)
+	}
+}
+
+// partFilename reads the filename of a part from its Content-Disposition. A disposition that does not parse or a
+// filename that does not resolve is refused, the target may still read a file name from it.
+func partFilename(part *multipart.Part) (string, bool, error) {
+	disposition := part.Header.Get("Content-Disposition")
+	if disposition == "" {
+		return "", false, nil
+	}
+
+	malformed := &AccessDeniedError{
+		Reason:  "malformed upload",
+		Details: "A part of the upload has a Content-Disposition that cannot be inspected.",
+	}
+	_, params, err := mime.ParseMediaType(disposition)
+	if err != nil {
+		return "", false, malformed
+	}
+	// The parser drops encoded segments in a charset it does not decode and keeps the others
+	for _, m := range filenameCharset.FindAllStringSubmatch(disposition, -1) {
+		if !strings.EqualFold(m[1], "utf-8") && !strings.EqualFold(m[1], "us-ascii") {
+			return "", false, malformed
+		}
+	}
+	filename, ok := params["filename"]
+	if !ok {
+		// An encoded filename* in an unknown charset is dropped by the parser
+		if filenameParam.MatchString(disposition) {
+			return "", false, malformed
+		}
+		return "", false, nil
+	}
+
+	filename = strings.ReplaceAll(filename, `\`, "/")
+	if filename != "" {
+		filename = path.Base(filename)
+	}
+	return filename, true, nil
+}
+
+func checkUploadExtension(settings *model.WebProxySettings, filename string) error {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(filename), "."))
+	matches := func(exts []string) bool {
+		return lo.ContainsBy(exts, func(e string) bool { return strings.EqualFold(strings.TrimPrefix(e, "."), ext) })
+	}
+
+	if matches(settings.BlockedUploadExtensions) {
+		return &AccessDeniedError{
+			Reason:  fmt.Sprintf("upload of '%s' is blocked", filename),
+			Details: fmt.Sprintf("Files with the extension '%s' cannot be uploaded to this asset.", ext),
+		}
+	}
+	if len(settings.AllowedUploadExtensions) > 0 && !matches(settings.AllowedUploadExtensions) {
+		return &AccessDeniedError{
+			Reason:  fmt.Sprintf("upload of '%s' is not allowed", filename),
+			Details: fmt.Sprintf("Allowed extensions: %s", strings.Join(settings.AllowedUploadExtensions, ", ")),
+		}
+	}
+	return nil
+}
+
+// RecordWebUploads adds the files of an upload to the file history of the session once the response was written,
+// with the status the target answered
+func RecordWebUploads(session *WebProxySession, ctx *gin.Context, files []UploadedFile) {
+	for _, file := range files {
+		history := &model.FileHistory{
+			Uid:       session.Uid,
+			UserName:  session.UserName,
+			AssetId:   session.AssetId,
+			AccountId: session.AccountId,
+			ClientIp:  ctx.ClientIP(),
+			Action:    model.FILE_ACTION_UPLOAD,
+			Dir:       ctx.Request.URL.Path,
+			Filename:  file.Filename,
+			SessionId: session.SessionId,
+			Size:      file.Size,
+			Hash:      file.Hash,
+			Status:    ctx.Writer.Status(),
+		}
+		if err := fileservice.DefaultFileService.AddFileHistory(context.Background(), history); err != nil {
+			logger.L().Error("Failed to record web upload",
+				zap.String("sessionId", session.SessionId),
+				zap.String("filename", file.Filename),
+				zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package web_proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/veops/oneterm/internal/model"
+	"github.com/veops/oneterm/pkg/config"
+)
+
+const testBoundary = "oneterm-test-boundary"
+
+// testPart is a part of a multipart body, the disposition is written as is
+type testPart struct {
+	disposition string
+	content     string
+}
+
+func multipartBody(parts ...testPart) []byte {
+	var b bytes.Buffer
+	for _, p := range parts {
+		fmt.Fprintf(&b, "--%s\r\nContent-Disposition: %s\r\n\r\n%s\r\n", testBoundary, p.disposition, p.content)
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", testBoundary)
+	return b.Bytes()
+}
+
+func newUploadRequest(body []byte) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "http://asset/upload", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary="+testBoundary)
+	return req
+}
+
+func newUploadSession(settings *model.WebProxySettings) *WebProxySession {
+	return &WebProxySession{
+		SessionId:   "test",
+		Permissions: &model.AuthPermissions{Connect: true, FileUpload: true},
+		WebConfig:   &model.WebConfig{ProxySettings: settings},
+	}
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestInspectUpload(t *testing.T) {
+	tests := []struct {
+		name       string
+		settings   *model.WebProxySettings
+		noUpload   bool
+		parts      []testPart
+		want       []string
+		wantReason string
+	}{
+		{
+			name:  "file",
+			parts: []testPart{{`form-data; name="f"; filename="report.pdf"`, "%PDF"}},
+			want:  []string{"report.pdf"},
+		},
+		{
+			name:       "upload not permitted",
+			noUpload:   true,
+			parts:      []testPart{{`form-data; name="f"; filename="report.pdf"`, "%PDF"}},
+			wantReason: "file upload not permitted",
+		},
+		{
+			name:  "form fields are not files",
+			parts: []testPart{{`form-data; name="title"`, "hello"}, {`form-data; name="f"; filename="a.txt"`, "a"}},
+			want:  []string{"a.txt"},
+		},
+		{
+			name:  "empty file input skipped",
+			parts: []testPart{{`form-data; name="f"; filename=""`, ""}},
+			want:  []string{},
+		},
+		{
+			name:  "RFC 2231 filename in utf-8",
+			parts: []testPart{{`form-data; name="f"; filename*=UTF-8''%E6%8A%A5%E5%91%8A.pdf`, "%PDF"}},
+			want:  []string{"报告.pdf"},
+		},
+		{
+			name:       "RFC 2231 filename in an unknown charset",
+			parts:      []testPart{{`form-data; name="f"; filename*=x-unknown''evil.exe`, "MZ"}},
+			wantReason: "malformed upload",
+		},
+		{
+			name:       "RFC 2231 continuation in an unknown charset",
+			parts:      []testPart{{`form-data; name="f"; filename*0*=x-unknown''evil; filename*1=.exe`, "MZ"}},
+			wantReason: "malformed upload",
+		},
+		{
+			name:  "RFC 2231 continuation in utf-8",
+			parts: []testPart{{`form-data; name="f"; filename*0*=utf-8''%E6%8A%A5; filename*1=.pdf`, "%PDF"}},
+			want:  []string{"报.pdf"},
+		},
+		{
+			name:       "disposition that does not parse",
+			parts:      []testPart{{`form-data; name="f"; filename=a\b.exe`, "MZ"}},
+			wantReason: "malformed upload",
+		},
+		{
+			name:  "backslash path reduced to the file name",
+			parts: []testPart{{`form-data; name="f"; filename="C:\\Users\\me\\report.pdf"`, "%PDF"}},
+			want:  []string{"report.pdf"},
+		},
+		{
+			name:       "backslash path checked by its file name",
+			settings:   &model.WebProxySettings{BlockedUploadExtensions: []string{"exe"}},
+			parts:      []testPart{{`form-data; name="f"; filename="..\\..\\evil.exe"`, "MZ"}},
+			wantReason: "upload of 'evil.exe' is blocked",
+		},
+		{
+			name:       "slash path checked by its file name",
+			settings:   &model.WebProxySettings{AllowedUploadExtensions: []string{"pdf"}},
+			parts:      []testPart{{`form-data; name="f"; filename="report.pdf/evil.sh"`, "#!"}},
+			wantReason: "upload of 'evil.sh' is not allowed",
+		},
+		{
+			name:     "allowed extension",
+			settings: &model.WebProxySettings{AllowedUploadExtensions: []string{".pdf", "TXT"}},
+			parts:    []testPart{{`form-data; name="f"; filename="a.PDF"`, "%PDF"}, {`form-data; name="g"; filename="b.txt"`, "b"}},
+			want:     []string{"a.PDF", "b.txt"},
+		},
+		{
+			name:       "extension outside the allow list",
+			settings:   &model.WebProxySettings{AllowedUploadExtensions: []string{"pdf"}},
+			parts:      []testPart{{`form-data; name="f"; filename="a.pdf"`, "%PDF"}, {`form-data; name="g"; filename="b.exe"`, "MZ"}},
+			wantReason: "upload of 'b.exe' is not allowed",
+		},
+		{
+			name:       "file without extension outside the allow list",
+			settings:   &model.WebProxySettings{AllowedUploadExtensions: []string{"pdf"}},
+			parts:      []testPart{{`form-data; name="f"; filename="Makefile"`, "all:"}},
+			wantReason: "upload of 'Makefile' is not allowed",
+		},
+		{
+			name:       "blocked extension",
+			settings:   &model.WebProxySettings{BlockedUploadExtensions: []string{".EXE"}},
+			parts:      []testPart{{`form-data; name="f"; filename="setup.exe"`, "MZ"}},
+			wantReason: "upload of 'setup.exe' is blocked",
+		},
+		{
+			name:       "blocked extension wins over the allow list",
+			settings:   &model.WebProxySettings{AllowedUploadExtensions: []string{"exe"}, BlockedUploadExtensions: []string{"exe"}},
+			parts:      []testPart{{`form-data; name="f"; filename="setup.exe"`, "MZ"}},
+			wantReason: "upload of 'setup.exe' is blocked",
+		},
+		{
+			name:     "file at the size limit",
+			settings: &model.WebProxySettings{MaxUploadSize: 4},
+			parts:    []testPart{{`form-data; name="f"; filename="a.txt"`, "abcd"}},
+			want:     []string{"a.txt"},
+		},
+		{
+			name:       "file over the size limit",
+			settings:   &model.WebProxySettings{MaxUploadSize: 4},
+			parts:      []testPart{{`form-data; name="f"; filename="a.txt"`, "abcde"}},
+			wantReason: "file 'a.txt' is too large",
+		},
+		{
+			name:  "form field at the limit",
+			parts: []testPart{{`form-data; name="title"`, strings.Repeat("a", maxUploadField)}},
+			want:  []string{},
+		},
+		{
+			name:       "form field over the limit",
+			parts:      []testPart{{`form-data; name="title"`, strings.Repeat("a", maxUploadField+1)}},
+			wantReason: "form field 'title' is too large",
+		},
+		{
+			name:       "file input without filename is a form field",
+			parts:      []testPart{{`form-data; name="f"`, strings.Repeat("a", maxUploadField+1)}},
+			wantReason: "form field 'f' is too large",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := newUploadSession(tt.settings)
+			if tt.noUpload {
+				session.Permissions.FileUpload = false
+			}
+			body := multipartBody(tt.parts...)
+			req := newUploadRequest(body)
+
+			files, cleanup, err := InspectUpload(session, req)
+			defer cleanup()
+			if tt.wantReason != "" {
+				var denied *AccessDeniedError
+				if !errors.As(err, &denied) || denied.Reason != tt.wantReason {
+					t.Fatalf("InspectUpload() error = %v, want reason %q", err, tt.wantReason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InspectUpload() error = %v", err)
+			}
+			if len(files) != len(tt.want) {
+				t.Fatalf("InspectUpload() got %d files, want %d", len(files), len(tt.want))
+			}
+			for i, file := range files {
+				if file.Filename != tt.want[i] {
+					t.Errorf("file %d = %q, want %q", i, file.Filename, tt.want[i])
+				}
+			}
+
+			// The body is put back unchanged for the target
+			got, err := io.ReadAll(req.Body)
+			if err != nil || !bytes.Equal(got, body) {
+				t.Errorf("body after inspection differs, error = %v", err)
+			}
+			if req.ContentLength != int64(len(body)) {
+				t.Errorf("ContentLength = %d, want %d", req.ContentLength, len(body))
+			}
+		})
+	}
+}
+
+func TestInspectUploadNotMultipart(t *testing.T) {
+	session := newUploadSession(nil)
+	session.Permissions.FileUpload = false
+	req := httptest.NewRequest(http.MethodPost, "http://asset/upload", strings.NewReader(`{"a":1}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	files, cleanup, err := InspectUpload(session, req)
+	defer cleanup()
+	if err != nil || files != nil {
+		t.Fatalf("InspectUpload() = %v, %v, want a body that is not inspected", files, err)
+	}
+}
+
+func TestInspectUploadBodyLimit(t *testing.T) {
+	defer func(limit int64) { config.Cfg.Session.WebUploadBodyLimit = limit }(config.Cfg.Session.WebUploadBodyLimit)
+
+	body := multipartBody(testPart{`form-data; name="f"; filename="a.txt"`, strings.Repeat("a", 4096)})
+	config.Cfg.Session.WebUploadBodyLimit = int64(len(body))
+
+	tests := []struct {
+		name          string
+		body          []byte
+		contentLength int64
+		wantErr       bool
+	}{
+		{name: "at the limit", body: body, contentLength: int64(len(body))},
+		{name: "declared over the limit", body: body, contentLength: int64(len(body)) + 1, wantErr: true},
+		{name: "over the limit with a lying Content-Length", body: append(bytes.Clone(body), '\r', '\n'), contentLength: 100, wantErr: true},
+		{name: "over the limit without Content-Length", body: append(bytes.Clone(body), '\r', '\n'), contentLength: -1, wantErr: true},
+		{
+			name:          "parts past the limit with a lying Content-Length",
+			body:          multipartBody(testPart{`form-data; name="f"; filename="a.txt"`, strings.Repeat("a", 8192)}),
+			contentLength: 100,
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newUploadRequest(tt.body)
+			req.ContentLength = tt.contentLength
+
+			_, cleanup, err := InspectUpload(newUploadSession(nil), req)
+			defer cleanup()
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("InspectUpload() error = %v", err)
+				}
+				return
+			}
+			var denied *AccessDeniedError
+			if !errors.As(err, &denied) || denied.Reason != "upload is too large" {
+				t.Fatalf("InspectUpload() error = %v, want upload is too large", err)
+			}
+		})
+	}
+}
+
+func TestInspectUploadProxied(t *testing.T) {
+	var received []byte
+	var receivedLength int64
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		receivedLength = r.ContentLength
+	}))
+	defer target.Close()
+	targetURL, _ := url.Parse(target.URL)
+	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+
+	session := newUploadSession(&model.WebProxySettings{AllowedUploadExtensions: []string{"bin"}})
+	var files []UploadedFile
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var cleanup func()
+		var err error
+		files, cleanup, err = InspectUpload(session, r)
+		defer cleanup()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	defer front.Close()
+
+	// Binary content holding the boundary prefix and line breaks, with a preamble and an epilogue
+	content := "\x00\x01--" + testBoundary[:8] + "\r\n\xff\xfe" + strings.Repeat("\x00z\r\n", 1000)
+	body := append([]byte("preamble\r\n"), multipartBody(
+		testPart{`form-data; name="title"`, "a title"},
+		testPart{`form-data; name="f"; filename="data.bin"`, content},
+	)...)
+	body = append(body, "epilogue"...)
+
+	// Both with a length and chunked
+	for _, chunked := range []bool{false, true} {
+		t.Run(fmt.Sprintf("chunked %v", chunked), func(t *testing.T) {
+			received, receivedLength = nil, 0
+			var reader io.Reader = bytes.NewReader(body)
+			if chunked {
+				reader = io.MultiReader(reader)
+			}
+			req, _ := http.NewRequest(http.MethodPost, front.URL+"/upload", reader)
+			req.Header.Set("Content-Type", "multipart/form-data; boundary="+testBoundary)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("upload error = %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("upload status = %d", resp.StatusCode)
+			}
+
+			if !bytes.Equal(received, body) {
+				t.Errorf("target received %d bytes that differ from the %d sent", len(received), len(body))
+			}
+			if receivedLength != int64(len(body)) {
+				t.Errorf("target Content-Length = %d, want %d", receivedLength, len(body))
+			}
+			if len(files) != 1 || files[0].Filename != "data.bin" || files[0].Size != int64(len(content)) || files[0].Hash != sha256Hex(content) {
+				t.Errorf("files = %+v, want data.bin of %d bytes hashed %s", files, len(content), sha256Hex(content))
+			}
+		})
+	}
+}
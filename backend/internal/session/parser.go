@@ -65,10 +65,27 @@ type Parser struct {
 	curCmd       string
 	lastCmd      string
 	lastRes      string
+	lastOffset   *float64
 	curRes       string
+	recorder     *Asciinema
 	mu           *sync.Mutex
 }
 
+// SetRecorder makes commands carry their offset in the recording so replays can seek to them
+func (p *Parser) SetRecorder(recorder *Asciinema) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.recorder = recorder
+}
+
+func (p *Parser) offsetLocked() *float64 {
+	if p.recorder == nil {
+		return nil
+	}
+	return lo.ToPtr(p.recorder.Offset())
+}
+
 func (p *Parser) AddInput(bs []byte) (cmd string, forbidden bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -82,6 +99,7 @@ func (p *Parser) AddInput(bs []byte) (cmd string, forbidden bool) {
 		p.WriteDb()
 		p.lastCmd = ""
 		p.lastRes = ""
+		p.lastOffset = nil
 	}
 
 	p.Input = append(p.Input, bs...)
@@ -100,41 +118,61 @@ func (p *Parser) AddInput(bs []byte) (cmd string, forbidden bool) {
 	p.curCmd = ""
 	p.resetLocked()
 
-	filter := ""
-	if filter, forbidden = p.IsForbidden(cmdFromOutput); forbidden {
-		cmd = filter
+	if c := p.matchForbidden(cmdFromOutput); c != nil {
+		cmd, forbidden = forbiddenFilter(c), true
+		// Keep blocked attempts searchable with the risk level of the rule that stopped them
+		p.writeCmd(cmdFromOutput, "forbidden: "+cmd, int(c.RiskLevel), p.offsetLocked())
 		return
 	}
 	p.lastCmd = cmdFromOutput
+	p.lastOffset = p.offsetLocked()
 	return
 }
 
 func (p *Parser) IsForbidden(cmd string) (string, bool) {
+	if c := p.matchForbidden(cmd); c != nil {
+		return forbiddenFilter(c), true
+	}
+	return "", false
+}
+
+// matchForbidden returns the first command rule matching cmd
+func (p *Parser) matchForbidden(cmd string) *model.Command {
 	if p.isEdit || cmd == "" {
-		return "", false
+		return nil
 	}
 	for _, c := range p.Cmds {
 		if c.IsRe {
 			if c.Re.MatchString(cmd) {
-				return fmt.Sprintf("Regex: %s", c.Cmd), true
+				return c
 			}
 		} else {
 			if strings.Contains(cmd, c.Cmd) {
-				return c.Cmd, true
+				return c
 			}
 		}
 	}
-	return "", false
+	return nil
+}
+
+func forbiddenFilter(c *model.Command) string {
+	return lo.Ternary(c.IsRe, fmt.Sprintf("Regex: %s", c.Cmd), c.Cmd)
 }
 
 func (p *Parser) WriteDb() {
 	if p.lastCmd == "" || strings.TrimSpace(p.lastCmd) == "" {
 		return
 	}
+	p.writeCmd(p.lastCmd, p.lastRes, int(model.RiskLevelSafe), p.lastOffset)
+}
+
+func (p *Parser) writeCmd(cmd, result string, level int, offset *float64) {
 	m := &model.SessionCmd{
 		SessionId: p.SessionId,
-		Cmd:       p.lastCmd,
-		Result:    p.lastRes,
+		Cmd:       cmd,
+		Result:    result,
+		Level:     level,
+		Offset:    offset,
 	}
 	err := dbpkg.DB.Model(m).Create(m).Error
 	if err != nil {
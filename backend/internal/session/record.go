@@ -20,6 +20,7 @@ import (
 type Asciinema struct {
 	sessionID  string
 	buffer     *bytes.Buffer
+	chain      *storage.HashChain // Hashes frames as they are recorded
 	ts         time.Time
 	useStorage bool
 }
@@ -28,6 +29,7 @@ func NewAsciinema(id string, w, h int) (ret *Asciinema, err error) {
 	ret = &Asciinema{
 		sessionID:  id,
 		buffer:     bytes.NewBuffer(nil),
+		chain:      storage.NewHashChain(),
 		ts:         time.Now(),
 		useStorage: storage.DefaultSessionReplayAdapter != nil,
 	}
@@ -51,46 +53,65 @@ func NewAsciinema(id string, w, h int) (ret *Asciinema, err error) {
 		return nil, err
 	}
 
-	ret.buffer.Write(append(bs, '\r', '\n'))
+	ret.append(bs)
 
 	return ret, nil
 }
 
+// Offset returns the current position in the recording, in seconds since it started
+func (a *Asciinema) Offset() float64 {
+	return float64(time.Now().UnixMicro()-a.ts.UnixMicro()) / 1_000_000
+}
+
 func (a *Asciinema) Write(p []byte) {
 	o := [3]any{}
-	o[0] = float64(time.Now().UnixMicro()-a.ts.UnixMicro()) / 1_000_000
+	o[0] = a.Offset()
 	o[1] = "o"
 	o[2] = string(p)
 	bs, _ := json.Marshal(o)
-	a.buffer.Write(append(bs, '\r', '\n'))
+	a.append(bs)
 }
 
 func (a *Asciinema) Resize(w, h int) {
 	r := [3]any{}
-	r[0] = float64(time.Now().UnixMicro()-a.ts.UnixMicro()) / 1_000_000
+	r[0] = a.Offset()
 	r[1] = "r"
 	r[2] = fmt.Sprintf("%dx%d", w, h)
 	bs, _ := json.Marshal(r)
-	a.buffer.Write(append(bs, '\r', '\n'))
+	a.append(bs)
 }
 
-// Close closes the recording and saves to storage
+// append adds a line to the recording and to its hash chain
+func (a *Asciinema) append(line []byte) {
+	line = append(line, '\r', '\n')
+	a.buffer.Write(line)
+	a.chain.Write(line)
+}
+
+// Close finalizes the digest of the recording and saves it to storage
 func (a *Asciinema) Close() error {
+	digest := a.chain.Sum()
+	logger.L().Debug("Replay finalized",
+		zap.String("session_id", a.sessionID),
+		zap.Int64("size", digest.Size),
+		zap.String("sha256", digest.Checksum),
+		zap.String("chain_hash", digest.ChainHash))
+
 	if a.useStorage && storage.DefaultSessionReplayAdapter != nil {
 		reader := bytes.NewReader(a.buffer.Bytes())
 		size := int64(a.buffer.Len())
-		err := storage.DefaultSessionReplayAdapter.SaveReplay(a.sessionID, reader, size)
+		err := storage.DefaultSessionReplayAdapter.SaveReplayWithDigest(a.sessionID, reader, size, a.ts, digest)
 		if err != nil {
 			logger.L().Error("Failed to save replay to storage", zap.String("session_id", a.sessionID), zap.Error(err))
-			return a.saveToLocalFile()
+			return a.saveToLocalFile(digest)
 		}
 		return nil
 	}
-	return a.saveToLocalFile()
+	return a.saveToLocalFile(digest)
 }
 
-// saveToLocalFile saves to local filesystem (fallback solution)
-func (a *Asciinema) saveToLocalFile() error {
+// saveToLocalFile saves to local filesystem (fallback solution), the digest is indexed so the file can be verified
+func (a *Asciinema) saveToLocalFile(digest *storage.Digest) error {
 	logger.L().Info("saveToLocalFile called", zap.String("session_id", a.sessionID))
 
 	// Use date hierarchy strategy for local files - directly under base_path
@@ -120,6 +141,13 @@ func (a *Asciinema) saveToLocalFile() error {
 		zap.String("session_id", a.sessionID),
 		zap.String("path", filePath))
 
+	if storage.DefaultSessionReplayAdapter != nil {
+		key := filepath.ToSlash(filepath.Join(dateDir, fmt.Sprintf("%s.cast", a.sessionID)))
+		if err = storage.DefaultSessionReplayAdapter.RecordLocalReplay(a.sessionID, key, digest); err != nil {
+			logger.L().Error("Failed to index local replay, it cannot be verified", zap.String("session_id", a.sessionID), zap.Error(err))
+		}
+	}
+
 	return nil
 }
 
@@ -294,7 +322,7 @@ func MigrateLocalReplaysToStorage() error {
 			continue
 		}
 
-		err = storage.DefaultSessionReplayAdapter.SaveReplay(sessionID, localFile, info.Size())
+		err = storage.DefaultSessionReplayAdapter.SaveReplayWithTimestamp(sessionID, localFile, info.Size(), info.ModTime())
 		localFile.Close()
 
 		if err != nil {
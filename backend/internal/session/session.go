@@ -128,6 +128,7 @@ type Session struct {
 	ShareEnd     time.Time       `json:"-" gorm:"-"`
 	Once         sync.Once       `json:"-" gorm:"-"`
 	Prompt       string          `json:"-" gorm:"-"`
+	Watermark    string          `json:"-" gorm:"-"`
 
 	// SSH connection reuse for file transfers
 	SSHClient *gossh.Client `json:"-" gorm:"-"`
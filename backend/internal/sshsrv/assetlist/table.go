@@ -582,7 +582,7 @@ func NewRecentSessions(sessions []*model.Session, combines map[string][3]int, wi
 
 		// Build command string
 		cmd := fmt.Sprintf("%s %s@%s", protocol, userName, assetName)
-		if port != "" && port != lo.Ternary(protocol == "ssh", "22", lo.Ternary(protocol == "telnet", "23", lo.Ternary(protocol == "redis", "6379", lo.Ternary(protocol == "mysql", "3306", lo.Ternary(protocol == "postgresql", "5432", lo.Ternary(protocol == "mongodb", "27017", port)))))) {
+		if port != "" && port != lo.Ternary(icons.GetDefaultPort(protocol) != "", icons.GetDefaultPort(protocol), port) {
 			cmd = fmt.Sprintf("%s:%s", cmd, port)
 		}
 
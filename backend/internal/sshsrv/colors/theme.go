@@ -33,6 +33,10 @@ var (
 	RedisColor      = lipgloss.Color("#9C27B0") // Purple for Redis
 	MongoDBColor    = lipgloss.Color("#4DB33D") // Keep MongoDB brand green
 	PostgreSQLColor = PrimaryColor2  // Light blue for PostgreSQL
+	MSSQLColor      = lipgloss.Color("#CC2927") // SQL Server brand red
+	OracleColor     = lipgloss.Color("#F80000") // Oracle brand red
+	KubernetesColor = lipgloss.Color("#326CE5") // Kubernetes brand blue
+	DockerColor     = lipgloss.Color("#2496ED") // Docker brand blue
 	TelnetColor     = PrimaryColor8  // Soft blue for Telnet
 )
 
@@ -87,6 +91,14 @@ func GetProtocolColor(protocol string) lipgloss.Color {
 		return MongoDBColor
 	case "postgresql":
 		return PostgreSQLColor
+	case "mssql":
+		return MSSQLColor
+	case "oracle":
+		return OracleColor
+	case "kubernetes":
+		return KubernetesColor
+	case "docker":
+		return DockerColor
 	case "telnet":
 		return TelnetColor
 	default:
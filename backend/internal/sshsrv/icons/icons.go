@@ -18,6 +18,14 @@ func GetProtocolIcon(protocol string) string {
 		return "◉"
 	case "postgresql":
 		return "▣"
+	case "mssql":
+		return "◈"
+	case "oracle":
+		return "◐"
+	case "kubernetes":
+		return "⎈"
+	case "docker":
+		return "▤"
 	case "telnet":
 		return "◎"
 	default:
@@ -39,6 +47,14 @@ func GetStyledProtocolIcon(protocol string) string {
 		return lipgloss.NewStyle().Foreground(colors.MongoDBColor).Render(icon)
 	case "postgresql":
 		return lipgloss.NewStyle().Foreground(colors.PostgreSQLColor).Render(icon)
+	case "mssql":
+		return lipgloss.NewStyle().Foreground(colors.MSSQLColor).Render(icon)
+	case "oracle":
+		return lipgloss.NewStyle().Foreground(colors.OracleColor).Render(icon)
+	case "kubernetes":
+		return lipgloss.NewStyle().Foreground(colors.KubernetesColor).Render(icon)
+	case "docker":
+		return lipgloss.NewStyle().Foreground(colors.DockerColor).Render(icon)
 	case "telnet":
 		return lipgloss.NewStyle().Foreground(colors.TelnetColor).Render(icon)
 	default:
@@ -59,6 +75,14 @@ func GetDefaultPort(protocol string) string {
 		return "27017"
 	case "postgresql":
 		return "5432"
+	case "mssql":
+		return "1433"
+	case "oracle":
+		return "1521"
+	case "kubernetes":
+		return "6443"
+	case "docker":
+		return "2375"
 	case "telnet":
 		return "23"
 	default:
@@ -55,6 +55,10 @@ var (
 		"mysql":      3306,
 		"mongodb":    27017,
 		"postgresql": 5432,
+		"mssql":      1433,
+		"oracle":     1521,
+		"kubernetes": 6443,
+		"docker":     2375,
 		"telnet":     23,
 	}
 )
@@ -302,7 +306,7 @@ func (m *view) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if strings.Contains(cmd, "@") {
 					suggestion = "\n💪 Try: ssh " + cmd + " (if connecting via SSH)"
 				} else {
-					suggestion = "\n💪 Available commands: ssh, mysql, redis, mongodb, postgresql, telnet, help, list, exit"
+					suggestion = "\n💪 Available commands: ssh, mysql, redis, mongodb, postgresql, mssql, oracle, kubernetes, docker, telnet, help, list, exit"
 				}
 				return m, tea.Sequence(
 					hisCmd,
@@ -527,6 +531,12 @@ func (m *view) helpText() string {
   • redis user@host      - Connect to Redis server
   • mongodb user@host    - Connect to MongoDB database
   • postgresql user@host - Connect to PostgreSQL database
+  • mssql user@host      - Connect to SQL Server database
+  • oracle user@host     - Connect to Oracle database
+  • kubernetes user@host namespace/pod[/container]
+                         - Exec into a Kubernetes pod
+  • docker user@host container
+                         - Exec into a Docker container
   • telnet user@host     - Connect via Telnet
   • list/ls/table        - Show assets in interactive table
   • recent or r or \r    - Show recent sessions with last login time
@@ -548,6 +558,13 @@ func (m *view) helpText() string {
 }
 
 func (m *view) handleConnectionCommand(cmd string) tea.Cmd {
+	// Container platform commands carry the workload as a trailing
+	// namespace/pod[/container] for kubernetes or container name for docker
+	target := ""
+	if fields := strings.Fields(cmd); len(fields) == 3 && (fields[0] == "kubernetes" || fields[0] == "docker") {
+		cmd, target = strings.Join(fields[:2], " "), fields[2]
+	}
+
 	// Check if this is a valid connection command
 	if _, exists := m.combines[cmd]; !exists {
 		return nil
@@ -577,6 +594,9 @@ func (m *view) handleConnectionCommand(cmd string) tea.Cmd {
 	}
 
 	newCtx.Request.URL.RawQuery = fmt.Sprintf("w=%d&h=%d", pty.Window.Width, pty.Window.Height)
+	if target != "" {
+		newCtx.Request.URL.RawQuery += "&target=" + url.QueryEscape(target)
+	}
 	newCtx.Params = nil
 	newCtx.Params = append(newCtx.Params, gin.Param{Key: "account_id", Value: cast.ToString(m.combines[cmd][0])})
 	newCtx.Params = append(newCtx.Params, gin.Param{Key: "asset_id", Value: cast.ToString(m.combines[cmd][1])})
@@ -37,6 +37,13 @@ var (
 		Session: SessionConfig{
 			ReplayDir: "/replay",
 		},
+		Guacenc: GuacencConfig{
+			FfmpegPath: "ffmpeg",
+			Size:       "1024x768",
+			Bitrate:    2000000,
+			Workers:    1,
+			Timeout:    3600,
+		},
 	}
 )
 
@@ -140,10 +147,50 @@ type SshConfig struct {
 type GuacdConfig struct {
 	Host string `yaml:"host"`
 	Port int    `yaml:"port"`
+	// Endpoints lists the host:port of each guacd of a pool, Host and Port are used when empty
+	Endpoints []string `yaml:"endpoints"`
+	// HealthCheckInterval is the seconds between health checks of the endpoints, 10 when unset
+	HealthCheckInterval int `yaml:"healthCheckInterval"`
 }
 
 type SessionConfig struct {
 	ReplayDir string `yaml:"replayDir"`
+	// GuacdRecordingDir is where recordings written by guacd are visible to oneterm, defaults to ReplayDir
+	GuacdRecordingDir string `yaml:"guacdRecordingDir"`
+	// CompressGuacdRecording gzips guacd recordings before they are uploaded to storage
+	CompressGuacdRecording bool `yaml:"compressGuacdRecording"`
+	// ReplayCompression compresses asciinema casts when they are saved, gzip or zstd, empty stores them as is
+	ReplayCompression string `yaml:"replayCompression"`
+	// ReplaySigningKey is the base64 encoded Ed25519 seed signing recording digests, derived from secretKey when empty
+	ReplaySigningKey string `yaml:"replaySigningKey"`
+	// ReplayVerifyKeys are the base64 encoded Ed25519 public keys of retired signing keys, digests signed before a
+	// rotation are verified with them
+	ReplayVerifyKeys []string `yaml:"replayVerifyKeys"`
+	// ClipboardContentLimit is how many bytes of text clipboard transfers of graphical sessions are kept, 0 keeps none
+	ClipboardContentLimit int `yaml:"clipboardContentLimit"`
+	// RecordKeystrokes rebuilds the text typed in graphical sessions into session commands, the password of the
+	// account is masked but other secrets typed by the user are kept
+	RecordKeystrokes bool `yaml:"recordKeystrokes"`
+	// WebProxyStore keeps web proxy sessions in memory or in redis, redis is needed to run several replicas
+	WebProxyStore string `yaml:"webProxyStore"`
+	// WebUploadBodyLimit is the bytes a multipart upload through the web proxy may have in all, 1 GiB when unset
+	WebUploadBodyLimit int64 `yaml:"webUploadBodyLimit"`
+}
+
+// GuacencConfig configures conversion of guacd recordings to video
+type GuacencConfig struct {
+	Path       string `yaml:"path"`       // guacenc binary, renders recordings to .m4v; empty disables video conversion
+	FfmpegPath string `yaml:"ffmpegPath"` // ffmpeg binary, transcodes .m4v to mp4/webm
+	Size       string `yaml:"size"`       // WIDTHxHEIGHT
+	Bitrate    int    `yaml:"bitrate"`    // bits per second
+	Workers    int    `yaml:"workers"`    // number of concurrent conversions
+	Timeout    int    `yaml:"timeout"`    // seconds per conversion
+}
+
+// StorageEncryptionConfig holds the master keys wrapping the data keys of encrypted storages
+type StorageEncryptionConfig struct {
+	CurrentKey string            `yaml:"currentKey"` // id of the key wrapping new objects
+	Keys       map[string]string `yaml:"keys"`       // key id to base64 encoded 32 byte AES key, keep retired keys to read old objects
 }
 
 type ConfigYaml struct {
@@ -157,6 +204,9 @@ type ConfigYaml struct {
 	Http      HttpConfig     `yaml:"http"`
 	Ssh       SshConfig      `yaml:"ssh"`
 	Session   SessionConfig  `yaml:"session"`
+	Guacenc   GuacencConfig  `yaml:"guacenc"`
 	Auth      Auth           `yaml:"auth"`
 	SecretKey string         `yaml:"secretKey"`
+
+	StorageEncryption StorageEncryptionConfig `yaml:"storageEncryption"`
 }
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -20,6 +21,7 @@ import (
 var (
 	DB     *gorm.DB
 	dbOnce sync.Once
+	dbType DBType
 )
 
 type DBType string
@@ -114,6 +116,7 @@ func Init(cfg Config, autoMigrate bool, models ...interface{}) error {
 	var err error
 
 	dbOnce.Do(func() {
+		dbType = cfg.Type
 		DB, err = Open(cfg)
 		if err != nil {
 			err = fmt.Errorf("init database failed: %w", err)
@@ -174,6 +177,48 @@ func DropIndex(value interface{}, indexName string) error {
 	return nil
 }
 
+// Type returns the type of the database in use
+func Type() DBType {
+	return dbType
+}
+
+// CreateFullTextIndex creates a full-text index over text columns. MySQL uses the ngram parser so that commands and
+// CJK text match on parts of words, postgres a GIN index on the simple tsvector of the columns joined by spaces, see
+// FullTextExpr. Other databases have no full-text index, ErrFullTextUnsupported is returned.
+func CreateFullTextIndex(value interface{}, table, indexName string, columns ...string) error {
+	db := GetDB()
+	if db.Migrator().HasIndex(value, indexName) {
+		return nil
+	}
+
+	var sql string
+	switch dbType {
+	case MySQL, "":
+		sql = fmt.Sprintf("CREATE FULLTEXT INDEX %s ON %s (%s) WITH PARSER ngram", indexName, table, strings.Join(columns, ", "))
+	case Postgres:
+		sql = fmt.Sprintf("CREATE INDEX %s ON %s USING GIN (%s)", indexName, table, FullTextExpr(columns...))
+	default:
+		return ErrFullTextUnsupported
+	}
+	if err := db.Exec(sql).Error; err != nil {
+		return fmt.Errorf("create full-text index %s failed: %w", indexName, err)
+	}
+	return nil
+}
+
+// ErrFullTextUnsupported is returned for databases without full-text indexes
+var ErrFullTextUnsupported = errors.New("full-text index not supported")
+
+// FullTextExpr is the postgres tsvector of columns, matching the expression of the index created by
+// CreateFullTextIndex
+func FullTextExpr(columns ...string) string {
+	parts := make([]string, len(columns))
+	for i, c := range columns {
+		parts[i] = fmt.Sprintf("coalesce(%s, '')", c)
+	}
+	return fmt.Sprintf("to_tsvector('simple', %s)", strings.Join(parts, " || ' ' || "))
+}
+
 func init() {
 	if config.Cfg == nil {
 		return
@@ -2,7 +2,9 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"os"
 	"time"
 
 	"github.com/veops/oneterm/pkg/logger"
@@ -15,9 +17,39 @@ type AdvancedProvider interface {
 	GetPathStrategy() PathStrategy
 }
 
+// LocalFallbackStorage is the storage name of replays written to the replay directory because their storage failed,
+// their key is relative to the directory
+const LocalFallbackStorage = "replay_dir"
+
+// ReplayEntry records where the replay of a session is stored
+type ReplayEntry struct {
+	SessionID   string
+	Key         string
+	StorageName string
+	Size        int64
+	Checksum    string // hex encoded SHA-256 of the stored bytes
+	ChainHash   string // head of the chunk hash chain of the stored bytes, see HashChain
+	Chunks      int
+	ChunkHashes []byte // SHA-256 of each chunk, see Digest
+	Encoding    string // compression of the stored bytes, empty when stored as is
+}
+
+// ReplayIndex persists replay locations so they can be found without guessing keys
+type ReplayIndex interface {
+	// RecordReplay indexes a replay after it was written
+	RecordReplay(ctx context.Context, entry *ReplayEntry) error
+	// LookupReplay returns the indexed replay of a session and the provider holding it
+	LookupReplay(ctx context.Context, sessionID string) (*ReplayEntry, Provider, error)
+	// ForgetReplay removes the index entry of a replay
+	ForgetReplay(ctx context.Context, entry *ReplayEntry) error
+}
+
 // SessionReplayAdapter provides session replay storage operations
 type SessionReplayAdapter struct {
-	provider Provider
+	provider    Provider
+	name        string
+	index       ReplayIndex
+	compression string
 }
 
 // NewSessionReplayAdapter creates a new session replay adapter
@@ -27,39 +59,134 @@ func NewSessionReplayAdapter(provider Provider) *SessionReplayAdapter {
 	}
 }
 
+// SetIndex sets the index recording replays written by the adapter, name is the storage name of its provider
+func (a *SessionReplayAdapter) SetIndex(name string, index ReplayIndex) {
+	a.name = name
+	a.index = index
+}
+
+// SetCompression sets the encoding new replays are compressed with, empty stores them as is
+func (a *SessionReplayAdapter) SetCompression(encoding string) error {
+	if !ValidEncoding(encoding) {
+		return fmt.Errorf("unsupported replay compression %q", encoding)
+	}
+	a.compression = encoding
+	return nil
+}
+
 // SaveReplay saves a session replay with timestamp-based path generation
 func (a *SessionReplayAdapter) SaveReplay(sessionID string, reader io.Reader, size int64) error {
+	// Generate key with current timestamp for date-based organization
+	return a.SaveReplayWithTimestamp(sessionID, reader, size, time.Now())
+}
+
+// SaveReplayWithTimestamp saves a session replay with explicit timestamp
+func (a *SessionReplayAdapter) SaveReplayWithTimestamp(sessionID string, reader io.Reader, size int64, timestamp time.Time) error {
+	return a.SaveReplayWithDigest(sessionID, reader, size, timestamp, nil)
+}
+
+// SaveReplayWithDigest saves a session replay whose digest the recorder computed,
+// the uploaded bytes must match it. A nil digest is computed while uploading.
+func (a *SessionReplayAdapter) SaveReplayWithDigest(sessionID string, reader io.Reader, size int64, timestamp time.Time, expected *Digest) error {
 	if a.provider == nil {
 		logger.L().Warn("SessionReplayAdapter provider is nil", zap.String("session_id", sessionID))
 		return nil // No storage provider available
 	}
 
 	ctx := context.Background()
+	key := a.generateReplayKey(sessionID, timestamp)
 
-	// Generate key with current timestamp for date-based organization
-	key := a.generateReplayKey(sessionID, time.Now())
+	if a.compression != "" {
+		// The recorder digest covers the raw recording, check it before compressing
+		raw := NewHashChain()
+		compressed, compressedSize, err := CompressToTemp(a.compression, io.TeeReader(reader, raw))
+		if err != nil {
+			return err
+		}
+		defer func() {
+			compressed.Close()
+			os.Remove(compressed.Name())
+		}()
+		if expected != nil && !expected.Matches(raw.Sum()) {
+			return fmt.Errorf("replay %s does not match its recorded digest", key)
+		}
+		reader, size, expected = compressed, compressedSize, nil
+		key += CompressedExtension(a.compression)
+	}
+
+	chain := NewHashChain()
+	if err := a.provider.Upload(ctx, key, io.TeeReader(reader, chain), size); err != nil {
+		return err
+	}
+	digest := chain.Sum()
+	if expected != nil && !expected.Matches(digest) {
+		return fmt.Errorf("uploaded replay %s does not match its recorded digest", key)
+	}
+
+	if a.index != nil {
+		entry := &ReplayEntry{
+			SessionID:   sessionID,
+			Key:         key,
+			StorageName: a.name,
+			Size:        size,
+			Checksum:    digest.Checksum,
+			ChainHash:   digest.ChainHash,
+			Chunks:      digest.Chunks,
+			ChunkHashes: digest.ChunkHashes,
+			Encoding:    a.compression,
+		}
+		if err := a.index.RecordReplay(ctx, entry); err != nil {
+			logger.L().Warn("Failed to index replay", zap.String("session_id", sessionID), zap.String("key", key), zap.Error(err))
+		}
+	}
 
-	return a.provider.Upload(ctx, key, reader, size)
+	return nil
 }
 
-// GetReplay retrieves a session replay
+// RecordLocalReplay indexes a replay written to the replay directory instead of the storage, with the digest the
+// recorder computed so it can still be verified
+func (a *SessionReplayAdapter) RecordLocalReplay(sessionID, key string, digest *Digest) error {
+	if a.index == nil {
+		return nil
+	}
+	return a.index.RecordReplay(context.Background(), &ReplayEntry{
+		SessionID:   sessionID,
+		Key:         key,
+		StorageName: LocalFallbackStorage,
+		Size:        digest.Size,
+		Checksum:    digest.Checksum,
+		ChainHash:   digest.ChainHash,
+		Chunks:      digest.Chunks,
+		ChunkHashes: digest.ChunkHashes,
+	})
+}
+
+// GetReplay retrieves a session replay, decompressed if it is stored compressed
 func (a *SessionReplayAdapter) GetReplay(sessionID string) (io.ReadCloser, error) {
 	if a.provider == nil {
-		return nil, nil // No storage provider available
+		return nil, fmt.Errorf("no storage provider available")
 	}
 
 	ctx := context.Background()
 
-	// Try with current date first (most recent)
-	key := a.generateReplayKey(sessionID, time.Now())
-	reader, err := a.provider.Download(ctx, key)
-	if err == nil {
-		return reader, nil
+	if entry, provider, ok := a.lookup(ctx, sessionID); ok {
+		reader, err := provider.Download(ctx, entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		return Decompress(entry.Encoding, reader)
 	}
 
-	// Fallback to old format for backward compatibility
-	oldKey := sessionID + ".cast"
-	return a.provider.Download(ctx, oldKey)
+	// Not indexed yet, try the keys replays used to be written to
+	var lastErr error
+	for _, key := range a.legacyKeys(sessionID) {
+		reader, err := a.provider.Download(ctx, key)
+		if err == nil {
+			return reader, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
 }
 
 // DeleteReplay deletes a session replay
@@ -70,16 +197,20 @@ func (a *SessionReplayAdapter) DeleteReplay(sessionID string) error {
 
 	ctx := context.Background()
 
-	// Try to delete with current date first
-	key := a.generateReplayKey(sessionID, time.Now())
-	err := a.provider.Delete(ctx, key)
-	if err == nil {
-		return nil
+	if entry, provider, ok := a.lookup(ctx, sessionID); ok {
+		if err := provider.Delete(ctx, entry.Key); err != nil {
+			return err
+		}
+		return a.index.ForgetReplay(ctx, entry)
 	}
 
-	// Fallback to old format for backward compatibility
-	oldKey := sessionID + ".cast"
-	return a.provider.Delete(ctx, oldKey)
+	var lastErr error
+	for _, key := range a.legacyKeys(sessionID) {
+		if lastErr = a.provider.Delete(ctx, key); lastErr == nil {
+			return nil
+		}
+	}
+	return lastErr
 }
 
 // ReplayExists checks if a replay exists
@@ -90,47 +221,62 @@ func (a *SessionReplayAdapter) ReplayExists(sessionID string) (bool, error) {
 
 	ctx := context.Background()
 
-	// Try with current date first
-	key := a.generateReplayKey(sessionID, time.Now())
-	exists, err := a.provider.Exists(ctx, key)
-	if err == nil && exists {
-		return true, nil
+	if entry, provider, ok := a.lookup(ctx, sessionID); ok {
+		return provider.Exists(ctx, entry.Key)
 	}
 
-	// Fallback to old format for backward compatibility
-	oldKey := sessionID + ".cast"
-	return a.provider.Exists(ctx, oldKey)
+	for _, key := range a.legacyKeys(sessionID) {
+		if exists, err := a.provider.Exists(ctx, key); err == nil && exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// lookup resolves a replay through the index
+func (a *SessionReplayAdapter) lookup(ctx context.Context, sessionID string) (*ReplayEntry, Provider, bool) {
+	if a.index == nil {
+		return nil, nil, false
+	}
+	entry, provider, err := a.index.LookupReplay(ctx, sessionID)
+	if err != nil || entry == nil || provider == nil {
+		return nil, nil, false
+	}
+	return entry, provider, true
+}
+
+// legacyKeys returns the keys unindexed replays may have been written to
+func (a *SessionReplayAdapter) legacyKeys(sessionID string) []string {
+	keys := []string{a.generateReplayKey(sessionID, time.Now())}
+	if flat := sessionID + ".cast"; flat != keys[0] {
+		keys = append(keys, flat)
+	}
+	return keys
 }
 
 // generateReplayKey generates storage key for replay files
 // For date hierarchy strategy: YYYY-MM-DD/sessionID.cast
 // For flat strategy: sessionID.cast
 func (a *SessionReplayAdapter) generateReplayKey(sessionID string, timestamp time.Time) string {
+	return GenerateKey(a.provider, sessionID+".cast", timestamp)
+}
+
+// GenerateKey generates the storage key of filename following the path strategy of provider
+// For date hierarchy strategy: YYYY-MM-DD/filename
+// For flat strategy: filename
+func GenerateKey(provider Provider, filename string, timestamp time.Time) string {
 	// Check if provider supports advanced path generation
-	if advProvider, ok := a.provider.(AdvancedProvider); ok {
+	if advProvider, ok := provider.(AdvancedProvider); ok {
 		strategy := advProvider.GetPathStrategy()
 		if strategy == DateHierarchyStrategy {
-			// Use date-based path: YYYY-MM-DD/sessionID.cast
+			// Use date-based path: YYYY-MM-DD/filename
 			dateDir := timestamp.Format("2006-01-02")
-			return dateDir + "/" + sessionID + ".cast"
+			return dateDir + "/" + filename
 		}
 	}
 
 	// Fallback to flat structure
-	return sessionID + ".cast"
-}
-
-// SaveReplayWithTimestamp saves a session replay with explicit timestamp
-func (a *SessionReplayAdapter) SaveReplayWithTimestamp(sessionID string, reader io.Reader, size int64, timestamp time.Time) error {
-	if a.provider == nil {
-		logger.L().Warn("SessionReplayAdapter provider is nil", zap.String("session_id", sessionID))
-		return nil
-	}
-
-	ctx := context.Background()
-	key := a.generateReplayKey(sessionID, timestamp)
-
-	return a.provider.Upload(ctx, key, reader, size)
+	return filename
 }
 
 // Global adapter instance
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encodings stored files may be compressed with, named like their HTTP Content-Encoding
+const (
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+)
+
+var compressedExtensions = map[string]string{
+	EncodingGzip: ".gz",
+	EncodingZstd: ".zst",
+}
+
+// ValidEncoding tells whether files can be compressed with encoding, empty meaning uncompressed
+func ValidEncoding(encoding string) bool {
+	_, ok := compressedExtensions[encoding]
+	return ok || encoding == ""
+}
+
+// CompressedExtension returns the key suffix of files compressed with encoding
+func CompressedExtension(encoding string) string {
+	return compressedExtensions[encoding]
+}
+
+// EncodingFromKey tells the encoding of a stored file from its key suffix, empty when it is not compressed
+func EncodingFromKey(key string) string {
+	for encoding, ext := range compressedExtensions {
+		if strings.HasSuffix(key, ext) {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// TrimCompressedExtension removes the compression suffix from a key or file name
+func TrimCompressedExtension(key string) string {
+	return strings.TrimSuffix(key, CompressedExtension(EncodingFromKey(key)))
+}
+
+// Compress reads reader to the end and writes its content compressed with encoding to dst
+func Compress(encoding string, dst io.Writer, reader io.Reader) error {
+	var w io.WriteCloser
+	switch encoding {
+	case EncodingGzip:
+		w = gzip.NewWriter(dst)
+	case EncodingZstd:
+		zw, err := zstd.NewWriter(dst)
+		if err != nil {
+			return err
+		}
+		w = zw
+	default:
+		return fmt.Errorf("unsupported encoding %q", encoding)
+	}
+
+	if _, err := io.Copy(w, reader); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// CompressToTemp compresses reader into a temporary file and returns it rewound with its size, so large recordings
+// are streamed to the provider instead of held in memory. The caller closes and removes the file.
+func CompressToTemp(encoding string, reader io.Reader) (*os.File, int64, error) {
+	tmp, err := os.CreateTemp("", "oneterm-compress-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := func() (int64, error) {
+		if err := Compress(encoding, tmp, reader); err != nil {
+			return 0, err
+		}
+		size, err := tmp.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tmp.Seek(0, io.SeekStart)
+		return size, err
+	}()
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, 0, err
+	}
+	return tmp, size, nil
+}
+
+// Decompress wraps reader to read the content compressed with encoding, an empty encoding returns reader as is.
+// Closing the result closes reader.
+func Decompress(encoding string, reader io.ReadCloser) (io.ReadCloser, error) {
+	switch encoding {
+	case "":
+		return reader, nil
+	case EncodingGzip:
+		zr, err := gzip.NewReader(reader)
+		if err != nil {
+			reader.Close()
+			return nil, err
+		}
+		return readCloser{Reader: zr, Closer: reader}, nil
+	case EncodingZstd:
+		zr, err := zstd.NewReader(reader)
+		if err != nil {
+			reader.Close()
+			return nil, err
+		}
+		return &zstdReadCloser{Decoder: zr, src: reader}, nil
+	default:
+		reader.Close()
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
+
+type zstdReadCloser struct {
+	*zstd.Decoder
+	src io.Closer
+}
+
+func (z *zstdReadCloser) Close() error {
+	z.Decoder.Close()
+	return z.src.Close()
+}
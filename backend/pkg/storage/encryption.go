@@ -0,0 +1,444 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Encrypted objects are laid out as
+//
+//	magic "OTE1" | key id length (1) | key id | wrapped data key length (2) | wrapped data key | nonce prefix (8)
+//	segments of: sealed length (4, high bit marks the last segment) | AES-GCM sealed segment
+//
+// The data key is random per object and wrapped with AES-GCM under the master key named by the key id.
+// Segment nonces are the prefix followed by the segment counter and the last flag is authenticated,
+// so segments cannot be reordered, dropped or cut off.
+const (
+	encryptionMagic    = "OTE1"
+	encryptSegmentSize = 64 * 1024
+	lastSegmentFlag    = 1 << 31
+	noncePrefixSize    = 8
+	segmentOverhead    = 4 + 16 // length and GCM tag
+	maxSealedSegment   = encryptSegmentSize + 16
+	dataKeySize        = 32
+)
+
+// ErrCorrupt is returned when the stored bytes of an encrypted object fail authentication, they were changed or cut off
+var ErrCorrupt = errors.New("encrypted object is corrupt")
+
+// Keyring holds the master keys of envelope encryption, new objects are wrapped with the current key
+// and retired keys are kept to read objects written before a rotation
+type Keyring struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring creates a keyring from 32 byte AES master keys by id
+func NewKeyring(current string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{current: current, keys: map[string]cipher.AEAD{}}
+	for id, key := range keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("invalid master key id %q", id)
+		}
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, fmt.Errorf("master key %s: %w", id, err)
+		}
+		k.keys[id] = aead
+	}
+	if _, ok := k.keys[current]; !ok {
+		return nil, fmt.Errorf("current master key %q is not configured", current)
+	}
+	return k, nil
+}
+
+// CurrentKeyId returns the id of the key wrapping new objects
+func (k *Keyring) CurrentKeyId() string {
+	return k.current
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != dataKeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", dataKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptedProvider wraps a provider with envelope encryption. Objects stored in plaintext before encryption was
+// enabled are still read as is, unless encryption is required: a plaintext object is then treated as corrupt, so
+// an object replaced by a plaintext one is never served.
+type EncryptedProvider struct {
+	Provider
+	keyring  *Keyring
+	required bool
+}
+
+// NewEncryptedProvider wraps a provider with envelope encryption, required refuses plaintext objects
+func NewEncryptedProvider(provider Provider, keyring *Keyring, required bool) *EncryptedProvider {
+	return &EncryptedProvider{Provider: provider, keyring: keyring, required: required}
+}
+
+// Keyring returns the keyring of the provider
+func (p *EncryptedProvider) Keyring() *Keyring {
+	return p.keyring
+}
+
+// GetPathStrategy returns the path strategy of the wrapped provider
+func (p *EncryptedProvider) GetPathStrategy() PathStrategy {
+	if adv, ok := p.Provider.(AdvancedProvider); ok {
+		return adv.GetPathStrategy()
+	}
+	return FlatStrategy
+}
+
+// Upload encrypts the object under a new data key, size is the plaintext size
+func (p *EncryptedProvider) Upload(ctx context.Context, key string, reader io.Reader, size int64) error {
+	dataKey := make([]byte, dataKeySize)
+	prefix := make([]byte, noncePrefixSize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+	if _, err := rand.Read(prefix); err != nil {
+		return err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return err
+	}
+
+	master := p.keyring.keys[p.keyring.current]
+	nonce := make([]byte, master.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	wrapped := master.Seal(nonce, nonce, dataKey, []byte(p.keyring.current))
+
+	header := []byte(encryptionMagic)
+	header = append(header, byte(len(p.keyring.current)))
+	header = append(header, p.keyring.current...)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrapped)))
+	header = append(header, wrapped...)
+	header = append(header, prefix...)
+
+	enc := &encryptingReader{
+		src:     bufio.NewReader(reader),
+		aead:    aead,
+		prefix:  prefix,
+		pending: header,
+		buf:     make([]byte, encryptSegmentSize),
+	}
+	return p.Provider.Upload(ctx, key, enc, int64(len(header))+encryptedBodySize(size))
+}
+
+// Download decrypts the object while it is read
+func (p *EncryptedProvider) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	rc, err := p.Provider.Download(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReaderSize(rc, encryptSegmentSize+segmentOverhead)
+	h, err := p.readHeader(r)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("decrypt %s: %w", key, err)
+	}
+	if h == nil {
+		return readCloser{Reader: r, Closer: rc}, nil
+	}
+
+	return readCloser{Reader: &decryptingReader{src: r, aead: h.aead, prefix: h.prefix}, Closer: rc}, nil
+}
+
+// GetSize returns the plaintext size of the object
+func (p *EncryptedProvider) GetSize(ctx context.Context, key string) (int64, error) {
+	stored, err := p.Provider.GetSize(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	rc, err := p.Provider.Download(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+
+	h, err := p.readHeader(bufio.NewReader(rc))
+	if err != nil {
+		return 0, err
+	}
+	return h.plainSize(stored), nil
+}
+
+// ObjectKeyId returns the id of the master key wrapping an object, empty for a plaintext object
+func (p *EncryptedProvider) ObjectKeyId(ctx context.Context, key string) (string, error) {
+	rc, err := p.Provider.Download(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	h, err := p.readHeader(bufio.NewReader(rc))
+	if err != nil || h == nil {
+		return "", err
+	}
+	return h.keyId, nil
+}
+
+// Rekey encrypts an object again under the current master key, plaintext objects get encrypted.
+// It returns false when the object already uses the current key.
+func (p *EncryptedProvider) Rekey(ctx context.Context, key string) (bool, error) {
+	rc, err := p.Provider.Download(ctx, key)
+	if err != nil {
+		return false, err
+	}
+
+	// The stored bytes are spooled first, the object is overwritten in place and they are put back when the
+	// upload fails. The spool only holds plaintext for objects that were stored in plaintext.
+	tmp, err := os.CreateTemp("", "oneterm-rekey-")
+	if err != nil {
+		rc.Close()
+		return false, err
+	}
+	keep := false
+	defer func() {
+		tmp.Close()
+		if !keep {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	stored, err := io.Copy(tmp, rc)
+	rc.Close()
+	if err != nil {
+		return false, err
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	r := bufio.NewReaderSize(tmp, encryptSegmentSize+segmentOverhead)
+	h, err := p.readHeader(r)
+	if err != nil || (h != nil && h.keyId == p.keyring.current) {
+		return false, err
+	}
+	var plain io.Reader = r
+	if h != nil {
+		plain = &decryptingReader{src: r, aead: h.aead, prefix: h.prefix}
+	}
+
+	uploadErr := p.Upload(ctx, key, plain, h.plainSize(stored))
+	if uploadErr == nil {
+		return true, nil
+	}
+
+	if _, err = tmp.Seek(0, io.SeekStart); err == nil {
+		err = p.Provider.Upload(ctx, key, tmp, stored)
+	}
+	if err != nil {
+		keep = true
+		return false, fmt.Errorf("rekey %s: %w, restoring the object failed: %v, its stored bytes are kept in %s", key, uploadErr, err, tmp.Name())
+	}
+	return false, fmt.Errorf("rekey %s: %w", key, uploadErr)
+}
+
+type objectHeader struct {
+	keyId  string
+	aead   cipher.AEAD
+	prefix []byte
+	size   int
+}
+
+// plainSize is the plaintext size of an object of stored bytes, a nil header is a plaintext object
+func (h *objectHeader) plainSize(stored int64) int64 {
+	if h == nil {
+		return stored
+	}
+	body := stored - int64(h.size)
+	segments := (body + encryptSegmentSize + segmentOverhead - 1) / (encryptSegmentSize + segmentOverhead)
+	return body - segments*segmentOverhead
+}
+
+// readHeader consumes the encryption header, nil without error when the object is plaintext and encryption is
+// not required
+func (p *EncryptedProvider) readHeader(r *bufio.Reader) (*objectHeader, error) {
+	magic, err := r.Peek(len(encryptionMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if string(magic) != encryptionMagic {
+		if p.required {
+			return nil, fmt.Errorf("%w: object is not encrypted", ErrCorrupt)
+		}
+		return nil, nil
+	}
+	r.Discard(len(encryptionMagic))
+
+	idLen, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, idLen)
+	if _, err = io.ReadFull(r, id); err != nil {
+		return nil, err
+	}
+	var wrappedLen uint16
+	if err = binary.Read(r, binary.BigEndian, &wrappedLen); err != nil {
+		return nil, err
+	}
+	wrapped := make([]byte, wrappedLen)
+	if _, err = io.ReadFull(r, wrapped); err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, noncePrefixSize)
+	if _, err = io.ReadFull(r, prefix); err != nil {
+		return nil, err
+	}
+
+	master, ok := p.keyring.keys[string(id)]
+	if !ok {
+		return nil, fmt.Errorf("master key %s is not configured", id)
+	}
+	if len(wrapped) < master.NonceSize() {
+		return nil, fmt.Errorf("%w: data key too short", ErrCorrupt)
+	}
+	dataKey, err := master.Open(nil, wrapped[:master.NonceSize()], wrapped[master.NonceSize():], id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unwrap data key: %v", ErrCorrupt, err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &objectHeader{
+		keyId:  string(id),
+		aead:   aead,
+		prefix: prefix,
+		size:   len(encryptionMagic) + 1 + int(idLen) + 2 + int(wrappedLen) + noncePrefixSize,
+	}, nil
+}
+
+// encryptedBodySize is the size of the segments of a plaintext, an empty plaintext still has its last segment
+func encryptedBodySize(size int64) int64 {
+	segments := max((size+encryptSegmentSize-1)/encryptSegmentSize, 1)
+	return size + segments*segmentOverhead
+}
+
+func segmentNonce(prefix []byte, counter uint32) []byte {
+	return binary.BigEndian.AppendUint32(append([]byte{}, prefix...), counter)
+}
+
+func segmentAD(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+type encryptingReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	pending []byte
+	buf     []byte
+	counter uint32
+	done    bool
+}
+
+func (e *encryptingReader) Read(p []byte) (int, error) {
+	for len(e.pending) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(e.src, e.buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		_, peekErr := e.src.Peek(1)
+		last := peekErr != nil
+		if last && peekErr != io.EOF {
+			return 0, peekErr
+		}
+
+		sealed := e.aead.Seal(nil, segmentNonce(e.prefix, e.counter), e.buf[:n], segmentAD(last))
+		length := uint32(len(sealed))
+		if last {
+			length |= lastSegmentFlag
+		}
+		e.pending = append(binary.BigEndian.AppendUint32(nil, length), sealed...)
+		e.counter++
+		e.done = last
+	}
+
+	n := copy(p, e.pending)
+	e.pending = e.pending[n:]
+	return n, nil
+}
+
+type decryptingReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	pending []byte
+	counter uint32
+	done    bool
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		var length uint32
+		if err := binary.Read(d.src, binary.BigEndian, &length); err != nil {
+			return 0, truncated(err)
+		}
+		last := length&lastSegmentFlag != 0
+		// The length is not authenticated yet, a segment is never larger than the ones written
+		if length&^lastSegmentFlag > maxSealedSegment {
+			return 0, fmt.Errorf("%w: segment %d of %d bytes", ErrCorrupt, d.counter, length&^lastSegmentFlag)
+		}
+		sealed := make([]byte, length&^lastSegmentFlag)
+		if _, err := io.ReadFull(d.src, sealed); err != nil {
+			return 0, truncated(err)
+		}
+
+		plain, err := d.aead.Open(nil, segmentNonce(d.prefix, d.counter), sealed, segmentAD(last))
+		if err != nil {
+			return 0, fmt.Errorf("%w: decrypt segment %d: %v", ErrCorrupt, d.counter, err)
+		}
+		d.pending = plain
+		d.counter++
+		d.done = last
+	}
+
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+// truncated reports an object ending before its last segment as corrupt, read errors of the storage are kept
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: truncated", ErrCorrupt)
+	}
+	return err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,361 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// memProvider keeps objects in memory, failUploads uploads fail after storing part of the object
+type memProvider struct {
+	objects     map[string][]byte
+	failUploads int
+}
+
+func newMemProvider() *memProvider {
+	return &memProvider{objects: map[string][]byte{}}
+}
+
+func (m *memProvider) Upload(ctx context.Context, key string, reader io.Reader, size int64) error {
+	bs, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if int64(len(bs)) != size {
+		return fmt.Errorf("upload of %s: %d bytes, %d announced", key, len(bs), size)
+	}
+	if m.failUploads > 0 {
+		m.failUploads--
+		m.objects[key] = bs[:len(bs)/2]
+		return errors.New("upload failed")
+	}
+	m.objects[key] = bs
+	return nil
+}
+
+func (m *memProvider) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	bs, ok := m.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", key)
+	}
+	return io.NopCloser(bytes.NewReader(bs)), nil
+}
+
+func (m *memProvider) Delete(ctx context.Context, key string) error {
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memProvider) Exists(ctx context.Context, key string) (bool, error) {
+	_, ok := m.objects[key]
+	return ok, nil
+}
+
+func (m *memProvider) GetSize(ctx context.Context, key string) (int64, error) {
+	return int64(len(m.objects[key])), nil
+}
+
+func (m *memProvider) List(ctx context.Context, prefix, marker string, limit int) (*ListResult, error) {
+	return &ListResult{}, nil
+}
+
+func (m *memProvider) Type() string                          { return "memory" }
+func (m *memProvider) HealthCheck(ctx context.Context) error { return nil }
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, dataKeySize)
+}
+
+func testKeyring(t *testing.T, current string, keys map[string][]byte) *Keyring {
+	t.Helper()
+	keyring, err := NewKeyring(current, keys)
+	if err != nil {
+		t.Fatalf("NewKeyring() error = %v", err)
+	}
+	return keyring
+}
+
+func testPlaintext(size int) []byte {
+	bs := make([]byte, size)
+	for i := range bs {
+		bs[i] = byte(i*7 + i/encryptSegmentSize)
+	}
+	return bs
+}
+
+func readObject(p Provider, key string) ([]byte, error) {
+	rc, err := p.Download(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func TestEncryptedProviderRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{name: "empty", size: 0},
+		{name: "one byte", size: 1},
+		{name: "segment minus one", size: encryptSegmentSize - 1},
+		{name: "one segment", size: encryptSegmentSize},
+		{name: "segment plus one", size: encryptSegmentSize + 1},
+		{name: "several segments", size: 3*encryptSegmentSize + 17},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := newMemProvider()
+			p := NewEncryptedProvider(mem, testKeyring(t, "k1", map[string][]byte{"k1": testKey(1)}), true)
+			plain := testPlaintext(tt.size)
+
+			if err := p.Upload(context.Background(), "obj", bytes.NewReader(plain), int64(len(plain))); err != nil {
+				t.Fatalf("Upload() error = %v", err)
+			}
+			if len(plain) >= 16 && bytes.Contains(mem.objects["obj"], plain[:16]) {
+				t.Errorf("stored object contains plaintext")
+			}
+
+			got, err := readObject(p, "obj")
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("Download() = %d bytes, want the %d uploaded", len(got), len(plain))
+			}
+			size, err := p.GetSize(context.Background(), "obj")
+			if err != nil || size != int64(len(plain)) {
+				t.Errorf("GetSize() = %d, %v, want %d", size, err, len(plain))
+			}
+		})
+	}
+}
+
+// segments returns the offsets of the segments of a stored object after its header
+func segments(t *testing.T, stored []byte, headerSize int) [][2]int {
+	t.Helper()
+	var offsets [][2]int
+	for off := headerSize; off < len(stored); {
+		length := int(binary.BigEndian.Uint32(stored[off:]) &^ lastSegmentFlag)
+		offsets = append(offsets, [2]int{off, off + 4 + length})
+		off += 4 + length
+	}
+	return offsets
+}
+
+func TestEncryptedProviderTampering(t *testing.T) {
+	keyring := testKeyring(t, "k1", map[string][]byte{"k1": testKey(1)})
+	headerSize := len(encryptionMagic) + 1 + len("k1") + 2 + 12 + dataKeySize + 16 + noncePrefixSize
+
+	tests := []struct {
+		name   string
+		tamper func(stored []byte, segs [][2]int) []byte
+	}{
+		{
+			name: "last segment dropped",
+			tamper: func(stored []byte, segs [][2]int) []byte {
+				return stored[:segs[2][0]]
+			},
+		},
+		{
+			name: "cut inside a segment",
+			tamper: func(stored []byte, segs [][2]int) []byte {
+				return stored[:segs[1][0]+100]
+			},
+		},
+		{
+			name: "segments swapped",
+			tamper: func(stored []byte, segs [][2]int) []byte {
+				out := append([]byte{}, stored[:segs[0][0]]...)
+				out = append(out, stored[segs[1][0]:segs[1][1]]...)
+				out = append(out, stored[segs[0][0]:segs[0][1]]...)
+				return append(out, stored[segs[2][0]:]...)
+			},
+		},
+		{
+			name: "last flag moved to an earlier segment",
+			tamper: func(stored []byte, segs [][2]int) []byte {
+				out := append([]byte{}, stored[:segs[2][0]]...)
+				out[segs[1][0]] |= 0x80
+				return out
+			},
+		},
+		{
+			name: "last flag cleared",
+			tamper: func(stored []byte, segs [][2]int) []byte {
+				out := append([]byte{}, stored...)
+				out[segs[2][0]] &^= 0x80
+				return out
+			},
+		},
+		{
+			name: "byte flipped",
+			tamper: func(stored []byte, segs [][2]int) []byte {
+				out := append([]byte{}, stored...)
+				out[segs[1][0]+10] ^= 1
+				return out
+			},
+		},
+		{
+			name: "oversized segment length",
+			tamper: func(stored []byte, segs [][2]int) []byte {
+				out := append([]byte{}, stored...)
+				binary.BigEndian.PutUint32(out[segs[0][0]:], 1<<30)
+				return out
+			},
+		},
+		{
+			name: "wrapped data key changed",
+			tamper: func(stored []byte, segs [][2]int) []byte {
+				out := append([]byte{}, stored...)
+				out[len(encryptionMagic)+1+len("k1")+2+4] ^= 1
+				return out
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := newMemProvider()
+			p := NewEncryptedProvider(mem, keyring, false)
+			plain := testPlaintext(2*encryptSegmentSize + 100)
+			if err := p.Upload(context.Background(), "obj", bytes.NewReader(plain), int64(len(plain))); err != nil {
+				t.Fatalf("Upload() error = %v", err)
+			}
+			segs := segments(t, mem.objects["obj"], headerSize)
+			if len(segs) != 3 {
+				t.Fatalf("object has %d segments, want 3", len(segs))
+			}
+
+			mem.objects["obj"] = tt.tamper(mem.objects["obj"], segs)
+			if _, err := readObject(p, "obj"); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("Download() error = %v, want ErrCorrupt", err)
+			}
+		})
+	}
+}
+
+func TestEncryptedProviderKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyring map[string][]byte
+		corrupt bool
+	}{
+		{name: "retired key still configured", keyring: map[string][]byte{"k1": testKey(1), "k2": testKey(2)}},
+		{name: "key id not configured", keyring: map[string][]byte{"k2": testKey(2)}},
+		{name: "key id with other key bytes", keyring: map[string][]byte{"k1": testKey(3), "k2": testKey(2)}, corrupt: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := newMemProvider()
+			writer := NewEncryptedProvider(mem, testKeyring(t, "k1", map[string][]byte{"k1": testKey(1)}), false)
+			plain := testPlaintext(1000)
+			if err := writer.Upload(context.Background(), "obj", bytes.NewReader(plain), int64(len(plain))); err != nil {
+				t.Fatalf("Upload() error = %v", err)
+			}
+
+			reader := NewEncryptedProvider(mem, testKeyring(t, "k2", tt.keyring), false)
+			got, err := readObject(reader, "obj")
+			_, configured := tt.keyring["k1"]
+			switch {
+			case configured && !tt.corrupt:
+				if err != nil || !bytes.Equal(got, plain) {
+					t.Errorf("Download() = %d bytes, %v, want the plaintext", len(got), err)
+				}
+			case tt.corrupt:
+				if !errors.Is(err, ErrCorrupt) {
+					t.Errorf("Download() error = %v, want ErrCorrupt", err)
+				}
+			default:
+				if err == nil || errors.Is(err, ErrCorrupt) {
+					t.Errorf("Download() error = %v, want a missing key error", err)
+				}
+			}
+		})
+	}
+}
+
+func TestEncryptedProviderPlaintext(t *testing.T) {
+	tests := []struct {
+		name     string
+		required bool
+		wantErr  error
+	}{
+		{name: "read as is", required: false},
+		{name: "refused when required", required: true, wantErr: ErrCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := newMemProvider()
+			plain := []byte("stored before encryption was enabled")
+			mem.objects["obj"] = plain
+
+			p := NewEncryptedProvider(mem, testKeyring(t, "k1", map[string][]byte{"k1": testKey(1)}), tt.required)
+			got, err := readObject(p, "obj")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Download() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !bytes.Equal(got, plain) {
+				t.Errorf("Download() = %q, want %q", got, plain)
+			}
+		})
+	}
+}
+
+func TestEncryptedProviderRekey(t *testing.T) {
+	keys := map[string][]byte{"k1": testKey(1), "k2": testKey(2)}
+	plain := testPlaintext(encryptSegmentSize + 10)
+
+	tests := []struct {
+		name        string
+		plaintext   bool
+		failUploads int
+		wantRekeyed bool
+		wantErr     bool
+	}{
+		{name: "old key", wantRekeyed: true},
+		{name: "plaintext object", plaintext: true, wantRekeyed: true},
+		{name: "upload fails, object restored", failUploads: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := newMemProvider()
+			if tt.plaintext {
+				mem.objects["obj"] = plain
+			} else {
+				old := NewEncryptedProvider(mem, testKeyring(t, "k1", keys), false)
+				if err := old.Upload(context.Background(), "obj", bytes.NewReader(plain), int64(len(plain))); err != nil {
+					t.Fatalf("Upload() error = %v", err)
+				}
+			}
+			before := mem.objects["obj"]
+
+			p := NewEncryptedProvider(mem, testKeyring(t, "k2", keys), false)
+			mem.failUploads = tt.failUploads
+			rekeyed, err := p.Rekey(context.Background(), "obj")
+			if rekeyed != tt.wantRekeyed || (err != nil) != tt.wantErr {
+				t.Fatalf("Rekey() = %v, %v, want %v, error %v", rekeyed, err, tt.wantRekeyed, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if !bytes.Equal(mem.objects["obj"], before) {
+					t.Errorf("object not restored after a failed rekey")
+				}
+				return
+			}
+			if id, err := p.ObjectKeyId(context.Background(), "obj"); err != nil || id != "k2" {
+				t.Errorf("ObjectKeyId() = %q, %v, want k2", id, err)
+			}
+			if got, err := readObject(p, "obj"); err != nil || !bytes.Equal(got, plain) {
+				t.Errorf("Download() = %d bytes, %v, want the plaintext", len(got), err)
+			}
+			if rekeyed, err = p.Rekey(context.Background(), "obj"); rekeyed || err != nil {
+				t.Errorf("second Rekey() = %v, %v, want false, nil", rekeyed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+)
+
+// ChainChunkSize is the size of the chunks a HashChain links together
+const ChainChunkSize = 64 * 1024
+
+// Digest proves the content of a stored file
+type Digest struct {
+	Size      int64  `json:"size"`
+	Checksum  string `json:"checksum"`   // hex encoded SHA-256 of the whole file
+	ChainHash string `json:"chain_hash"` // hex encoded head of the chunk hash chain
+	Chunks    int    `json:"chunks"`
+	// ChunkHashes are the SHA-256 of each chunk one after the other, they locate a change the chain only detects
+	ChunkHashes []byte `json:"-"`
+}
+
+// Matches tells whether two digests are of the same content
+func (d *Digest) Matches(other *Digest) bool {
+	return d.Checksum == other.Checksum && d.ChainHash == other.ChainHash
+}
+
+// HashChain hashes a stream as a whole and as a chain of fixed size chunks,
+// where link i is SHA-256(link i-1 || SHA-256(chunk i)) and link 0 is all zeros.
+// Altering any chunk changes every following link, so the head covers the whole stream in order.
+// The chunk hashes are kept too, the head vouches for them.
+type HashChain struct {
+	whole  hash.Hash
+	chunk  hash.Hash
+	head   [sha256.Size]byte
+	hashes []byte
+	filled int
+	chunks int
+	size   int64
+}
+
+// NewHashChain creates an empty hash chain
+func NewHashChain() *HashChain {
+	return &HashChain{
+		whole: sha256.New(),
+		chunk: sha256.New(),
+	}
+}
+
+// Write adds p to the stream, it never fails
+func (c *HashChain) Write(p []byte) (int, error) {
+	n := len(p)
+	c.whole.Write(p)
+	c.size += int64(n)
+
+	for len(p) > 0 {
+		take := min(len(p), ChainChunkSize-c.filled)
+		c.chunk.Write(p[:take])
+		c.filled += take
+		p = p[take:]
+		if c.filled == ChainChunkSize {
+			c.link()
+		}
+	}
+
+	return n, nil
+}
+
+// Sum returns the digest of the stream written so far, a trailing partial chunk is linked as the last one
+func (c *HashChain) Sum() *Digest {
+	head, chunks, hashes := c.head, c.chunks, c.hashes
+	if c.filled > 0 {
+		sum := c.chunk.Sum(nil)
+		head = linkChunk(head, sum)
+		hashes = append(hashes[:len(hashes):len(hashes)], sum...)
+		chunks++
+	}
+
+	return &Digest{
+		Size:        c.size,
+		Checksum:    hex.EncodeToString(c.whole.Sum(nil)),
+		ChainHash:   hex.EncodeToString(head[:]),
+		Chunks:      chunks,
+		ChunkHashes: hashes,
+	}
+}
+
+func (c *HashChain) link() {
+	sum := c.chunk.Sum(nil)
+	c.head = linkChunk(c.head, sum)
+	c.hashes = append(c.hashes, sum...)
+	c.chunk.Reset()
+	c.filled = 0
+	c.chunks++
+}
+
+func linkChunk(head [sha256.Size]byte, chunkHash []byte) [sha256.Size]byte {
+	link := sha256.New()
+	link.Write(head[:])
+	link.Write(chunkHash)
+	copy(head[:], link.Sum(nil))
+	return head
+}
+
+// ChainHead returns the head of the chain linking chunk hashes, false when they are not whole SHA-256 sums
+func ChainHead(chunkHashes []byte) (string, bool) {
+	if len(chunkHashes)%sha256.Size != 0 {
+		return "", false
+	}
+	var head [sha256.Size]byte
+	for i := 0; i < len(chunkHashes); i += sha256.Size {
+		head = linkChunk(head, chunkHashes[i:i+sha256.Size])
+	}
+	return hex.EncodeToString(head[:]), true
+}
+
+// FirstChangedChunk returns the index of the first chunk whose hash differs between two digests, a chunk missing
+// from either one counts as changed. It returns -1 when every chunk matches.
+func FirstChangedChunk(recorded, actual []byte) int {
+	n := min(len(recorded), len(actual)) / sha256.Size
+	for i := 0; i < n; i++ {
+		if !bytes.Equal(recorded[i*sha256.Size:(i+1)*sha256.Size], actual[i*sha256.Size:(i+1)*sha256.Size]) {
+			return i
+		}
+	}
+	if len(recorded) != len(actual) {
+		return n
+	}
+	return -1
+}
@@ -3,8 +3,12 @@ package storage
 import (
 	"context"
 	"io"
+	"time"
 )
 
+// DefaultListLimit is the page size List uses when no limit is given
+const DefaultListLimit = 1000
+
 // Provider defines the interface for storage operations
 type Provider interface {
 	// Upload uploads a file to storage
@@ -22,6 +26,10 @@ type Provider interface {
 	// GetSize gets the size of a file
 	GetSize(ctx context.Context, key string) (int64, error)
 
+	// List lists files whose key starts with prefix, one page at a time.
+	// Pass the NextMarker of a page to get the following one, limit <= 0 uses DefaultListLimit
+	List(ctx context.Context, prefix, marker string, limit int) (*ListResult, error)
+
 	// Type returns the storage provider type
 	Type() string
 
@@ -29,6 +37,39 @@ type Provider interface {
 	HealthCheck(ctx context.Context) error
 }
 
+// FileInfo describes a stored file
+type FileInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ListResult is a page of files returned by List
+type ListResult struct {
+	Files      []FileInfo `json:"files"`
+	NextMarker string     `json:"next_marker"` // empty on the last page
+}
+
+// Walk calls fn for every file whose key starts with prefix, following List pages
+func Walk(ctx context.Context, provider Provider, prefix string, fn func(FileInfo) error) error {
+	marker := ""
+	for {
+		page, err := provider.List(ctx, prefix, marker, DefaultListLimit)
+		if err != nil {
+			return err
+		}
+		for _, f := range page.Files {
+			if err := fn(f); err != nil {
+				return err
+			}
+		}
+		if page.NextMarker == "" {
+			return nil
+		}
+		marker = page.NextMarker
+	}
+}
+
 // Config represents storage configuration
 type Config struct {
 	Type       string            `json:"type"`
@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/samber/lo"
 	"github.com/veops/oneterm/pkg/logger"
 	"github.com/veops/oneterm/pkg/storage"
 	"go.uber.org/zap"
@@ -172,6 +173,40 @@ func (a *Azure) GetSize(ctx context.Context, key string) (int64, error) {
 	return properties.ContentLength(), nil
 }
 
+// List lists blobs in the container whose name starts with prefix
+func (a *Azure) List(ctx context.Context, prefix, marker string, limit int) (*storage.ListResult, error) {
+	if limit <= 0 {
+		limit = storage.DefaultListLimit
+	}
+
+	m := azblob.Marker{}
+	if marker != "" {
+		m.Val = &marker
+	}
+
+	output, err := a.containerURL.ListBlobsFlatSegment(ctx, m, azblob.ListBlobsSegmentOptions{
+		Prefix:     prefix,
+		MaxResults: int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs: %w", err)
+	}
+
+	result := &storage.ListResult{}
+	for _, blob := range output.Segment.BlobItems {
+		result.Files = append(result.Files, storage.FileInfo{
+			Key:          blob.Name,
+			Size:         lo.FromPtr(blob.Properties.ContentLength),
+			LastModified: blob.Properties.LastModified,
+		})
+	}
+	if output.NextMarker.NotDone() {
+		result.NextMarker = lo.FromPtr(output.NextMarker.Val)
+	}
+
+	return result, nil
+}
+
 // Type returns the storage type
 func (a *Azure) Type() string {
 	return "azure"
@@ -9,7 +9,9 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/samber/lo"
 	"github.com/tencentyun/cos-go-sdk-v5"
 	"github.com/veops/oneterm/pkg/logger"
 	"github.com/veops/oneterm/pkg/storage"
@@ -168,6 +170,33 @@ func (c *COS) GetSize(ctx context.Context, key string) (int64, error) {
 	return size, nil
 }
 
+// List lists objects in the bucket whose key starts with prefix
+func (c *COS) List(ctx context.Context, prefix, marker string, limit int) (*storage.ListResult, error) {
+	if limit <= 0 {
+		limit = storage.DefaultListLimit
+	}
+
+	output, _, err := c.client.Bucket.Get(ctx, &cos.BucketGetOptions{
+		Prefix:  prefix,
+		Marker:  marker,
+		MaxKeys: limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	result := &storage.ListResult{}
+	for _, obj := range output.Contents {
+		modified, _ := time.Parse(time.RFC3339, obj.LastModified)
+		result.Files = append(result.Files, storage.FileInfo{Key: obj.Key, Size: obj.Size, LastModified: modified})
+	}
+	if output.IsTruncated && len(result.Files) > 0 {
+		result.NextMarker = lo.CoalesceOrEmpty(output.NextMarker, result.Files[len(result.Files)-1].Key)
+	}
+
+	return result, nil
+}
+
 // Type returns the storage type
 func (c *COS) Type() string {
 	return "cos"
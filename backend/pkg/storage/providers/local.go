@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/veops/oneterm/pkg/storage"
@@ -145,6 +148,63 @@ func (p *Local) GetSize(ctx context.Context, key string) (int64, error) {
 	return stat.Size(), nil
 }
 
+// List lists files under the base path whose key starts with prefix, in key order
+func (p *Local) List(ctx context.Context, prefix, marker string, limit int) (*storage.ListResult, error) {
+	if limit <= 0 {
+		limit = storage.DefaultListLimit
+	}
+
+	// Only walk the directory the prefix points into
+	root := p.config.BasePath
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		root = filepath.Join(root, filepath.FromSlash(prefix[:i]))
+	}
+
+	var files []storage.FileInfo
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() || d.Name() == ".health_check" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(p.config.BasePath, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) || key <= marker {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil // removed while walking
+		}
+		files = append(files, storage.FileInfo{Key: key, Size: info.Size(), LastModified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Key < files[j].Key })
+
+	result := &storage.ListResult{Files: files}
+	if len(files) > limit {
+		result.Files = files[:limit]
+		result.NextMarker = files[limit-1].Key
+	}
+	return result, nil
+}
+
 // Type returns the storage type
 func (p *Local) Type() string {
 	return "local"
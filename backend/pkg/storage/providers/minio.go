@@ -155,6 +155,36 @@ func (m *Minio) GetSize(ctx context.Context, key string) (int64, error) {
 	return stat.Size, nil
 }
 
+// List lists objects in the bucket whose key starts with prefix
+func (m *Minio) List(ctx context.Context, prefix, marker string, limit int) (*storage.ListResult, error) {
+	if limit <= 0 {
+		limit = storage.DefaultListLimit
+	}
+
+	// Stop the listing goroutine once one object past the page is seen
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	result := &storage.ListResult{}
+	for obj := range m.client.ListObjects(ctx, m.config.BucketName, minio.ListObjectsOptions{
+		Prefix:     prefix,
+		StartAfter: marker,
+		Recursive:  true,
+		MaxKeys:    limit,
+	}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", obj.Err)
+		}
+		if len(result.Files) == limit {
+			result.NextMarker = result.Files[limit-1].Key
+			break
+		}
+		result.Files = append(result.Files, storage.FileInfo{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified})
+	}
+
+	return result, nil
+}
+
 // Type returns the storage type
 func (m *Minio) Type() string {
 	return "minio"
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
+	"github.com/samber/lo"
 	"github.com/veops/oneterm/pkg/logger"
 	"github.com/veops/oneterm/pkg/storage"
 	"go.uber.org/zap"
@@ -163,6 +164,34 @@ func (o *OBS) GetSize(ctx context.Context, key string) (int64, error) {
 	return output.ContentLength, nil
 }
 
+// List lists objects in the bucket whose key starts with prefix
+func (o *OBS) List(ctx context.Context, prefix, marker string, limit int) (*storage.ListResult, error) {
+	if limit <= 0 {
+		limit = storage.DefaultListLimit
+	}
+
+	input := &obs.ListObjectsInput{}
+	input.Bucket = o.config.BucketName
+	input.Prefix = prefix
+	input.Marker = marker
+	input.MaxKeys = limit
+
+	output, err := o.client.ListObjects(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	result := &storage.ListResult{}
+	for _, obj := range output.Contents {
+		result.Files = append(result.Files, storage.FileInfo{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified})
+	}
+	if output.IsTruncated && len(result.Files) > 0 {
+		result.NextMarker = lo.CoalesceOrEmpty(output.NextMarker, result.Files[len(result.Files)-1].Key)
+	}
+
+	return result, nil
+}
+
 // Type returns the storage type
 func (o *OBS) Type() string {
 	return "obs"
@@ -6,15 +6,18 @@ import (
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/base64"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/samber/lo"
 	"github.com/veops/oneterm/pkg/logger"
 	"github.com/veops/oneterm/pkg/storage"
 	"go.uber.org/zap"
@@ -235,6 +238,69 @@ func (o *OOS) GetSize(ctx context.Context, key string) (int64, error) {
 	return size, nil
 }
 
+// oosListResult is the body of an OOS list objects response
+type oosListResult struct {
+	IsTruncated bool   `xml:"IsTruncated"`
+	NextMarker  string `xml:"NextMarker"`
+	Contents    []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+}
+
+// List lists objects in the bucket whose key starts with prefix
+func (o *OOS) List(ctx context.Context, prefix, marker string, limit int) (*storage.ListResult, error) {
+	if limit <= 0 {
+		limit = storage.DefaultListLimit
+	}
+
+	query := url.Values{}
+	query.Set("prefix", prefix)
+	query.Set("marker", marker)
+	query.Set("max-keys", strconv.Itoa(limit))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/%s?%s", strings.TrimRight(o.config.Endpoint, "/"), o.config.BucketName, query.Encode()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Set headers
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+
+	// Sign request
+	if err := o.signRequest(req, "GET", "", nil); err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	// Send request
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("list failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	output := &oosListResult{}
+	if err := xml.NewDecoder(resp.Body).Decode(output); err != nil {
+		return nil, fmt.Errorf("failed to decode list response: %w", err)
+	}
+
+	result := &storage.ListResult{}
+	for _, obj := range output.Contents {
+		result.Files = append(result.Files, storage.FileInfo{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified})
+	}
+	if output.IsTruncated && len(result.Files) > 0 {
+		result.NextMarker = lo.CoalesceOrEmpty(output.NextMarker, result.Files[len(result.Files)-1].Key)
+	}
+
+	return result, nil
+}
+
 // Type returns the storage type
 func (o *OOS) Type() string {
 	return "oos"
@@ -284,6 +350,10 @@ func (o *OOS) GetRetentionConfig() storage.StorageRetentionConfig {
 
 // getObjectKey generates the object key based on the path strategy
 func (o *OOS) getObjectKey(key string) string {
+	// Keys that already carry a directory, such as date hierarchy keys or keys returned by List, are used as is
+	if strings.Contains(key, "/") {
+		return key
+	}
 	if o.pathGenerator != nil {
 		// For session replay files, use the replay path generator
 		if strings.HasSuffix(key, ".cast") {
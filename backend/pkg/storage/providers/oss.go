@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/samber/lo"
 	"github.com/veops/oneterm/pkg/logger"
 	"github.com/veops/oneterm/pkg/storage"
 	"go.uber.org/zap"
@@ -165,6 +166,28 @@ func (o *OSS) GetSize(ctx context.Context, key string) (int64, error) {
 	return size, nil
 }
 
+// List lists objects in the bucket whose key starts with prefix
+func (o *OSS) List(ctx context.Context, prefix, marker string, limit int) (*storage.ListResult, error) {
+	if limit <= 0 {
+		limit = storage.DefaultListLimit
+	}
+
+	output, err := o.bucket.ListObjects(oss.Prefix(prefix), oss.Marker(marker), oss.MaxKeys(limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	result := &storage.ListResult{}
+	for _, obj := range output.Objects {
+		result.Files = append(result.Files, storage.FileInfo{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified})
+	}
+	if output.IsTruncated && len(result.Files) > 0 {
+		result.NextMarker = lo.CoalesceOrEmpty(output.NextMarker, result.Files[len(result.Files)-1].Key)
+	}
+
+	return result, nil
+}
+
 // Type returns the storage type
 func (o *OSS) Type() string {
 	return "oss"
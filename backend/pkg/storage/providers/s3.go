@@ -210,6 +210,41 @@ func (s *S3) GetSize(ctx context.Context, key string) (int64, error) {
 	return 0, nil
 }
 
+// List lists objects in the bucket whose key starts with prefix
+func (s *S3) List(ctx context.Context, prefix, marker string, limit int) (*storage.ListResult, error) {
+	if limit <= 0 {
+		limit = storage.DefaultListLimit
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(s.config.BucketName),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int64(int64(limit)),
+	}
+	if marker != "" {
+		input.ContinuationToken = aws.String(marker)
+	}
+
+	output, err := s.client.ListObjectsV2WithContext(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	result := &storage.ListResult{}
+	for _, obj := range output.Contents {
+		result.Files = append(result.Files, storage.FileInfo{
+			Key:          aws.StringValue(obj.Key),
+			Size:         aws.Int64Value(obj.Size),
+			LastModified: aws.TimeValue(obj.LastModified),
+		})
+	}
+	if aws.BoolValue(output.IsTruncated) {
+		result.NextMarker = aws.StringValue(output.NextContinuationToken)
+	}
+
+	return result, nil
+}
+
 // Type returns the storage type
 func (s *S3) Type() string {
 	return "s3"
@@ -7,6 +7,10 @@ export const PROTOCOL_ICON = {
   'mysql': 'oneterm-mysql',
   'mongodb': 'a-mongoDB1',
   'postgresql': 'a-postgreSQL1',
+  'mssql': 'a-postgreSQL1',
+  'oracle': 'a-postgreSQL1',
+  'kubernetes': 'a-oneterm-ssh2',
+  'docker': 'a-oneterm-ssh2',
   'https': 'oneterm-https',
   'http': 'oneterm-http'
 }
@@ -35,6 +39,16 @@ export const protocolSelectOption = [
         label: 'Telnet',
         icon: PROTOCOL_ICON['telnet']
       },
+      {
+        key: 'kubernetes',
+        label: 'Kubernetes',
+        icon: PROTOCOL_ICON['kubernetes']
+      },
+      {
+        key: 'docker',
+        label: 'Docker',
+        icon: PROTOCOL_ICON['docker']
+      },
     ]
   },
   {
@@ -59,6 +73,16 @@ export const protocolSelectOption = [
         key: 'postgresql',
         label: 'PostgreSQL',
         icon: PROTOCOL_ICON['postgresql']
+      },
+      {
+        key: 'mssql',
+        label: 'SQL Server',
+        icon: PROTOCOL_ICON['mssql']
+      },
+      {
+        key: 'oracle',
+        label: 'Oracle',
+        icon: PROTOCOL_ICON['oracle']
       }
     ]
   },
@@ -88,6 +112,10 @@ export const protocolMap = {
   'mysql': 3306,
   'mongodb': 27017,
   'postgresql': 5432,
+  'mssql': 1433,
+  'oracle': 1521,
+  'kubernetes': 6443,
+  'docker': 2375,
   'https': 443,
   'http': 80
 }